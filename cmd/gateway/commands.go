@@ -0,0 +1,77 @@
+package main
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/config"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+// usage describes the subcommands of the gateway.
+const usage = `usage: gateway [--config FILE]              start the gateway
+       gateway [--config FILE] config check  print the effective configuration and check it`
+
+// runCommand runs a subcommand of the gateway, given the configuration and the error returned when it was mapped.
+// It returns the exit code of the process.
+func runCommand(args []string, appSettings *settings.AppSettings, configErr error) int {
+	switch strings.Join(args, " ") {
+	case "config check":
+		return checkConfig(appSettings, configErr)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return exitCodeUsage
+	}
+}
+
+// checkConfig prints the effective configuration, with secrets redacted, followed by every problem found in it.
+func checkConfig(appSettings *settings.AppSettings, configErr error) int {
+	if err := config.Print(os.Stdout, appSettings); err != nil {
+		fmt.Fprintf(os.Stderr, "Error printing configuration: %s\n", err.Error())
+		return exitCodeInvalidConfig
+	}
+	if configErr == nil {
+		fmt.Fprintln(os.Stderr, "Configuration is valid")
+		return exitCodeOK
+	}
+	var validationErr *config.ValidationError
+	if errors.As(configErr, &validationErr) {
+		for _, problem := range validationErr.Problems {
+			fmt.Fprintf(os.Stderr, "Invalid %s\n", problem)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, configErr.Error())
+	}
+	return exitCodeInvalidConfig
+}
+
+// logConfigErrors logs every problem found in the configuration.
+func logConfigErrors(configErr error) {
+	var validationErr *config.ValidationError
+	if !errors.As(configErr, &validationErr) {
+		logging.Error("Invalid configuration: %s", configErr.Error())
+		return
+	}
+	for _, problem := range validationErr.Problems {
+		logging.Error("Invalid configuration: %s", problem)
+	}
+}
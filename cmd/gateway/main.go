@@ -23,118 +23,145 @@ package main
  */
 
 import (
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/spf13/pflag"
 
-	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
-	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrregistermgr"
-	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrrestserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 
 	"github.com/ConsenSys/fc-retrieval-gateway/config"
-	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/adminapi"
-	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/clientapi"
-	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/gatewayapi"
-	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/providerapi"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
 )
 
 // Start Gateway service
 func main() {
-	conf := config.NewConfig()
-	appSettings := config.Map(conf)
+	conf, err := config.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(exitCodeInvalidConfig)
+	}
+	appSettings, configErr := config.Map(conf)
+
+	// Run the subcommand given on the command line, if any, instead of the gateway.
+	if args := pflag.Args(); len(args) > 0 {
+		os.Exit(runCommand(args, &appSettings, configErr))
+	}
+
 	logging.Init(conf)
+	if configErr != nil {
+		logConfigErrors(configErr)
+		os.Exit(exitCodeInvalidConfig)
+	}
 	logging.Info("Filecoin Gateway Start-up: Started")
 
-	logging.Info("Settings: %+v", appSettings)
+	// Settings are logged through the configuration printer, so that secrets are redacted.
+	printed := new(strings.Builder)
+	if err := config.Print(printed, &appSettings); err != nil {
+		logging.Error("Error printing settings: %s", err.Error())
+	}
+	logging.Info("Settings:\n%s", printed.String())
+	logging.Info("Prices: search %s, offer %s, top up %s", payment.DescribeAmount(appSettings.SearchPrice),
+		payment.DescribeAmount(appSettings.OfferPrice), payment.DescribeAmount(appSettings.TopupAmount))
 
 	// Initialise a dummy gateway instance.
-	c := core.GetSingleInstance(&appSettings)
+	c, err := core.NewCore(&appSettings)
+	if err != nil {
+		logging.Error("Error creating gateway: %s", err.Error())
+		return
+	}
+	c.SettingsLoader = func() (*settings.AppSettings, error) {
+		appSettings, err := config.Reload(conf)
+		if err != nil {
+			return nil, err
+		}
+		return &appSettings, nil
+	}
+
+	// Reload the keys supplied by the admin before the last restart, if any.
+	if err := c.LoadKeys(); err != nil {
+		logging.Error("Error loading keys from the keystore: %s", err.Error())
+	}
 
 	// Initialise a register manager
 	c.RegisterMgr = fcrregistermgr.NewFCRRegisterMgr(appSettings.RegisterAPIURL, true, true, 10*time.Second)
 
-	// Create REST Server
-	c.RESTServer = fcrrestserver.NewFCRRESTServer(
-		[]string{appSettings.BindAdminAPI, appSettings.BindRestAPI})
-
-	// Add handlers to the REST Server
-	c.RESTServer.
-		// client api
-		AddHandler(appSettings.BindRestAPI, fcrmessages.ClientEstablishmentRequestType, clientapi.HandleClientEstablishmentRequest).
-		AddHandler(appSettings.BindRestAPI, fcrmessages.ClientDHTDiscoverRequestType, clientapi.HandleClientDHTCIDDiscoverRequest).
-		AddHandler(appSettings.BindRestAPI, fcrmessages.ClientDHTDiscoverOfferRequestType, clientapi.HandleClientDHTDiscoverOfferRequest).
-		AddHandler(appSettings.BindRestAPI, fcrmessages.ClientDHTDiscoverRequestV2Type, clientapi.HandleClientDHTCIDDiscoverRequestV2).
-		AddHandler(appSettings.BindRestAPI, fcrmessages.ClientStandardDiscoverOfferRequestType, clientapi.HandleClientStandardDiscoverOfferRequest).
-		AddHandler(appSettings.BindRestAPI, fcrmessages.ClientStandardDiscoverRequestType, clientapi.HandleClientStandardCIDDiscoverRequest).
-		AddHandler(appSettings.BindRestAPI, fcrmessages.ClientStandardDiscoverRequestV2Type, clientapi.HandleClientStandardCIDDiscoverRequestV2).
-		// admin api
-		AddHandler(appSettings.BindAdminAPI, fcrmessages.GatewayAdminInitialiseKeyRequestType, adminapi.HandleGatewayAdminInitialiseKeyRequest).
-		AddHandler(appSettings.BindAdminAPI, fcrmessages.GatewayAdminInitialiseKeyRequestV2Type, adminapi.HandleGatewayAdminInitialiseKeyRequestV2).
-		AddHandler(appSettings.BindAdminAPI, fcrmessages.GatewayAdminGetReputationRequestType, adminapi.HandleGatewayAdminGetReputationRequest).
-		AddHandler(appSettings.BindAdminAPI, fcrmessages.GatewayAdminSetReputationRequestType, adminapi.HandleGatewayAdminSetReputationRequest).
-		AddHandler(appSettings.BindAdminAPI, fcrmessages.GatewayAdminForceRefreshRequestType, adminapi.HandleGatewayAdminForceRefreshRequest).
-		AddHandler(appSettings.BindAdminAPI, fcrmessages.GatewayAdminListDHTOfferRequestType, adminapi.HandleGatewayAdminListDHTOffersRequest).
-		AddHandler(appSettings.BindAdminAPI, fcrmessages.GatewayAdminUpdateGatewayGroupCIDOfferSupportRequestType, adminapi.HandleGatewayAdminUpdateGatewayGroupCIDOfferSupportRequest)
-
-	// Start REST Server
-	err := c.RESTServer.Start()
-	if err != nil {
-		logging.Error("Error starting REST server: %s", err.Error())
+	// Create and start the REST and P2P servers
+	if err := api.StartServers(c); err != nil {
+		logging.Error("Error starting servers: %s", err.Error())
 		return
 	}
 
-	// Create P2P Server
-	c.P2PServer = fcrp2pserver.NewFCRP2PServer(
-		[]string{appSettings.BindGatewayAPI, appSettings.BindProviderAPI},
-		c.RegisterMgr,
-		appSettings.TCPInactivityTimeout)
-
-	// Add handlers and requesters to the P2P Server
-	c.P2PServer.
-		// gateway api
-		AddHandler(appSettings.BindGatewayAPI, fcrmessages.GatewayDHTDiscoverRequestType, gatewayapi.HandleGatewayDHTDiscoverRequest).
-		AddHandler(appSettings.BindGatewayAPI, fcrmessages.GatewayDHTDiscoverRequestV2Type, gatewayapi.HandleGatewayDHTDiscoverRequestV2).
-		AddHandler(appSettings.BindGatewayAPI, fcrmessages.GatewayDHTDiscoverOfferRequestType, gatewayapi.HandleGatewayDHTOfferRequest).
-		AddRequester(fcrmessages.GatewayDHTDiscoverRequestType, gatewayapi.RequestGatewayDHTDiscover).
-		AddRequester(fcrmessages.GatewayDHTDiscoverRequestV2Type, gatewayapi.RequestGatewayDHTDiscoverV2).
-		AddRequester(fcrmessages.GatewayListDHTOfferRequestType, gatewayapi.RequestListCIDOffer).
-		AddRequester(fcrmessages.GatewayNotifyProviderGroupCIDOfferSupportedRequestType, gatewayapi.NotifyProviderGroupCIDOfferSupported).
-		AddRequester(fcrmessages.GatewayDHTDiscoverOfferRequestType, gatewayapi.RequestGatewayDHTDiscoverOffer).
-		// provider api
-		AddHandler(appSettings.BindProviderAPI, fcrmessages.ProviderPublishGroupOfferRequestType, providerapi.HandleProviderPublishGroupOfferRequest).
-		AddHandler(appSettings.BindProviderAPI, fcrmessages.ProviderPublishDHTOfferRequestType, providerapi.HandleProviderPublishDHTOfferRequest)
-
-	// Start P2P Server
-	err = c.P2PServer.Start()
-	if err != nil {
-		logging.Error("Error starting P2P server: %s", err.Error())
-		return
+	// Start register manager's routine, and track whether the register service can be read
+	if err := c.StartRegister(); err != nil {
+		logging.Error("error starting Register Manager: %s", err.Error())
 	}
 
-  // Start register manager's routine
-  if err := c.RegisterMgr.Start(); err != nil {
-    logging.Error("error starting Register Manager: %s", err.Error())
-  }
+	// Restore the offers accepted before the last shutdown. The offers of providers not read from the register yet are
+	// restored by the following register refreshes.
+	c.RegisterMgr.Refresh()
+	if err := c.RestoreOffers(); err != nil {
+		logging.Error("Error restoring offers: %s", err.Error())
+	}
 
-	// Configure what should be called if Control-C is hit.
-	util.SetUpCtrlCExit(gracefulExit)
+	c.Lifecycle.SetStarted()
+	logging.Info("Filecoin Gateway Start-up Complete, gateway is %s", c.Lifecycle.State())
 
-	logging.Info("Filecoin Gateway Start-up Complete")
+	// Reload the settings on SIGHUP.
+	reloadOnHangup(c)
 
-	// Wait forever.
-	select {}
+	// Wait until Control-C or SIGTERM is received.
+	sig := util.WaitForExitSignal()
+	logging.Info("Received signal %s", sig.String())
+	os.Exit(gracefulExit(c))
 }
 
-// gracefulExit handles exit
-func gracefulExit() {
+// Exit codes returned by the gateway process.
+const (
+	exitCodeOK            = 0 // Clean shutdown
+	exitCodeDrainTimeout  = 1 // In-flight requests did not complete before the shutdown timeout
+	exitCodeFlushFailure  = 2 // State could not be persisted
+	exitCodeInvalidConfig = 3 // The configuration is invalid
+	exitCodeUsage         = 4 // The command line is invalid
+)
+
+// gracefulExit stops accepting new requests, drains in-flight requests and flushes the gateway state.
+// It returns the exit code of the process.
+func gracefulExit(c *core.Core) int {
 	logging.Info("Filecoin Gateway Shutdown: Start")
+	exitCode := exitCodeOK
+
+	// Stop accepting new requests on both the REST and the P2P servers, and wait for in-flight ones.
+	c.Lifecycle.SetDraining()
+	logging.Info("Draining in-flight requests, timeout %s", c.Settings().ShutdownTimeout)
+	drained := c.Drainer.Drain(c.Settings().ShutdownTimeout)
+	if !drained {
+		logging.Error("Shutdown timeout of %s exceeded with requests still in flight", c.Settings().ShutdownTimeout)
+		exitCode = exitCodeDrainTimeout
+	}
 
-	// TODO: Add shutdown process
-	logging.Error("graceful shutdown code not written yet!")
+	// Stop the refresh routines of the register manager. Shutdown leaves the register service untouched, unlike
+	// ShutdownAndWait, which removes the register entries.
+	logging.Info("Stopping register manager")
+	c.RegisterMgr.Shutdown()
+
+	// The stores are only flushed and closed once every handler has left, so that no handler writes to a closed
+	// store. Offers and reputation changes are persisted as they happen, so little is lost otherwise.
+	if !drained {
+		logging.Error("Gateway state not flushed: requests are still in flight")
+	} else if err := c.FlushState(); err != nil {
+		logging.Error("Error flushing gateway state: %s", err.Error())
+		exitCode = exitCodeFlushFailure
+	}
 
-	logging.Info("Filecoin Gateway Shutdown: Completed")
+	logging.Info("Filecoin Gateway Shutdown: Completed with exit code %d", exitCode)
+	return exitCode
 }
@@ -0,0 +1,40 @@
+package main
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+)
+
+// reloadOnHangup reloads the settings of the gateway every time SIGHUP is received.
+func reloadOnHangup(c *core.Core) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			logging.Info("Received signal %s, reloading settings", syscall.SIGHUP.String())
+			if _, err := c.ReloadSettings(); err != nil {
+				logging.Error("Settings not reloaded: %s", err.Error())
+			}
+		}
+	}()
+}
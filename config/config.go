@@ -6,102 +6,197 @@ package config
 import (
   "flag"
   "fmt"
+  "math"
   "math/big"
-  "time"
+  "path/filepath"
+  "strings"
 
   "github.com/spf13/pflag"
   "github.com/spf13/viper"
 
+  "github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
   "github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/offerstore"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
 )
 
-// NewConfig creates a new configuration
-func NewConfig() *viper.Viper {
+// Default amounts, in attoFIL.
+var (
+	defaultSearchPrice = big.NewInt(1_000_000_000_000_000)   // 0.001 FIL
+	defaultOfferPrice  = big.NewInt(1_000_000_000_000_000)   // 0.001 FIL
+	defaultTopupAmount = big.NewInt(100_000_000_000_000_000) // 0.1 FIL
+
+	defaultTopupThreshold = big.NewInt(10_000_000_000_000_000) // 0.01 FIL
+)
+
+// NewConfig creates a new configuration from the environment variables and the command line flags, on top of the
+// configuration file given by the --config flag or the CONFIG_FILE environment variable, if any. Configuration files
+// can be written in YAML or TOML, with the same keys as the environment variables.
+func NewConfig() (*viper.Viper, error) {
 	conf := viper.New()
 	conf.AutomaticEnv()
 	defineFlags(conf)
 	bindFlags(conf)
+	if err := readConfigFile(conf); err != nil {
+		return nil, err
+	}
 	setValues(conf)
-	return conf
+	return conf, nil
 }
 
 // Map sets the config for the Gateway. NB: Gateways start without a private key. Private keys are provided by a gateway admin client.
-func Map(conf *viper.Viper) settings.AppSettings {
-	registerRefreshDuration, err := time.ParseDuration(conf.GetString("REGISTER_REFRESH_DURATION"))
-	if err != nil {
-		registerRefreshDuration = settings.DefaultRegisterRefreshDuration
-	}
-	tcpInactivityTimeout, err := time.ParseDuration(conf.GetString("TCP_INACTIVITY_TIMEOUT"))
-	if err != nil {
-		tcpInactivityTimeout = settings.DefaultTCPInactivityTimeout
-	}
-	tcpLongInactivityTimeout, err := time.ParseDuration(conf.GetString("TCP_LONG_INACTIVITY_TIMEOUT"))
-	if err != nil {
-		tcpLongInactivityTimeout = settings.DefaultLongTCPInactivityTimeout
+// Values that are not set take their default. A ValidationError listing every malformed value is returned if the
+// configuration is invalid.
+func Map(conf *viper.Viper) (settings.AppSettings, error) {
+	p := &parser{conf: conf}
+
+	dataDir := p.str("DATA_DIR", settings.DefaultDataDir)
+	appSettings := settings.AppSettings{
+		BindRestAPI:     p.port("BIND_REST_API", true),
+		BindProviderAPI: p.port("BIND_PROVIDER_API", true),
+		BindGatewayAPI:  p.port("BIND_GATEWAY_API", true),
+		BindAdminAPI:    p.port("BIND_ADMIN_API", true),
+		BindMetricsAPI:  p.port("BIND_METRICS_API", false),
+		BindHealthAPI:   p.port("BIND_HEALTH_API", false),
+		LogLevel:        p.str("LOG_LEVEL", ""),
+		LogTarget:       p.str("LOG_TARGET", ""),
+		LogDir:          p.str("LOG_DIR", ""),
+		LogFile:         p.str("LOG_FILE", ""),
+		LogMaxBackups:   int(p.int64("LOG_MAX_BACKUPS", 0, 0)),
+		LogMaxAge:       int(p.int64("LOG_MAX_AGE", 0, 0)),
+		LogMaxSize:      int(p.int64("LOG_MAX_SIZE", 0, 0)),
+		LogCompress:     p.bool("LOG_COMPRESS"),
+		GatewayID:       p.str("GATEWAY_ID", ""),
+		DataDir:         dataDir,
+		OfferStore:      p.oneOf("OFFER_STORE", settings.DefaultOfferStore, offerstore.StoreTypeFile, offerstore.StoreTypeMemory),
+		ReputationDir:   p.str("REPUTATION_DIR", filepath.Join(dataDir, "reputation")),
+
+		KeystoreFile:           p.str("KEYSTORE_FILE", filepath.Join(dataDir, "keystore")),
+		KeystorePassphraseFile: p.str("KEYSTORE_PASSPHRASE_FILE", ""),
+
+		ReputationSnapshotInterval: p.duration("REPUTATION_SNAPSHOT_INTERVAL", settings.DefaultReputationSnapshotInterval, true),
+
+		RegisterAPIURL:          p.url("REGISTER_API_URL"),
+		RegisterRefreshDuration: p.duration("REGISTER_REFRESH_DURATION", settings.DefaultRegisterRefreshDuration, true),
+		RegisterSyncMaxAge:      p.duration("REGISTER_SYNC_MAX_AGE", settings.DefaultRegisterSyncMaxAge, true),
+
+		GatewayAddress:        p.str("GATEWAY_ADDRESS", ""),
+		GatewayRegionCode:     p.str("GATEWAY_REGION_CODE", ""),
+		GatewayRootSigningKey: p.str("GATEWAY_ROOT_SIGNING_KEY", ""),
+		GatewaySigningKey:     p.str("GATEWAY_SIGNING_KEY", ""),
+		AdminPublicKey:        p.str("ADMIN_PUBLIC_KEY", ""),
+		AdminRequestWindow:    p.duration("ADMIN_REQUEST_WINDOW", settings.DefaultAdminRequestWindow, true),
+		AdminLegacyRequests:   p.bool("ADMIN_LEGACY_REQUESTS"),
+		KeyActivationMinDelay: p.duration("KEY_ACTIVATION_MIN_DELAY", settings.DefaultKeyActivationMinDelay, false),
+		KeyGraceWindow:        p.duration("KEY_GRACE_WINDOW", settings.DefaultKeyGraceWindow, true),
+		NonceCacheSize:        int(p.int64("NONCE_CACHE_SIZE", settings.DefaultNonceCacheSize, 1)),
+		NonceWindow:           p.duration("NONCE_WINDOW", settings.DefaultNonceWindow, true),
+
+		TCPInactivityTimeout:     p.duration("TCP_INACTIVITY_TIMEOUT", settings.DefaultTCPInactivityTimeout, true),
+		TCPLongInactivityTimeout: p.duration("TCP_LONG_INACTIVITY_TIMEOUT", settings.DefaultLongTCPInactivityTimeout, true),
+		ShutdownTimeout:          p.duration("SHUTDOWN_TIMEOUT", settings.DefaultShutdownTimeout, false),
+
+		ClientRefuseReputation:   p.int64("CLIENT_REFUSE_REPUTATION", settings.DefaultClientRefuseReputation, math.MinInt64),
+		ClientThrottleReputation: p.int64("CLIENT_THROTTLE_REPUTATION", settings.DefaultClientThrottleReputation, math.MinInt64),
+		ClientThrottleInterval:   p.duration("CLIENT_THROTTLE_INTERVAL", settings.DefaultClientThrottleInterval, false),
+		ClientPrepayReputation:   p.int64("CLIENT_PREPAY_REPUTATION", settings.DefaultClientPrepayReputation, math.MinInt64),
+
+		GatewaySkipReputation:         p.int64("GATEWAY_SKIP_REPUTATION", settings.DefaultGatewaySkipReputation, math.MinInt64),
+		GatewayDeprioritiseReputation: p.int64("GATEWAY_DEPRIORITISE_REPUTATION", settings.DefaultGatewayDeprioritiseReputation, math.MinInt64),
+		DHTFanOutWorkers:              int(p.int64("DHT_FANOUT_WORKERS", settings.DefaultDHTFanOutWorkers, 1)),
+
+		SearchPrice: p.amount("SEARCH_PRICE", defaultSearchPrice),
+		OfferPrice:  p.amount("OFFER_PRICE", defaultOfferPrice),
+		TopupAmount: p.amount("TOPUP_AMOUNT", defaultTopupAmount),
+
+		TopupThreshold: p.amount("TOPUP_THRESHOLD", defaultTopupThreshold),
+
+		PriceCIDRanges:           p.cidRanges("PRICE_CID_RANGES"),
+		PriceReputationDiscounts: p.discounts("PRICE_REPUTATION_DISCOUNTS"),
+		PriceSurgeThreshold:      p.int64("PRICE_SURGE_THRESHOLD", 0, 0),
+		PriceSurgePercent:        p.int64("PRICE_SURGE_PERCENT", settings.DefaultPriceSurgePercent, 1),
+		PriceQuoteTTL:            p.duration("PRICE_QUOTE_TTL", settings.DefaultPriceQuoteTTL, true),
+		PriceQuoteLimit:          int(p.int64("PRICE_QUOTE_LIMIT", settings.DefaultPriceQuoteLimit, 1)),
+		PriceQuoteClientLimit:    int(p.int64("PRICE_QUOTE_CLIENT_LIMIT", settings.DefaultPriceQuoteClientLimit, 1)),
+
+		PaymentManager:                p.oneOf("PAYMENT_MANAGER", settings.DefaultPaymentManager, payment.ManagerTypeLotus, payment.ManagerTypeMemory),
+		PaymentRequestTTL:             p.duration("PAYMENT_REQUEST_TTL", settings.DefaultPaymentRequestTTL, true),
+		PaymentRequestLimit:           int(p.int64("PAYMENT_REQUEST_LIMIT", settings.DefaultPaymentRequestLimit, 1)),
+		PaymentRequestPayerLimit:      int(p.int64("PAYMENT_REQUEST_PAYER_LIMIT", settings.DefaultPaymentRequestPayerLimit, 1)),
+		PaymentChannelRefreshInterval: p.duration("PAYMENT_CHANNEL_REFRESH_INTERVAL", settings.DefaultPaymentChannelRefreshInterval, true),
 	}
 
-	defaultSearchPrice := new(big.Int)
-	_, err = fmt.Sscan(conf.GetString("SEARCH_PRICE"), defaultSearchPrice)
-	if err != nil {
-		// defaultSearchPrice is the default search price "0.001".
-		defaultSearchPrice = big.NewInt(1_000_000_000_000_000)
+	ip := p.str("IP", "")
+	appSettings.NetworkInfoGateway = ip + ":" + appSettings.BindGatewayAPI
+	appSettings.NetworkInfoClient = ip + ":" + appSettings.BindRestAPI
+	appSettings.NetworkInfoProvider = ip + ":" + appSettings.BindProviderAPI
+	appSettings.NetworkInfoAdmin = ip + ":" + appSettings.BindAdminAPI
+
+	// Every server needs its own port.
+	bound := make(map[string]string)
+	for _, bind := range []struct{ key, port string }{
+		{"BIND_REST_API", appSettings.BindRestAPI},
+		{"BIND_PROVIDER_API", appSettings.BindProviderAPI},
+		{"BIND_GATEWAY_API", appSettings.BindGatewayAPI},
+		{"BIND_ADMIN_API", appSettings.BindAdminAPI},
+		{"BIND_METRICS_API", appSettings.BindMetricsAPI},
+		{"BIND_HEALTH_API", appSettings.BindHealthAPI},
+	} {
+		if bind.port == "" {
+			continue
+		}
+		if other, ok := bound[bind.port]; ok {
+			p.fail(bind.key, "port %s is already used by %s", bind.port, other)
+			continue
+		}
+		bound[bind.port] = bind.key
 	}
 
-	defaultOfferPrice := new(big.Int)
-	_, err = fmt.Sscan(conf.GetString("OFFER_PRICE"), defaultOfferPrice)
-	if err != nil {
-		// defaultOfferPrice is the default offer price "0.001".
-		defaultOfferPrice = big.NewInt(1_000_000_000_000_000)
+	if appSettings.AdminPublicKey != "" {
+		if _, err := fcrcrypto.DecodePublicKey(appSettings.AdminPublicKey); err != nil {
+			p.fail("ADMIN_PUBLIC_KEY", "not a public key: %s", err.Error())
+		}
 	}
 
-	defaultTopUpAmount := new(big.Int)
-	_, err = fmt.Sscan(conf.GetString("TOPUP_AMOUNT"), defaultTopUpAmount)
-	if err != nil {
-		// defaultTopUpAmount is the default top up amount "0.1".
-		defaultTopUpAmount = big.NewInt(100_000_000_000_000_000)
+	return appSettings, p.err()
+}
+
+// Reload reads the configuration file again and maps the configuration, as Map does. The environment variables and
+// the command line flags of the process cannot change, so only the configuration file can bring new values.
+func Reload(conf *viper.Viper) (settings.AppSettings, error) {
+	if err := readConfigFile(conf); err != nil {
+		return settings.AppSettings{}, err
 	}
+	return Map(conf)
+}
 
-	return settings.AppSettings{
-		BindRestAPI:     conf.GetString("BIND_REST_API"),
-		BindProviderAPI: conf.GetString("BIND_PROVIDER_API"),
-		BindGatewayAPI:  conf.GetString("BIND_GATEWAY_API"),
-		BindAdminAPI:    conf.GetString("BIND_ADMIN_API"),
-		LogLevel:        conf.GetString("LOG_LEVEL"),
-		LogTarget:       conf.GetString("LOG_TARGET"),
-		LogDir:          conf.GetString("LOG_DIR"),
-		LogFile:         conf.GetString("LOG_FILE"),
-		LogMaxBackups:   conf.GetInt("LOG_MAX_BACKUPS"),
-		LogMaxAge:       conf.GetInt("LOG_MAX_AGE"),
-		LogMaxSize:      conf.GetInt("LOG_MAX_SIZE"),
-		LogCompress:     conf.GetBool("LOG_COMPRESS"),
-		GatewayID:       conf.GetString("GATEWAY_ID"),
-
-		RegisterAPIURL:          conf.GetString("REGISTER_API_URL"),
-		RegisterRefreshDuration: registerRefreshDuration,
-
-		GatewayAddress:        conf.GetString("GATEWAY_ADDRESS"),
-		NetworkInfoGateway:    conf.GetString("IP") + ":" + conf.GetString("BIND_GATEWAY_API"),
-		GatewayRegionCode:     conf.GetString("GATEWAY_REGION_CODE"),
-		GatewayRootSigningKey: conf.GetString("GATEWAY_ROOT_SIGNING_KEY"),
-		GatewaySigningKey:     conf.GetString("GATEWAY_SIGNING_KEY"),
-
-		NetworkInfoClient:   conf.GetString("IP") + ":" + conf.GetString("BIND_REST_API"),
-		NetworkInfoProvider: conf.GetString("IP") + ":" + conf.GetString("BIND_PROVIDER_API"),
-		NetworkInfoAdmin:    conf.GetString("IP") + ":" + conf.GetString("BIND_ADMIN_API"),
-
-		TCPInactivityTimeout:     tcpInactivityTimeout,
-		TCPLongInactivityTimeout: tcpLongInactivityTimeout,
-
-		SearchPrice: defaultSearchPrice,
-		OfferPrice:  defaultOfferPrice,
-		TopupAmount: defaultTopUpAmount,
+// readConfigFile reads the configuration file given by the --config flag or the CONFIG_FILE environment variable,
+// if any. Its format is given by its extension.
+func readConfigFile(conf *viper.Viper) error {
+	file := conf.GetString("config")
+	if file == "" {
+		file = conf.GetString("CONFIG_FILE")
+	}
+	if file == "" {
+		return nil
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".toml":
+	default:
+		return fmt.Errorf("configuration file %s is neither a YAML nor a TOML file", file)
+	}
+	conf.SetConfigFile(file)
+	if err := conf.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading configuration file %s: %s", file, err.Error())
 	}
+	return nil
 }
 
 func defineFlags(conf *viper.Viper) {
 	flag.String("host", "0.0.0.0", "help message for host")
 	flag.String("ip", "127.0.0.1", "help message for ip")
+	flag.String("config", "", "YAML or TOML configuration file, overridden by the environment variables")
 }
 
 func bindFlags(conf *viper.Viper) {
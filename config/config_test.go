@@ -0,0 +1,180 @@
+package config
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+// validConfig returns a configuration with the settings that must be set.
+func validConfig() *viper.Viper {
+	conf := viper.New()
+	conf.Set("BIND_REST_API", "9010")
+	conf.Set("BIND_PROVIDER_API", "9011")
+	conf.Set("BIND_GATEWAY_API", "9012")
+	conf.Set("BIND_ADMIN_API", "9013")
+	conf.Set("REGISTER_API_URL", "http://register:9020")
+	return conf
+}
+
+func TestMapDefaults(t *testing.T) {
+	appSettings, err := Map(validConfig())
+	require.NoError(t, err)
+	assert.Equal(t, settings.DefaultNonceWindow, appSettings.NonceWindow)
+	assert.Equal(t, settings.DefaultDHTFanOutWorkers, appSettings.DHTFanOutWorkers)
+	assert.Equal(t, 0, defaultSearchPrice.Cmp(appSettings.SearchPrice))
+	assert.Equal(t, 0, defaultTopupThreshold.Cmp(appSettings.TopupThreshold))
+	assert.Equal(t, filepath.Join(settings.DefaultDataDir, "keystore"), appSettings.KeystoreFile)
+}
+
+func TestMapReportsEveryProblem(t *testing.T) {
+	conf := validConfig()
+	conf.Set("BIND_GATEWAY_API", "70000")
+	conf.Set("BIND_METRICS_API", "9010")
+	conf.Set("REGISTER_API_URL", "")
+	conf.Set("SEARCH_PRICE", "0.001 dollars")
+	conf.Set("OFFER_PRICE", "-1")
+	conf.Set("TOPUP_AMOUNT", "0 FIL")
+	conf.Set("NONCE_WINDOW", "10 minutes")
+	conf.Set("DHT_FANOUT_WORKERS", "0")
+	conf.Set("PAYMENT_MANAGER", "bank")
+	conf.Set("PRICE_CID_RANGES", "00-7f:150, 80-zz:200, f0-10:100")
+	conf.Set("PRICE_REPUTATION_DISCOUNTS", "0:10,100:110")
+	conf.Set("ADMIN_LEGACY_REQUESTS", "maybe")
+
+	_, err := Map(conf)
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.ElementsMatch(t, []string{
+		`BIND_GATEWAY_API: "70000" is not a port number`,
+		`REGISTER_API_URL: must be set`,
+		`NONCE_WINDOW: "10 minutes" is not a duration`,
+		`DHT_FANOUT_WORKERS: 0 is below the minimum of 1`,
+		`SEARCH_PRICE: "dollars" is not a denomination of FIL`,
+		`OFFER_PRICE: -0.000000000000000001 FIL must be positive`,
+		`TOPUP_AMOUNT: 0 FIL must be positive`,
+		`PAYMENT_MANAGER: "bank" is not one of lotus, memory`,
+		`BIND_METRICS_API: port 9010 is already used by BIND_REST_API`,
+		`PRICE_CID_RANGES: "80-zz:200" does not start and end with the hex prefix of a CID`,
+		`PRICE_CID_RANGES: "f0-10:100" ends before it starts`,
+		`PRICE_REPUTATION_DISCOUNTS: "100:110" has a percentage outside of 0 to 100`,
+		`ADMIN_LEGACY_REQUESTS: "maybe" is not a boolean`,
+	}, validationErr.Problems)
+}
+
+func TestMapPricing(t *testing.T) {
+	conf := validConfig()
+	conf.Set("PRICE_CID_RANGES", "00-7F:150, 8-8:200")
+	conf.Set("PRICE_REPUTATION_DISCOUNTS", "0:10, 500:25")
+	appSettings, err := Map(conf)
+	require.NoError(t, err)
+	assert.Equal(t, settings.CIDRangePrices{{First: "00", Last: "7f", Percent: 150}, {First: "8", Last: "8", Percent: 200}}, appSettings.PriceCIDRanges)
+	assert.Equal(t, "00-7f:150,8-8:200", appSettings.PriceCIDRanges.String())
+	assert.Equal(t, "0:10,500:25", appSettings.PriceReputationDiscounts.String())
+	assert.Equal(t, settings.DefaultPriceSurgePercent, appSettings.PriceSurgePercent)
+	assert.Equal(t, settings.DefaultPriceQuoteTTL, appSettings.PriceQuoteTTL)
+	assert.Equal(t, int(settings.DefaultPriceQuoteLimit), appSettings.PriceQuoteLimit)
+	assert.Equal(t, int(settings.DefaultPriceQuoteClientLimit), appSettings.PriceQuoteClientLimit)
+	assert.Equal(t, int(settings.DefaultPaymentRequestLimit), appSettings.PaymentRequestLimit)
+	assert.Equal(t, int(settings.DefaultPaymentRequestPayerLimit), appSettings.PaymentRequestPayerLimit)
+}
+
+func TestConfigFileWithEnvOverride(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gateway.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+bind_rest_api: 9010
+bind_provider_api: 9011
+bind_gateway_api: 9012
+bind_admin_api: 9013
+register_api_url: http://register:9020
+search_price: 2 nanoFIL
+nonce_window: 1m
+`), 0600))
+	require.NoError(t, os.Setenv("NONCE_WINDOW", "2m"))
+	defer os.Unsetenv("NONCE_WINDOW")
+
+	conf := viper.New()
+	conf.AutomaticEnv()
+	conf.Set("config", file)
+	require.NoError(t, readConfigFile(conf))
+	appSettings, err := Map(conf)
+	require.NoError(t, err)
+	assert.Equal(t, "9012", appSettings.BindGatewayAPI)
+	assert.Equal(t, "2000000000", appSettings.SearchPrice.String())
+	assert.Equal(t, 2*time.Minute, appSettings.NonceWindow)
+
+	conf.Set("config", filepath.Join(t.TempDir(), "gateway.json"))
+	assert.Error(t, readConfigFile(conf))
+}
+
+func TestReloadReadsConfigFileAgain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gateway.toml")
+	write := func(searchPrice string) {
+		require.NoError(t, ioutil.WriteFile(file, []byte(`
+bind_rest_api = 9010
+bind_provider_api = 9011
+bind_gateway_api = 9012
+bind_admin_api = 9013
+register_api_url = "http://register:9020"
+search_price = "`+searchPrice+`"
+`), 0600))
+	}
+	write("1 nanoFIL")
+
+	conf := viper.New()
+	conf.Set("config", file)
+	require.NoError(t, readConfigFile(conf))
+	appSettings, err := Map(conf)
+	require.NoError(t, err)
+	assert.Equal(t, "1000000000", appSettings.SearchPrice.String())
+
+	write("3 nanoFIL")
+	appSettings, err = Reload(conf)
+	require.NoError(t, err)
+	assert.Equal(t, "3000000000", appSettings.SearchPrice.String())
+
+	write("free")
+	_, err = Reload(conf)
+	assert.Error(t, err)
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	conf := validConfig()
+	conf.Set("GATEWAY_SIGNING_KEY", "private")
+	conf.Set("GATEWAY_ROOT_SIGNING_KEY", "root private")
+	appSettings, err := Map(conf)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, Print(&out, &appSettings))
+	assert.Contains(t, out.String(), "BIND_REST_API=9010\n")
+	assert.Contains(t, out.String(), "NONCE_WINDOW=10m0s\n")
+	assert.Contains(t, out.String(), "GATEWAY_SIGNING_KEY=<redacted>\n")
+	assert.Contains(t, out.String(), "GATEWAY_ROOT_SIGNING_KEY=<redacted>\n")
+	assert.NotContains(t, out.String(), "private")
+}
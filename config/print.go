@@ -0,0 +1,60 @@
+package config
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+// redacted replaces the value of secret settings when the configuration is printed.
+const redacted = "<redacted>"
+
+// Print writes the settings to w, one KEY=value line per setting in the format of the environment variables. The
+// value of the settings tagged secret is redacted.
+func Print(w io.Writer, appSettings *settings.AppSettings) error {
+	value := reflect.ValueOf(appSettings).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		var formatted string
+		switch v := value.Field(i).Interface().(type) {
+		case time.Duration:
+			formatted = v.String()
+		case *big.Int:
+			if v != nil {
+				formatted = v.String()
+			}
+		default:
+			formatted = fmt.Sprint(v)
+		}
+		if field.Tag.Get("secret") == "true" && formatted != "" {
+			formatted = redacted
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", key, formatted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package config
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+// cidHexLength is the length of a CID written in hex, the longest prefix of a CID range.
+const cidHexLength = 64
+
+// ValidationError lists every malformed value of a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+// Error returns the error message.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// parser reads the values of a configuration, recording a problem for every malformed value instead of stopping at
+// the first one. Values that are not set take their default.
+type parser struct {
+	conf     *viper.Viper
+	problems []string
+}
+
+// err returns a ValidationError listing the problems found, or nil if there is none.
+func (p *parser) err() error {
+	if len(p.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p.problems}
+}
+
+// fail records a problem with the value of a key.
+func (p *parser) fail(key string, format string, args ...interface{}) {
+	p.problems = append(p.problems, fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+// str returns the value of a key, or the given default if the key is not set.
+func (p *parser) str(key string, defaultValue string) string {
+	value := strings.TrimSpace(p.conf.GetString(key))
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// required returns the value of a key, and records a problem if the key is not set.
+func (p *parser) required(key string) string {
+	value := p.str(key, "")
+	if value == "" {
+		p.fail(key, "must be set")
+	}
+	return value
+}
+
+// port returns the port number held by a key. It records a problem if the value is not a port number, or if it is
+// not set and the port is required.
+func (p *parser) port(key string, required bool) string {
+	value := p.str(key, "")
+	if value == "" {
+		if required {
+			p.fail(key, "must be set")
+		}
+		return ""
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		p.fail(key, "%q is not a port number", value)
+	}
+	return value
+}
+
+// url returns the http or https URL held by a key, and records a problem if the key is not set or not such a URL.
+func (p *parser) url(key string) string {
+	value := p.required(key)
+	if value == "" {
+		return ""
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		p.fail(key, "%q is not an http or https URL", value)
+	}
+	return value
+}
+
+// oneOf returns the value of a key, or the given default if the key is not set, and records a problem if the value
+// is not one of the allowed values.
+func (p *parser) oneOf(key string, defaultValue string, allowed ...string) string {
+	value := p.str(key, defaultValue)
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	p.fail(key, "%q is not one of %s", value, strings.Join(allowed, ", "))
+	return value
+}
+
+// duration returns the duration held by a key, or the given default if the key is not set. It records a problem if
+// the value is not a duration, is negative, or is zero and the duration must be positive.
+func (p *parser) duration(key string, defaultValue time.Duration, positive bool) time.Duration {
+	value := p.str(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	switch {
+	case err != nil:
+		p.fail(key, "%q is not a duration", value)
+	case d < 0:
+		p.fail(key, "%s is negative", d)
+	case positive && d == 0:
+		p.fail(key, "must be positive")
+	default:
+		return d
+	}
+	return defaultValue
+}
+
+// int64 returns the integer held by a key, or the given default if the key is not set. It records a problem if the
+// value is not an integer or is below min.
+func (p *parser) int64(key string, defaultValue int64, min int64) int64 {
+	value := p.str(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		p.fail(key, "%q is not an integer", value)
+		return defaultValue
+	}
+	if i < min {
+		p.fail(key, "%d is below the minimum of %d", i, min)
+		return defaultValue
+	}
+	return i
+}
+
+// bool returns the boolean held by a key, or false if the key is not set, and records a problem if the value is not
+// a boolean.
+func (p *parser) bool(key string) bool {
+	value := p.str(key, "")
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		p.fail(key, "%q is not a boolean", value)
+	}
+	return b
+}
+
+// amount returns the amount held by a key in attoFIL, or the given default if the key is not set. Amounts are
+// written with a denomination of FIL, such as "0.001 FIL" or "1 nanoFIL", or in attoFIL without a denomination. It
+// records a problem if the value is not an amount, or is not positive.
+func (p *parser) amount(key string, defaultValue *big.Int) *big.Int {
+	value := p.str(key, "")
+	if value == "" {
+		return new(big.Int).Set(defaultValue)
+	}
+	amount, err := payment.ParseAmount(value)
+	switch {
+	case err != nil:
+		p.fail(key, "%s", err.Error())
+	case amount.Sign() <= 0:
+		p.fail(key, "%s must be positive", payment.FormatFIL(amount))
+	default:
+		return amount
+	}
+	return new(big.Int).Set(defaultValue)
+}
+
+// cidRanges returns the CID range prices held by a key, written "first-last:percent" and comma separated, where first
+// and last are the hex prefixes of the first and last CID of a range. It records a problem for every malformed range.
+func (p *parser) cidRanges(key string) settings.CIDRangePrices {
+	value := p.str(key, "")
+	ranges := make(settings.CIDRangePrices, 0)
+	if value == "" {
+		return ranges
+	}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		bounds, percent, found := cut(item, ":")
+		first, last, isRange := cut(bounds, "-")
+		if !found || !isRange {
+			p.fail(key, "%q is not a CID range price, written first-last:percent", item)
+			continue
+		}
+		first, last = strings.ToLower(strings.TrimSpace(first)), strings.ToLower(strings.TrimSpace(last))
+		if !isCIDPrefix(first) || !isCIDPrefix(last) {
+			p.fail(key, "%q does not start and end with the hex prefix of a CID", item)
+			continue
+		}
+		if padCIDPrefix(first, "0") > padCIDPrefix(last, "f") {
+			p.fail(key, "%q ends before it starts", item)
+			continue
+		}
+		pct, err := strconv.ParseInt(strings.TrimSpace(percent), 10, 64)
+		if err != nil || pct < 1 {
+			p.fail(key, "%q does not have a positive percentage", item)
+			continue
+		}
+		ranges = append(ranges, settings.CIDRangePrice{First: first, Last: last, Percent: pct})
+	}
+	return ranges
+}
+
+// discounts returns the reputation discounts held by a key, written "reputation:percent" and comma separated. It
+// records a problem for every malformed discount, and for reputations given more than one discount.
+func (p *parser) discounts(key string) settings.ReputationDiscounts {
+	value := p.str(key, "")
+	discounts := make(settings.ReputationDiscounts, 0)
+	if value == "" {
+		return discounts
+	}
+	seen := make(map[int64]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		reputation, percent, found := cut(item, ":")
+		rep, repErr := strconv.ParseInt(strings.TrimSpace(reputation), 10, 64)
+		pct, pctErr := strconv.ParseInt(strings.TrimSpace(percent), 10, 64)
+		switch {
+		case !found || repErr != nil || pctErr != nil:
+			p.fail(key, "%q is not a reputation discount, written reputation:percent", item)
+		case pct < 0 || pct > 100:
+			p.fail(key, "%q has a percentage outside of 0 to 100", item)
+		case seen[rep]:
+			p.fail(key, "reputation %d has more than one discount", rep)
+		default:
+			seen[rep] = true
+			discounts = append(discounts, settings.ReputationDiscount{MinReputation: rep, Percent: pct})
+		}
+	}
+	return discounts
+}
+
+// cut slices s around the first instance of sep, returning the text before and after sep, and whether sep was found.
+func cut(s string, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// isCIDPrefix returns true if s is the hex prefix of a CID.
+func isCIDPrefix(s string) bool {
+	if s == "" || len(s) > cidHexLength {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// padCIDPrefix pads the hex prefix of a CID to the length of a CID with the given digit.
+func padCIDPrefix(prefix string, digit string) string {
+	return prefix + strings.Repeat(digit, cidHexLength-len(prefix))
+}
@@ -5,8 +5,13 @@ go 1.16
 require (
 	github.com/ConsenSys/fc-retrieval-common v0.0.0-20210629151030-12ab560d14bb
 	github.com/ant0ine/go-json-rest v3.3.2+incompatible
+	github.com/filecoin-project/go-address v0.0.5
+	github.com/filecoin-project/go-jsonrpc v0.1.4-0.20210217175800-45ea43ac2bec
+	github.com/filecoin-project/lotus v1.8.0
 	github.com/joho/godotenv v1.3.0
+	github.com/prometheus/client_golang v1.6.0
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
 )
@@ -0,0 +1,89 @@
+package api
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+// WrapAdminHandler wraps an admin REST handler so that only requests signed with the admin key are served.
+// Each request must carry a timestamp within the accepted window and a nonce that has not been used within
+// that window, added with messages.AddAdminAuthentication, unless ADMIN_LEGACY_REQUESTS accepts the requests of the
+// admin tooling that can not add them yet. The handler is bound to the gateway, tracked as in-flight work and refused while the gateway has not
+// reached the required state, as with WrapRESTHandler.
+func WrapAdminHandler(c *core.Core, required core.State, handler GatewayRESTHandler) RESTHandler {
+	return WrapRESTHandler(c, required, func(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+		if !authenticateAdminRequest(w, c, request) {
+			return
+		}
+		handler(c, w, request)
+	})
+}
+
+// authenticateAdminRequest returns false if the request has been rejected, in which case the response has already
+// been written.
+func authenticateAdminRequest(w rest.ResponseWriter, c *core.Core, request *fcrmessages.FCRMessage) bool {
+	if c.AdminPublicKey == nil {
+		s := "Admin API is disabled: no admin public key is configured."
+		logging.Warn("Rejecting admin request of type %d: %s", request.GetMessageType(), s)
+		apierror.WriteREST(c, w, http.StatusForbidden, messages.ErrorRefused, s)
+		return false
+	}
+	if request.Verify(c.AdminPublicKey) != nil {
+		s := "Admin request rejected: signature verification failed."
+		logging.Warn("Rejecting admin request of type %d: %s", request.GetMessageType(), s)
+		apierror.WriteREST(c, w, http.StatusUnauthorized, messages.ErrorBadSignature, s)
+		return false
+	}
+
+	nonce, timestamp, found, err := messages.DecodeAdminAuthentication(request)
+	if err == nil && !found && c.Settings().AdminLegacyRequests {
+		logging.Warn("Accepting admin request of type %d without nonce or timestamp, it can be replayed", request.GetMessageType())
+		return true
+	}
+	if err != nil || !found {
+		s := "Admin request rejected: missing nonce or timestamp."
+		logging.Warn("Rejecting admin request of type %d: %s", request.GetMessageType(), s)
+		apierror.WriteREST(c, w, http.StatusUnauthorized, messages.ErrorInvalidMessage, s)
+		return false
+	}
+	now := time.Now()
+	if timestamp.Before(now.Add(-c.Settings().AdminRequestWindow)) || timestamp.After(now.Add(c.Settings().AdminRequestWindow)) {
+		s := "Admin request rejected: timestamp is outside the accepted window."
+		logging.Warn("Rejecting admin request of type %d: %s", request.GetMessageType(), s)
+		apierror.WriteREST(c, w, http.StatusUnauthorized, messages.ErrorExpired, s)
+		return false
+	}
+	// The nonce is remembered until the timestamp leaves the window, after which the request is rejected anyway.
+	if err := c.AdminReplayGuard.Check(strconv.FormatInt(nonce, 10), timestamp.Add(c.Settings().AdminRequestWindow)); err != nil {
+		s := "Admin request rejected: " + err.Error() + "."
+		logging.Warn("Rejecting admin request of type %d: %s", request.GetMessageType(), s)
+		apierror.WriteREST(c, w, http.StatusUnauthorized, apierror.NonceCode(err), s)
+		return false
+	}
+	return true
+}
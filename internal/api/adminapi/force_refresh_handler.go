@@ -28,18 +28,17 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // HandleGatewayAdminForceRefreshRequest handles admin force refresh request
-func HandleGatewayAdminForceRefreshRequest(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
-
-	if c.GatewayPrivateKey == nil {
+func HandleGatewayAdminForceRefreshRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	if !c.SigningKeys.HasKey() {
 		s := "This gateway hasn't been initialised by the admin"
 		logging.Error(s)
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorNotInitialised, s)
 		return
 	}
 
@@ -47,13 +46,14 @@ func HandleGatewayAdminForceRefreshRequest(w rest.ResponseWriter, request *fcrme
 	if err != nil {
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
 	refreshed := false
 	if refresh {
 		c.RegisterMgr.Refresh()
+		c.RefreshRegister()
 		refreshed = true
 	}
 
@@ -62,15 +62,15 @@ func HandleGatewayAdminForceRefreshRequest(w rest.ResponseWriter, request *fcrme
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 	if err := w.WriteJson(response); err != nil {
@@ -22,41 +22,44 @@ import (
 
   "github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
   "github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // HandleGatewayAdminInitialiseKeyRequest handles admin initilise key request
-func HandleGatewayAdminInitialiseKeyRequest(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get the core structure
-	c := core.GetSingleInstance()
-
+func HandleGatewayAdminInitialiseKeyRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
 	nodeID, privKey, privKeyVer, err := fcrmessages.DecodeGatewayAdminInitialiseKeyRequest(request)
 	if err != nil {
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
-	c.GatewayID = nodeID
-	c.GatewayPrivateKey = privKey
-	c.GatewayPrivateKeyVersion = privKeyVer
+	c.InitialiseKey(nodeID, privKey, privKeyVer)
+	if err = c.SaveKeys(); err != nil {
+		s := "Internal error: Fail to store keys."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+		return
+	}
 
 	// Construct message
 	response, err := fcrmessages.EncodeGatewayAdminInitialiseKeyResponse(true)
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 	// Send message
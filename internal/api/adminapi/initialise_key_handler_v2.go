@@ -21,32 +21,34 @@ import (
   "github.com/ant0ine/go-json-rest/rest"
 
   "github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
-  "github.com/ConsenSys/fc-retrieval-common/pkg/fcrpaymentmgr"
   "github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // HandleGatewayAdminInitialiseKeyRequestV2 handles admin initilise key request with initialized payment manager
-func HandleGatewayAdminInitialiseKeyRequestV2(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get the core structure
-	c := core.GetSingleInstance()
-
+func HandleGatewayAdminInitialiseKeyRequestV2(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
 	nodeID, privKey, privKeyVer, walletPrivKey, lotusAP, lotusAuth, err := fcrmessages.DecodeGatewayAdminInitialiseKeyRequestV2(request)
 	if err != nil {
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
-	c.GatewayID = nodeID
-	c.GatewayPrivateKey = privKey
-	c.GatewayPrivateKeyVersion = privKeyVer
-	c.PaymentMgr, err = fcrpaymentmgr.NewFCRPaymentMgr(walletPrivKey, lotusAP, lotusAuth)
+	c.InitialiseKey(nodeID, privKey, privKeyVer)
+	err = c.InitialisePayment(walletPrivKey, lotusAP, lotusAuth)
 	if err != nil {
 		s := "Fail to initialize payment manager."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
+		return
+	}
+	if err = c.SaveKeys(); err != nil {
+		s := "Internal error: Fail to store keys."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
@@ -55,16 +57,16 @@ func HandleGatewayAdminInitialiseKeyRequestV2(w rest.ResponseWriter, request *fc
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 	// Send message
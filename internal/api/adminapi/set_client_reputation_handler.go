@@ -22,18 +22,17 @@ import (
 
   "github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
   "github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // HandleGatewayAdminSetReputationRequest handles admin set reputation request
-func HandleGatewayAdminSetReputationRequest(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
-
-	if c.GatewayPrivateKey == nil {
+func HandleGatewayAdminSetReputationRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	if !c.SigningKeys.HasKey() {
 		s := "This gateway hasn't been initialised by the admin"
 		logging.Error(s)
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorNotInitialised, s)
 		return
 	}
 
@@ -41,7 +40,7 @@ func HandleGatewayAdminSetReputationRequest(w rest.ResponseWriter, request *fcrm
 	if err != nil {
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
@@ -59,15 +58,15 @@ func HandleGatewayAdminSetReputationRequest(w rest.ResponseWriter, request *fcrm
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
   if err := w.WriteJson(response); err != nil {
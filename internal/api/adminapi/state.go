@@ -0,0 +1,27 @@
+package adminapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+)
+
+// RequiredState is the state the gateway must be in to serve admin requests.
+const RequiredState = core.StateKeyed
+
+// InitialiseRequiredState is the state the gateway must be in to serve admin requests initialising its key. Keys can
+// be initialised again at any time before shutdown.
+const InitialiseRequiredState = core.StateUninitialised
@@ -0,0 +1,73 @@
+package adminapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+// HandleGatewayAdminWipeKeysRequest handles admin wipe keys request. The keys are removed from the keystore, the
+// gateway keeps using them until it stops.
+func HandleGatewayAdminWipeKeysRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	wipe, err := messages.DecodeGatewayAdminWipeKeysRequest(request)
+	if err != nil {
+		s := "Fail to decode message."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
+		return
+	}
+
+	wiped := false
+	if wipe {
+		if err = c.WipeKeys(); err != nil {
+			s := "Internal error: Fail to wipe keys."
+			logging.Error(s + err.Error())
+			apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+			return
+		}
+		logging.Info("Keys wiped from the keystore by the admin")
+		wiped = true
+	}
+
+	// Construct message
+	response, err := messages.EncodeGatewayAdminWipeKeysResponse(wiped)
+	if err != nil {
+		s := "Internal error: Fail to encode message."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+		return
+	}
+	// Sign message
+	err = response.Sign(c.SigningKey())
+	if err != nil {
+		s := "Internal error: Fail to sign message."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+		return
+	}
+	if err := w.WriteJson(response); err != nil {
+		logging.Error("can't write JSON during HandleGatewayAdminWipeKeysRequest %s", err.Error())
+	}
+}
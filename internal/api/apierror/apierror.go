@@ -0,0 +1,83 @@
+package apierror
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/metrics"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+// WriteREST writes an error response to a REST request, with the given HTTP status.
+func WriteREST(c *core.Core, w rest.ResponseWriter, status int, code messages.ErrorCode, detail string) {
+	response, err := errorResponse(c, code, detail)
+	if err != nil {
+		logging.Error("Internal error: Fail to encode error response: %s", err.Error())
+		rest.Error(w, detail, status)
+		return
+	}
+	w.WriteHeader(status)
+	if err := w.WriteJson(response); err != nil {
+		logging.Error("can't write JSON error response %s", err.Error())
+	}
+}
+
+// WriteP2P writes an error response to a P2P request. The error is recorded in the metrics of the gateway, as the
+// P2P server gives no way to observe the response written by a handler.
+func WriteP2P(c *core.Core, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage, code messages.ErrorCode, detail string) error {
+	c.Metrics.ObserveError(metrics.APIP2P, request.GetMessageType(), code)
+	response, err := errorResponse(c, code, detail)
+	if err != nil {
+		logging.Error("Internal error: Fail to encode error response: %s", err.Error())
+		return writer.WriteInvalidMessage(c.Settings().TCPInactivityTimeout)
+	}
+	return writer.Write(response, c.Settings().TCPInactivityTimeout)
+}
+
+// NonceCode returns the error code of an error returned by core.CheckNonce.
+func NonceCode(err error) messages.ErrorCode {
+	if errors.Is(err, core.ErrTTLTooFar) {
+		return messages.ErrorInvalidMessage
+	}
+	if errors.Is(err, util.ErrReplayGuardFull) {
+		return messages.ErrorUnavailable
+	}
+	return messages.ErrorReplay
+}
+
+// errorResponse encodes an error response, signed with the signing key of the gateway. The response is not signed
+// if the keys of the gateway have not been initialised yet.
+func errorResponse(c *core.Core, code messages.ErrorCode, detail string) (*fcrmessages.FCRMessage, error) {
+	response, err := messages.EncodeGatewayErrorResponse(code, detail)
+	if err != nil {
+		return nil, err
+	}
+	if privKey, privKeyVer := c.SigningKey(); privKey != nil {
+		if err = response.Sign(privKey, privKeyVer); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
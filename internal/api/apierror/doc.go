@@ -0,0 +1,4 @@
+// Package apierror contains the code writing the error responses of the gateway APIs. Errors are
+// returned as a signed error message carrying an error code and a detail, on both the REST and
+// P2P APIs.
+package apierror
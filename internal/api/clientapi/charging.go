@@ -0,0 +1,152 @@
+package clientapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"net/http"
+	"sync"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+// Paid client requests follow the same charging policy: the cost of the request is quoted first, the voucher sent by
+// the client is received and charged against the quote, together with the client's credit, before anything is spent
+// upstream, and overpayment is credited to the client. Requests that are not fully paid get a payment request in
+// response. Amounts that were charged but could not be spent upstream are credited back to the client, so that the
+// gateway never spends more on behalf of a client than the client paid. Requests whose voucher can not be received are rejected before
+// the credit of their payment channel is touched, since the payment channel address alone proves nothing.
+
+// receivePayment returns the amount paid by a voucher. The payment channel address of a request is not signed, so
+// the credit, the payment requests and the client reputation of a payment channel are only used once a voucher on
+// it has been received: requests without a payment channel, or whose voucher can not be received, are rejected. It returns false if the request has been rejected, in
+// which case the response has already been written.
+func receivePayment(w rest.ResponseWriter, c *core.Core, paychAddr string, voucher string) (*big.Int, bool) {
+	if paychAddr == "" {
+		s := "Fail to receive payment: missing payment channel."
+		logging.Warn(s)
+		apierror.WriteREST(c, w, http.StatusPaymentRequired, messages.ErrorInsufficientPayment, s)
+		return nil, false
+	}
+	amount, err := c.PaymentMgr.Receive(paychAddr, voucher)
+	if err != nil {
+		s := "Fail to receive payment."
+		logging.Error("PaymentMgr receive " + err.Error())
+		apierror.WriteREST(c, w, http.StatusPaymentRequired, messages.ErrorInsufficientPayment, s)
+		return nil, false
+	}
+	return amount, true
+}
+
+// charge charges the payer of a request on pieceCID that costs price and has paid received. It returns true if the
+// charge is covered, or the payment request for the amount still owed. It returns false as its last value if no
+// payment request could be issued, in which case the response has already been written.
+func charge(w rest.ResponseWriter, c *core.Core, paychAddr string, pieceCID *cid.ContentID, price *big.Int, received *big.Int, request *fcrmessages.FCRMessage) (bool, *payment.Request, bool) {
+	paid, paymentRequest, err := c.PaymentRequestMgr.Charge(paychAddr, pieceCID, price, received, payment.RequestIDFromBody(request.GetMessageBody()))
+	if err != nil {
+		s := "Fail to issue payment request."
+		logging.Warn("%s Payment channel %s: %s", s, paychAddr, err.Error())
+		apierror.WriteREST(c, w, http.StatusServiceUnavailable, messages.ErrorUnavailable, s)
+		return false, nil, false
+	}
+	return paid, paymentRequest, true
+}
+
+// payGateway pays amount to a gateway, topping up the payment channel to the gateway first if needed. It returns
+// the payment channel address and the voucher to send to the gateway.
+func payGateway(c *core.Core, address string, amount *big.Int) (string, string, error) {
+	paychAddr, voucher, topup, err := c.PaymentMgr.Pay(address, 0, amount)
+	if err != nil {
+		return "", "", err
+	}
+	if topup {
+		if err := c.PaymentMgr.Topup(address, c.Settings().TopupAmount); err != nil {
+			return "", "", err
+		}
+		paychAddr, voucher, _, err = c.PaymentMgr.Pay(address, 0, amount)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return paychAddr, voucher, nil
+}
+
+// gatewayPayments tracks the payments made to the gateways contacted for a client request. Gateways that fail are
+// credited back to the client for their charge minus what was paid to them, so that the gateway never spends more
+// on behalf of a client than the client paid, nor refunds what it has spent.
+type gatewayPayments struct {
+	lock    sync.Mutex
+	paid    []*big.Int
+	settled bool
+}
+
+// newGatewayPayments creates the tracker of the payments to n gateways.
+func newGatewayPayments(n int) *gatewayPayments {
+	return &gatewayPayments{paid: make([]*big.Int, n)}
+}
+
+// pay pays amount to the i-th gateway, see payGateway. It returns errNotPaid if the gateway can not be paid, or if
+// the payments have been settled already.
+func (p *gatewayPayments) pay(c *core.Core, i int, address string, amount *big.Int) (string, string, error) {
+	p.lock.Lock()
+	if p.settled {
+		p.lock.Unlock()
+		return "", "", errNotPaid
+	}
+	// The payment is accounted for before it is made, so that a payment still in progress when the payments are
+	// settled is never credited back.
+	p.paid[i] = amount
+	p.lock.Unlock()
+
+	paychAddr, voucher, err := payGateway(c, address, amount)
+	if err != nil {
+		logging.Error("Fail to pay recipient." + err.Error())
+		p.lock.Lock()
+		if !p.settled {
+			p.paid[i] = nil
+		}
+		p.lock.Unlock()
+		return "", "", errNotPaid
+	}
+	return paychAddr, voucher, nil
+}
+
+// settle stops any further payment and credits the payer, for each failed gateway, its charge minus what was paid
+// to it.
+func (p *gatewayPayments) settle(c *core.Core, payer string, charges []*big.Int, failed []bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.settled = true
+	for i, charge := range charges {
+		if !failed[i] || charge == nil {
+			continue
+		}
+		unspent := new(big.Int).Set(charge)
+		if p.paid[i] != nil {
+			unspent.Sub(unspent, p.paid[i])
+		}
+		c.PaymentRequestMgr.Credit(payer, unspent)
+	}
+}
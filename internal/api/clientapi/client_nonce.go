@@ -0,0 +1,49 @@
+package clientapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+// checkClientNonce rejects a request whose nonce has already been used by the client within the ttl of the request,
+// or whose ttl is further than the nonce window. Requests are refused while the nonce cache is full.
+// The reputation of the client is left untouched, as anybody can replay a request of the client. It returns false if
+// the request has been rejected, in which case the response has already been written.
+func checkClientNonce(w rest.ResponseWriter, c *core.Core, clientID *nodeid.NodeID, nonce int64, ttl int64) bool {
+	err := c.CheckNonce(core.SenderClient, clientID, nonce, ttl)
+	if err == nil {
+		return true
+	}
+	s := "Request rejected: " + err.Error() + "."
+	logging.Warn("%s Client %s, nonce %d", s, clientID.ToString(), nonce)
+	status := http.StatusBadRequest
+	if errors.Is(err, util.ErrReplayGuardFull) {
+		status = http.StatusServiceUnavailable
+	}
+	apierror.WriteREST(c, w, status, apierror.NonceCode(err), s)
+	return false
+}
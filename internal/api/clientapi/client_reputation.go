@@ -0,0 +1,101 @@
+package clientapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+// clientIdentity is the subset of the fields of client requests that identify the client.
+type clientIdentity struct {
+	PaychAddr string `json:"payment_channel_address"`
+	Voucher   string `json:"voucher"`
+}
+
+// getClientID returns the id used to track the reputation of the client sending a request, derived from the payment
+// channel it pays from. Requests without a payment channel, or that can not be parsed at all, are attributed to a
+// single anonymous client. Parsing is lenient, so that the client can be identified even if the request fails to
+// decode. Nothing in a request is signed by the client, so the id is only proven once a voucher on the payment
+// channel has been received: reputation events are only recorded from then on, so that no client can be penalised by
+// the requests of somebody else, and never for the anonymous client. See penaliseClient.
+func getClientID(request *fcrmessages.FCRMessage) *nodeid.NodeID {
+	identity := clientIdentity{}
+	// Errors are ignored on purpose: fields decoded before the error are still used.
+	_ = json.Unmarshal(request.GetMessageBody(), &identity)
+	hash := sha256.Sum256([]byte(identity.PaychAddr))
+	clientID, _ := nodeid.NewNodeIDFromBytes(hash[:])
+	return clientID
+}
+
+// penaliseClient records a reputation event for the client sending a request that is rejected before its payment is
+// received, such as a request that fails to decode or has expired. The client is only identified once the voucher
+// sent with the request has been received, so the voucher is received first and its amount credited to the payment
+// channel. Requests without a payment channel, or whose voucher can not be received, leave every reputation
+// untouched.
+func penaliseClient(c *core.Core, request *fcrmessages.FCRMessage, event func(*nodeid.NodeID)) {
+	identity := clientIdentity{}
+	// Errors are ignored on purpose, as for getClientID.
+	_ = json.Unmarshal(request.GetMessageBody(), &identity)
+	if identity.PaychAddr == "" || identity.Voucher == "" {
+		return
+	}
+	amount, err := c.PaymentMgr.Receive(identity.PaychAddr, identity.Voucher)
+	if err != nil {
+		logging.Warn("Client reputation unchanged, fail to receive payment: %s", err.Error())
+		return
+	}
+	c.PaymentRequestMgr.Credit(identity.PaychAddr, amount)
+	event(getClientID(request))
+}
+
+// checkClientReputation enforces the reputation thresholds before a request is served. Clients below the refuse
+// threshold are refused, clients below the throttle threshold are rate limited, and clients below the prepay
+// threshold are only served by requests that are paid for before any work is done. It returns false if the request
+// has been rejected, in which case the response has already been written.
+func checkClientReputation(w rest.ResponseWriter, c *core.Core, clientID *nodeid.NodeID, prepaid bool) bool {
+	rep := c.ReputationMgr.GetOrEstablishClientReputation(clientID)
+	if rep < c.Settings().ClientRefuseReputation {
+		s := "Request refused: client reputation too low."
+		logging.Warn("%s Client %s has reputation %d", s, clientID.ToString(), rep)
+		apierror.WriteREST(c, w, http.StatusForbidden, messages.ErrorRefused, s)
+		return false
+	}
+	if rep < c.Settings().ClientThrottleReputation && !c.ClientThrottle.Allow(clientID.ToString(), c.Settings().ClientThrottleInterval) {
+		s := "Request refused: client is throttled."
+		logging.Warn("%s Client %s has reputation %d", s, clientID.ToString(), rep)
+		apierror.WriteREST(c, w, http.StatusTooManyRequests, messages.ErrorRefused, s)
+		return false
+	}
+	if !prepaid && rep < c.Settings().ClientPrepayReputation {
+		s := "Request refused: client reputation requires payment in advance, use a paid request."
+		logging.Warn("%s Client %s has reputation %d", s, clientID.ToString(), rep)
+		apierror.WriteREST(c, w, http.StatusPaymentRequired, messages.ErrorInsufficientPayment, s)
+		return false
+	}
+	return true
+}
@@ -29,33 +29,48 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
 
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/gatewayapi"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // HandleClientDHTCIDDiscoverRequest is used to handle client request for cid offer
-func HandleClientDHTCIDDiscoverRequest(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
+func HandleClientDHTCIDDiscoverRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	// This request fans out to other gateways before any payment is made
+	clientID := getClientID(request)
+	if !checkClientReputation(w, c, clientID, false) {
+		return
+	}
 
 	cid, nonce, ttl, numDHT, _, _, _, err := fcrmessages.DecodeClientDHTDiscoverRequest(request)
 	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
 	// First check if the message can be discarded
 	if time.Now().Unix() > ttl {
 		// Message expired.
+		penaliseClient(c, request, c.ReputationMgr.ClientExpiredRequest)
+		s := "Request expired."
+		logging.Warn("%s Client %s, ttl %d", s, clientID.ToString(), ttl)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorExpired, s)
+		return
+	}
+	// Reject a replay of the request
+	if !checkClientNonce(w, c, clientID, nonce, ttl) {
 		return
 	}
-	// Get a list of gatewayIDs to contact
-	gateways, err := c.RegisterMgr.GetGatewaysNearCID(cid, int(numDHT), c.GatewayID)
+	// Get a list of gatewayIDs to contact, skipping or deprioritising gateways with a bad reputation
+	gateways, err := gatewayapi.SelectGatewaysNearCID(c, cid, int(numDHT))
 	if err != nil {
 		s := "Fail to obtain peers."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInternal, s)
 		return
 	}
 	gatewayIDs := make([]*nodeid.NodeID, 0)
@@ -64,7 +79,7 @@ func HandleClientDHTCIDDiscoverRequest(w rest.ResponseWriter, request *fcrmessag
 		if err != nil {
 			s := "Fail to generate node id."
 			logging.Error(s + err.Error())
-			rest.Error(w, s, http.StatusBadRequest)
+			apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInternal, s)
 			return
 		}
 		gatewayIDs = append(gatewayIDs, id)
@@ -74,16 +89,22 @@ func HandleClientDHTCIDDiscoverRequest(w rest.ResponseWriter, request *fcrmessag
 	// TODO: Right now, it ignores the incremental result filed.
 	// Will return all in one message.
 	// Now requesting gateways.
+	// Gateways are requested concurrently, those that don't respond before the deadline are uncontactable.
+	results := fanOut(gatewayIDs, c.Settings().DHTFanOutWorkers, fanOutDeadline(ttl), func(_ int, id *nodeid.NodeID) (*fcrmessages.FCRMessage, error) {
+		start := time.Now()
+		res, err := c.P2PServer.RequestGatewayFromGateway(id, fcrmessages.GatewayDHTDiscoverRequestType, cid, id)
+		gatewayapi.RecordGatewayResponse(c, id, time.Since(start), err)
+		return res, err
+	})
 	contacted := make([]nodeid.NodeID, 0)
 	contactedResp := make([]fcrmessages.FCRMessage, 0)
 	unContactable := make([]nodeid.NodeID, 0)
-	for _, id := range gatewayIDs {
-		res, err := c.P2PServer.RequestGatewayFromGateway(id, fcrmessages.GatewayDHTDiscoverRequestType, cid, id)
-		if err != nil {
-			unContactable = append(unContactable, *id)
+	for i, result := range results {
+		if result.err != nil {
+			unContactable = append(unContactable, *gatewayIDs[i])
 		} else {
-			contacted = append(contacted, *id)
-			contactedResp = append(contactedResp, *res)
+			contacted = append(contacted, *gatewayIDs[i])
+			contactedResp = append(contactedResp, *result.response)
 		}
 	}
 
@@ -91,16 +112,16 @@ func HandleClientDHTCIDDiscoverRequest(w rest.ResponseWriter, request *fcrmessag
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 	if err := w.WriteJson(response); err != nil {
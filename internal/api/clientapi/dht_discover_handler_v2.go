@@ -25,112 +25,165 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/gatewayapi"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
 )
 
 // HandleClientDHTCIDDiscoverRequestV2 is used to handle client request for cid offer
-func HandleClientDHTCIDDiscoverRequestV2(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
+func HandleClientDHTCIDDiscoverRequestV2(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	clientID := getClientID(request)
+	if !checkClientReputation(w, c, clientID, true) {
+		return
+	}
 
 	cid, nonce, ttl, numDHT, _, paymentChannelAddress, voucher, err := fcrmessages.DecodeClientDHTDiscoverRequestV2(request)
 	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
 	// First check if the message can be discarded
 	if time.Now().Unix() > ttl {
 		// Message expired.
+		penaliseClient(c, request, c.ReputationMgr.ClientExpiredRequest)
+		s := "Request expired."
+		logging.Warn("%s Client %s, ttl %d", s, clientID.ToString(), ttl)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorExpired, s)
+		return
+	}
+	// Reject a replay of the request
+	if !checkClientNonce(w, c, clientID, nonce, ttl) {
 		return
 	}
-	// Get a list of gatewayIDs to contact
-	gateways, err := c.RegisterMgr.GetGatewaysNearCID(cid, int(numDHT), c.GatewayID)
+	// Get a list of gatewayIDs to contact, skipping or deprioritising gateways with a bad reputation
+	gateways, err := gatewayapi.SelectGatewaysNearCID(c, cid, int(numDHT))
 	if err != nil {
 		s := "Fail to obtain peers."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInternal, s)
 		return
 	}
 
-	amount, err := c.PaymentMgr.Receive(paymentChannelAddress, voucher)
-	if err != nil {
-		s := "Internal error in payment manager Receive."
-		logging.Error(s)
-		rest.Error(w, s, http.StatusBadRequest)
-		return
+	gatewayIDs := make([]*nodeid.NodeID, 0, len(gateways))
+	for _, gw := range gateways {
+		id, err := nodeid.NewNodeIDFromHexString(gw.GetNodeID())
+		if err != nil {
+			s := "Fail to generate node id."
+			logging.Error(s + err.Error())
+			apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInternal, s)
+			return
+		}
+		gatewayIDs = append(gatewayIDs, id)
 	}
 
-	expectedAmount := new(big.Int).Mul(c.Settings.SearchPrice, big.NewInt(numDHT))
-	if amount.Cmp(expectedAmount) < 0 {
-		s := "Insufficient Funds, received " + amount.String() + ", expected: " + expectedAmount.String()
-		logging.Error(s)
-		rest.Error(w, s, http.StatusInternalServerError)
+	// Charge the client the prices of the gateways that will be contacted before paying any of them. Gateways that
+	// are part of the price quote referenced by the request are charged at their quoted price, unless their current
+	// price is higher: the gateway never pays a peer more than the client was charged for it.
+	priceQuote := getQuote(c, request, clientID, cid)
+	prices := make([]*big.Int, len(gatewayIDs))
+	charges := make([]*big.Int, len(gatewayIDs))
+	quote := big.NewInt(0)
+	for i, id := range gatewayIDs {
+		prices[i] = c.Pricing.PeerSearchPrice(id)
+		charges[i] = prices[i]
+		if priceQuote != nil {
+			if quoted, exists := priceQuote.PeerSearchPrice(id); exists && quoted.Cmp(prices[i]) >= 0 {
+				charges[i] = quoted
+			}
+		}
+		quote.Add(quote, charges[i])
+	}
+	amount, ok := receivePayment(w, c, paymentChannelAddress, voucher)
+	if !ok {
+		return
+	}
+	paid, paymentRequest, ok := charge(w, c, paymentChannelAddress, cid, quote, amount, request)
+	if !ok {
+		return
+	}
+	if !paid {
+		c.ReputationMgr.ClientDhtDiscNonPayment(clientID)
+		logging.Error("Insufficient Funds, received %s, payment request %d owes %s", amount.String(), paymentRequest.ID, paymentRequest.Owed.String())
+		writeClientDHTDiscoverResponseV2(w, c, nil, nil, nil, nonce, quote, paymentRequest)
+		return
 	}
 
 	// Construct response
 	// TODO: Right now, it ignores the incremental result filed.
 	// Will return all in one message.
 	// Now requesting gateways.
+	// Gateways are paid and requested concurrently, within the deadline. Gateways that can't be paid, fail or don't
+	// respond before the deadline are uncontactable, and the share of their charge that was not paid to them is
+	// credited back to the client. The requests to the gateways expire at the deadline, the client has no use for
+	// their responses after it.
+	payments := newGatewayPayments(len(gatewayIDs))
+	deadline := fanOutDeadline(ttl)
+	results := fanOut(gatewayIDs, c.Settings().DHTFanOutWorkers, deadline, func(i int, id *nodeid.NodeID) (*fcrmessages.FCRMessage, error) {
+		paychAddr, voucher, err := payments.pay(c, i, gateways[i].GetAddress(), prices[i])
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		res, err := c.P2PServer.RequestGatewayFromGateway(id, fcrmessages.GatewayDHTDiscoverRequestV2Type, cid, id, paychAddr, voucher, deadline)
+		gatewayapi.RecordGatewayResponse(c, id, time.Since(start), err)
+		return res, err
+	})
 	contacted := make([]nodeid.NodeID, 0)
 	contactedResp := make([]fcrmessages.FCRMessage, 0)
 	unContactable := make([]nodeid.NodeID, 0)
-	for _, gw := range gateways {
-		id, err := nodeid.NewNodeIDFromHexString(gw.GetNodeID())
-		if err != nil {
-			s := "Fail to generate node id."
-			logging.Error(s + err.Error())
-			rest.Error(w, s, http.StatusBadRequest)
-			return
-		}
-		// Pay this gateway
-		paychAddr, voucher, topup, err := c.PaymentMgr.Pay(gw.GetAddress(), 0, c.Settings.SearchPrice)
-		if err != nil {
-			s := "Fail to pay recipient."
-			logging.Error(s + err.Error())
-			rest.Error(w, s, http.StatusBadRequest)
-			return
-		}
-		if topup {
-			if err := c.PaymentMgr.Topup(gw.GetAddress(), c.Settings.TopupAmount); err != nil {
-				s := "Fail to top up."
-				logging.Error(s + err.Error())
-				rest.Error(w, s, http.StatusBadRequest)
-				return
-			}
-			paychAddr, voucher, topup, err = c.PaymentMgr.Pay(gw.GetAddress(), 0, c.Settings.SearchPrice)
-			if err != nil {
-				s := "Fail to pay recipient."
-				logging.Error(s + err.Error())
-				rest.Error(w, s, http.StatusBadRequest)
-				return
-			}
-		}
-		res, err := c.P2PServer.RequestGatewayFromGateway(id, fcrmessages.GatewayDHTDiscoverRequestV2Type, cid, id, paychAddr, voucher)
-		if err != nil {
-			unContactable = append(unContactable, *id)
+	failed := make([]bool, len(results))
+	for i, result := range results {
+		if result.err != nil {
+			failed[i] = true
+			unContactable = append(unContactable, *gatewayIDs[i])
 		} else {
-			contacted = append(contacted, *id)
-			contactedResp = append(contactedResp, *res)
+			contacted = append(contacted, *gatewayIDs[i])
+			contactedResp = append(contactedResp, *result.response)
 		}
 	}
+	payments.settle(c, paymentChannelAddress, charges, failed)
 
-	response, err := fcrmessages.EncodeClientDHTDiscoverResponseV2(contacted, contactedResp, unContactable, nonce, false, 0)
+	if len(contacted) > 0 {
+		c.ReputationMgr.ClientDhtDiscOneCidOffer(clientID)
+	} else {
+		c.ReputationMgr.ClientDhtDiscNoCidOffers(clientID)
+	}
+
+	writeClientDHTDiscoverResponseV2(w, c, contacted, contactedResp, unContactable, nonce, nil, nil)
+}
+
+// writeClientDHTDiscoverResponseV2 encodes, signs and writes a DHT discover response. The response requires payment,
+// with the quote of the request, if a payment request is given.
+func writeClientDHTDiscoverResponseV2(w rest.ResponseWriter, c *core.Core, contacted []nodeid.NodeID, contactedResp []fcrmessages.FCRMessage, unContactable []nodeid.NodeID, nonce int64, quote *big.Int, paymentRequest *payment.Request) {
+	var response *fcrmessages.FCRMessage
+	var err error
+	if paymentRequest == nil {
+		response, err = fcrmessages.EncodeClientDHTDiscoverResponseV2(contacted, contactedResp, unContactable, nonce, false, 0)
+	} else {
+		response, err = fcrmessages.EncodeClientDHTDiscoverResponseV2(contacted, contactedResp, unContactable, nonce, true, paymentRequest.ID)
+		if err == nil {
+			response, err = payment.AddQuote(response, quote, paymentRequest)
+		}
+	}
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 	if err := w.WriteJson(response); err != nil {
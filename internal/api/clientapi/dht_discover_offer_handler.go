@@ -19,101 +19,149 @@ import (
 	"math/big"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
 
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/register"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/gatewayapi"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
 )
 
-func HandleClientDHTDiscoverOfferRequest(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
+func HandleClientDHTDiscoverOfferRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	clientID := getClientID(request)
+	if !checkClientReputation(w, c, clientID, true) {
+		return
+	}
 
 	cid, nonce, allGatewaysOfferDigests, targetGatewayIDs, paymentChannel, voucher, err := fcrmessages.DecodeClientDHTDiscoverOfferRequest(request)
 	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
+		return
+	}
+	// Reject a replay of the request, the request has no ttl so its nonce is remembered for the nonce window
+	if !checkClientNonce(w, c, clientID, nonce, 0) {
 		return
 	}
 
-	// Check amount
-	amount, err := c.PaymentMgr.Receive(paymentChannel, voucher)
-	if err != nil {
-		s := "Internal error in payment manager Receive."
+	if len(allGatewaysOfferDigests) != len(targetGatewayIDs) {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
+		s := "Fail to decode message: offer digests don't match gateways."
 		logging.Error(s)
-		logging.Error(err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
-	unit := 0
-	for _, entry := range allGatewaysOfferDigests {
-		unit += len(entry)
+
+	// Quote the offers of the gateways that can be contacted, at the prices of the gateways
+	unContactable := make([]nodeid.NodeID, 0)
+	targetGateways := make([]register.GatewayRegistrar, len(targetGatewayIDs))
+	prices := make([]*big.Int, len(targetGatewayIDs))
+	quote := big.NewInt(0)
+	for idx := range targetGatewayIDs {
+		targetGateways[idx] = c.RegisterMgr.GetGateway(&targetGatewayIDs[idx])
+		if targetGateways[idx] == nil {
+			logging.Info("Uncontactable: gateway information not found for %s", targetGatewayIDs[idx].ToString())
+			unContactable = append(unContactable, targetGatewayIDs[idx])
+			continue
+		}
+		prices[idx] = new(big.Int).Mul(big.NewInt(int64(len(allGatewaysOfferDigests[idx]))), c.Pricing.PeerOfferPrice(&targetGatewayIDs[idx]))
+		quote.Add(quote, prices[idx])
 	}
-	expectedAmt := new(big.Int).Mul(big.NewInt(int64(unit)), c.Settings.OfferPrice)
-	if amount.Cmp(expectedAmt) < 0 {
-		s := "Insufficient Funds, received " + amount.String() + ", expected: " + expectedAmt.String()
-		logging.Error(s)
-		rest.Error(w, s, http.StatusInternalServerError)
+
+	// Charge the client before paying any gateway
+	amount, ok := receivePayment(w, c, paymentChannel, voucher)
+	if !ok {
+		return
+	}
+	paid, paymentRequest, ok := charge(w, c, paymentChannel, cid, quote, amount, request)
+	if !ok {
+		return
+	}
+	if !paid {
+		c.ReputationMgr.ClientDhtDiscNonPayment(clientID)
+		logging.Error("Insufficient Funds, received %s, payment request %d owes %s", amount.String(), paymentRequest.ID, paymentRequest.Owed.String())
+		writeClientDHTDiscoverOfferResponse(w, c, cid, nonce, nil, nil, quote, paymentRequest)
+		return
 	}
 
+	// Gateways that can't be paid or fail are credited back to the client for the share of their charge that was
+	// not paid to them.
+	payments := newGatewayPayments(len(targetGatewayIDs))
+	failed := make([]bool, len(targetGatewayIDs))
 	contactedGateways := make([]nodeid.NodeID, 0)
 	contactedResp := make([]fcrmessages.FCRMessage, 0)
-	unContactable := make([]nodeid.NodeID, 0)
-	for idx, targetGatewayID := range targetGatewayIDs {
+	for idx := range targetGatewayIDs {
+		targetGatewayID := &targetGatewayIDs[idx]
+		targetGateway := targetGateways[idx]
+		if targetGateway == nil {
+			continue
+		}
 		thisGatewayOfferDigests := allGatewaysOfferDigests[idx]
-		targetGateway := c.RegisterMgr.GetGateway(&targetGatewayID)
-		// Pay this gateway
-		toPay := new(big.Int).Mul(big.NewInt(int64(len(thisGatewayOfferDigests))), c.Settings.OfferPrice)
-		paychAddr, voucher, topup, err := c.PaymentMgr.Pay(targetGateway.GetAddress(), 0, toPay)
+		paychAddr, voucher, err := payments.pay(c, idx, targetGateway.GetAddress(), prices[idx])
 		if err != nil {
-			s := "Fail to pay recipient."
-			logging.Error(s + err.Error())
-			rest.Error(w, s, http.StatusBadRequest)
-			return
-		}
-		if topup {
-			if err := c.PaymentMgr.Topup(targetGateway.GetAddress(), c.Settings.TopupAmount); err != nil {
-				s := "Fail to top up."
-				logging.Error(s + err.Error())
-				rest.Error(w, s, http.StatusBadRequest)
-				return
-			}
-			paychAddr, voucher, topup, err = c.PaymentMgr.Pay(targetGateway.GetAddress(), 0, c.Settings.SearchPrice)
-			if err != nil {
-				s := "Fail to pay recipient."
-				logging.Error(s + err.Error())
-				rest.Error(w, s, http.StatusBadRequest)
-				return
-			}
+			failed[idx] = true
+			unContactable = append(unContactable, *targetGatewayID)
+			continue
 		}
-		// using index from one collection to access another; create a struct?
-		res, err := c.P2PServer.RequestGatewayFromGateway(&targetGatewayID, fcrmessages.GatewayDHTDiscoverOfferRequestType, cid, &targetGatewayID, nonce, thisGatewayOfferDigests, paychAddr, voucher)
+		start := time.Now()
+		res, err := c.P2PServer.RequestGatewayFromGateway(targetGatewayID, fcrmessages.GatewayDHTDiscoverOfferRequestType, cid, targetGatewayID, nonce, thisGatewayOfferDigests, paychAddr, voucher)
+		gatewayapi.RecordGatewayResponse(c, targetGatewayID, time.Since(start), err)
 		if err != nil {
 			logging.Info("Uncontactable: %v", err.Error())
-			unContactable = append(unContactable, targetGatewayID)
+			failed[idx] = true
+			unContactable = append(unContactable, *targetGatewayID)
 		} else {
-			contactedGateways = append(contactedGateways, targetGatewayID)
+			contactedGateways = append(contactedGateways, *targetGatewayID)
 			contactedResp = append(contactedResp, *res)
 		}
 	}
 
-	response, err := fcrmessages.EncodeClientDHTDiscoverOfferResponse(cid, nonce, contactedGateways, contactedResp, false, 0)
+	payments.settle(c, paymentChannel, prices, failed)
+
+	if len(contactedGateways) > 0 {
+		c.ReputationMgr.ClientDhtDiscOneCidOffer(clientID)
+	} else {
+		c.ReputationMgr.ClientDhtDiscNoCidOffers(clientID)
+	}
+
+	writeClientDHTDiscoverOfferResponse(w, c, cid, nonce, contactedGateways, contactedResp, nil, nil)
+}
+
+// writeClientDHTDiscoverOfferResponse encodes, signs and writes a DHT discover offer response. The response requires
+// payment, with the quote of the request, if a payment request is given.
+func writeClientDHTDiscoverOfferResponse(w rest.ResponseWriter, c *core.Core, pieceCID *cid.ContentID, nonce int64, contactedGateways []nodeid.NodeID, contactedResp []fcrmessages.FCRMessage, quote *big.Int, paymentRequest *payment.Request) {
+	var response *fcrmessages.FCRMessage
+	var err error
+	if paymentRequest == nil {
+		response, err = fcrmessages.EncodeClientDHTDiscoverOfferResponse(pieceCID, nonce, contactedGateways, contactedResp, false, 0)
+	} else {
+		response, err = fcrmessages.EncodeClientDHTDiscoverOfferResponse(pieceCID, nonce, contactedGateways, contactedResp, true, paymentRequest.ID)
+		if err == nil {
+			response, err = payment.AddQuote(response, quote, paymentRequest)
+		}
+	}
 	if err != nil {
 		s := "Internal error: Fail to encode message, type: " + strconv.Itoa(fcrmessages.ClientDHTDiscoverOfferResponseType)
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
 	// Sign message
-	if signErr := response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion); signErr != nil {
+	if signErr := response.Sign(c.SigningKey()); signErr != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + signErr.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
@@ -22,20 +22,25 @@ import (
 
   "github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
   "github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/util"
 )
 
 // HandleClientEstablishmentRequest is used to handle initial establishment http request from client
-func HandleClientEstablishmentRequest(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
+func HandleClientEstablishmentRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	clientID := getClientID(request)
+	if !checkClientReputation(w, c, clientID, true) {
+		return
+	}
 
-	clientID, challenge, ttl, err := fcrmessages.DecodeClientEstablishmentRequest(request)
+	_, challenge, ttl, err := fcrmessages.DecodeClientEstablishmentRequest(request)
 	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
@@ -43,7 +48,10 @@ func HandleClientEstablishmentRequest(w rest.ResponseWriter, request *fcrmessage
 
 	now := util.GetTimeImpl().Now().Unix()
 	if now > ttl {
-		// TODO how to just drop the connection?
+		penaliseClient(c, request, c.ReputationMgr.ClientExpiredRequest)
+		s := "Request expired."
+		logging.Warn("%s Client %s, ttl %d", s, clientID.ToString(), ttl)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorExpired, s)
 		return
 	}
 
@@ -52,16 +60,16 @@ func HandleClientEstablishmentRequest(w rest.ResponseWriter, request *fcrmessage
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInternal, s)
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
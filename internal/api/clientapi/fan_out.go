@@ -0,0 +1,100 @@
+package clientapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+// responseMargin is how long before the ttl of a client request the response has to be sent.
+const responseMargin = 1 * time.Second
+
+// errDeadlineExceeded is the error of gateway requests that did not complete before the fan-out deadline.
+var errDeadlineExceeded = errors.New("gateway did not respond before the deadline")
+
+// errNotPaid is the error of gateway requests that were not sent because the gateway could not be paid.
+var errNotPaid = errors.New("gateway could not be paid")
+
+// gatewayResult is the outcome of a request sent to a gateway during a fan-out.
+type gatewayResult struct {
+	response *fcrmessages.FCRMessage
+	err      error
+}
+
+// fanOutDeadline returns the deadline by which the gateways contacted for a client request with the given ttl
+// have to respond.
+func fanOutDeadline(ttl int64) time.Time {
+	return time.Unix(ttl, 0).Add(-responseMargin)
+}
+
+// fanOut sends a request to each of the gateways concurrently, using at most workers goroutines, and collects the
+// results until the deadline. The results are in the order of the gateways. Gateways that have not responded by
+// the deadline get errDeadlineExceeded: requests already sent are not cancelled, but their results are discarded,
+// and requests not sent yet are not sent at all.
+func fanOut(gatewayIDs []*nodeid.NodeID, workers int, deadline time.Time, request func(i int, id *nodeid.NodeID) (*fcrmessages.FCRMessage, error)) []gatewayResult {
+	results := make([]gatewayResult, len(gatewayIDs))
+	for i := range results {
+		results[i].err = errDeadlineExceeded
+	}
+	if len(gatewayIDs) == 0 {
+		return results
+	}
+	if workers > len(gatewayIDs) {
+		workers = len(gatewayIDs)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	type indexedResult struct {
+		index  int
+		result gatewayResult
+	}
+	jobs := make(chan int, len(gatewayIDs))
+	for i := range gatewayIDs {
+		jobs <- i
+	}
+	close(jobs)
+	// Buffered so that workers finishing after the deadline never block.
+	done := make(chan indexedResult, len(gatewayIDs))
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				if !time.Now().Before(deadline) {
+					return
+				}
+				response, err := request(i, gatewayIDs[i])
+				done <- indexedResult{index: i, result: gatewayResult{response: response, err: err}}
+			}
+		}()
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for received := 0; received < len(gatewayIDs); received++ {
+		select {
+		case r := <-done:
+			results[r.index] = r.result
+		case <-timer.C:
+			return results
+		}
+	}
+	return results
+}
@@ -0,0 +1,105 @@
+package clientapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+func randomGatewayIDs(n int) []*nodeid.NodeID {
+	ids := make([]*nodeid.NodeID, n)
+	for i := range ids {
+		ids[i] = nodeid.NewRandomNodeID()
+	}
+	return ids
+}
+
+func TestFanOutConcurrent(t *testing.T) {
+	ids := randomGatewayIDs(8)
+	errFail := errors.New("fail")
+	start := time.Now()
+	results := fanOut(ids, 8, time.Now().Add(5*time.Second), func(i int, id *nodeid.NodeID) (*fcrmessages.FCRMessage, error) {
+		time.Sleep(100 * time.Millisecond)
+		if i%2 == 0 {
+			return nil, errFail
+		}
+		return &fcrmessages.FCRMessage{}, nil
+	})
+	// Serially, this would take 800ms.
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	for i, result := range results {
+		if i%2 == 0 {
+			assert.Equal(t, errFail, result.err)
+		} else {
+			assert.NoError(t, result.err)
+			assert.NotNil(t, result.response)
+		}
+	}
+}
+
+func TestFanOutBoundedWorkers(t *testing.T) {
+	ids := randomGatewayIDs(6)
+	var running, maxRunning int32
+	fanOut(ids, 2, time.Now().Add(5*time.Second), func(i int, id *nodeid.NodeID) (*fcrmessages.FCRMessage, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return &fcrmessages.FCRMessage{}, nil
+	})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
+}
+
+func TestFanOutDeadline(t *testing.T) {
+	ids := randomGatewayIDs(3)
+	start := time.Now()
+	results := fanOut(ids, 3, time.Now().Add(200*time.Millisecond), func(i int, id *nodeid.NodeID) (*fcrmessages.FCRMessage, error) {
+		if i == 1 {
+			time.Sleep(2 * time.Second)
+		}
+		return &fcrmessages.FCRMessage{}, nil
+	})
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.NoError(t, results[0].err)
+	assert.Equal(t, errDeadlineExceeded, results[1].err)
+	assert.NoError(t, results[2].err)
+}
+
+func TestFanOutDeadlinePassed(t *testing.T) {
+	ids := randomGatewayIDs(2)
+	var sent int32
+	results := fanOut(ids, 2, time.Now().Add(-time.Second), func(i int, id *nodeid.NodeID) (*fcrmessages.FCRMessage, error) {
+		atomic.AddInt32(&sent, 1)
+		return &fcrmessages.FCRMessage{}, nil
+	})
+	assert.Equal(t, int32(0), atomic.LoadInt32(&sent))
+	for _, result := range results {
+		assert.Equal(t, errDeadlineExceeded, result.err)
+	}
+}
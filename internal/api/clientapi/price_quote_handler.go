@@ -0,0 +1,135 @@
+package clientapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/gatewayapi"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/pricing"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+// HandleClientPriceQuoteRequest is used to handle client request for a price quote. The quote gives the prices the
+// client will be charged for the requests on a cid, including a DHT discovery of the gateways near the cid, and is
+// honoured for requests referencing it until it expires.
+func HandleClientPriceQuoteRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	clientID := getClientID(request)
+	if !checkClientReputation(w, c, clientID, true) {
+		return
+	}
+
+	pieceCID, nonce, ttl, numDHT, _, err := messages.DecodeClientPriceQuoteRequest(request)
+	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
+		s := "Fail to decode message."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
+		return
+	}
+
+	now := util.GetTimeImpl().Now().Unix()
+	if now > ttl {
+		penaliseClient(c, request, c.ReputationMgr.ClientExpiredRequest)
+		s := "Request expired."
+		logging.Warn("%s Client %s, ttl %d", s, clientID.ToString(), ttl)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorExpired, s)
+		return
+	}
+	// Reject a replay of the request
+	if !checkClientNonce(w, c, clientID, nonce, ttl) {
+		return
+	}
+
+	priced := pricing.Request{PieceCID: pieceCID, ClientID: clientID}
+	quote := pricing.Quote{
+		ClientID:         clientID.ToString(),
+		PieceCID:         pieceCID.ToString(),
+		SearchPrice:      c.Pricing.SearchPrice(priced),
+		OfferPrice:       c.Pricing.OfferPrice(priced),
+		PeerSearchPrices: make(map[string]*big.Int),
+	}
+	if numDHT > 0 {
+		// Quote the gateways a DHT discovery would contact now
+		gateways, err := gatewayapi.SelectGatewaysNearCID(c, pieceCID, int(numDHT))
+		if err != nil {
+			s := "Fail to obtain peers."
+			logging.Error(s + err.Error())
+			apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+			return
+		}
+		for _, gw := range gateways {
+			id, err := nodeid.NewNodeIDFromHexString(gw.GetNodeID())
+			if err != nil {
+				s := "Fail to generate node id."
+				logging.Error(s + err.Error())
+				apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+				return
+			}
+			quote.PeerSearchPrices[id.ToString()] = c.Pricing.PeerSearchPrice(id)
+		}
+	}
+	issued, err := c.Quotes.Issue(quote, c.Settings().PriceQuoteTTL, c.Settings().PriceQuoteLimit, c.Settings().PriceQuoteClientLimit)
+	if err != nil {
+		s := "Fail to issue price quote."
+		logging.Warn("%s Client %s: %s", s, clientID.ToString(), err.Error())
+		apierror.WriteREST(c, w, http.StatusServiceUnavailable, messages.ErrorUnavailable, s)
+		return
+	}
+
+	// Payment channels are opened to the address the gateway registered
+	paymentAddress := ""
+	if self := c.RegisterMgr.GetGateway(c.GatewayID); self != nil {
+		paymentAddress = self.GetAddress()
+	}
+	response, err := messages.EncodeClientPriceQuoteResponse(issued.ID, pieceCID, issued.SearchPrice, issued.OfferPrice,
+		numDHT, issued.DHTCost(), issued.Expiry, c.Settings().PaymentManager, paymentAddress, c.Settings().PaymentRequestTTL)
+	if err != nil {
+		s := "Internal error: Fail to encode message."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+		return
+	}
+
+	// Sign message
+	err = response.Sign(c.SigningKey())
+	if err != nil {
+		s := "Internal error: Fail to sign message."
+		logging.Error(s + err.Error())
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
+		return
+	}
+	if err := w.WriteJson(response); err != nil {
+		logging.Error("can't write JSON during HandleClientPriceQuoteRequest %s", err.Error())
+	}
+}
+
+// getQuote returns the unexpired price quote referenced by a request of a client on a cid, or nil if the request
+// references none.
+func getQuote(c *core.Core, request *fcrmessages.FCRMessage, clientID *nodeid.NodeID, pieceCID *cid.ContentID) *pricing.Quote {
+	return c.Quotes.Get(pricing.QuoteIDFromBody(request.GetMessageBody()), clientID, pieceCID)
+}
@@ -24,26 +24,39 @@ import (
   "github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
   "github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+  "github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
   "github.com/ConsenSys/fc-retrieval-gateway/internal/util"
 )
 
 // HandleClientStandardCIDDiscoverRequest is used to handle client request for cid offer
-func HandleClientStandardCIDDiscoverRequest(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
+func HandleClientStandardCIDDiscoverRequest(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	// This request is served before any payment is made
+	clientID := getClientID(request)
+	if !checkClientReputation(w, c, clientID, false) {
+		return
+	}
 
 	pieceCID, nonce, ttl, _, _, err := fcrmessages.DecodeClientStandardDiscoverRequest(request)
 	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
 	now := util.GetTimeImpl().Now().Unix()
 	if now > ttl {
-		// Drop the connection
+		penaliseClient(c, request, c.ReputationMgr.ClientExpiredRequest)
+		s := "Request expired."
+		logging.Warn("%s Client %s, ttl %d", s, clientID.ToString(), ttl)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorExpired, s)
+		return
+	}
+	// Reject a replay of the request
+	if !checkClientNonce(w, c, clientID, nonce, ttl) {
 		return
 	}
 
@@ -56,13 +69,14 @@ func HandleClientStandardCIDDiscoverRequest(w rest.ResponseWriter, request *fcrm
 	for _, offer := range offers {
 		suboffer, err := offer.GenerateSubCIDOffer(pieceCID)
 		if err != nil {
+			c.ReputationMgr.ProviderInvalidOffer(offer.GetProviderID())
 			s := "Internal error: Fail to generate suboffer."
 			logging.Error(s + err.Error())
-			rest.Error(w, s, http.StatusBadRequest)
+			apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInternal, s)
 			return
 		}
 		suboffers = append(suboffers, *suboffer)
-		fundedPaymentChannel = append(fundedPaymentChannel, false) // TODO, Need to find a way to check if having payment channel set up for a given provider.
+		fundedPaymentChannel = append(fundedPaymentChannel, c.HasFundedPaymentChannel(offer.GetProviderID()))
 	}
 
 	// Construct response
@@ -70,16 +84,16 @@ func HandleClientStandardCIDDiscoverRequest(w rest.ResponseWriter, request *fcrm
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusBadRequest)
+		apierror.WriteREST(c, w, http.StatusBadRequest, messages.ErrorInternal, s)
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(w, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, w, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
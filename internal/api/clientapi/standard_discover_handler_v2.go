@@ -23,26 +23,40 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/pricing"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
 )
 
 // HandleClientStandardCIDDiscoverRequestV2 is used to handle client request for cid offer
-func HandleClientStandardCIDDiscoverRequestV2(writer rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
+func HandleClientStandardCIDDiscoverRequestV2(c *core.Core, writer rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	clientID := getClientID(request)
+	if !checkClientReputation(writer, c, clientID, true) {
+		return
+	}
 
 	pieceCID, nonce, ttl, paymentChannelAddress, voucher, err := fcrmessages.DecodeClientStandardDiscoverRequestV2(request)
 	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(writer, s, http.StatusBadRequest)
+		apierror.WriteREST(c, writer, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
 	now := util.GetTimeImpl().Now().Unix()
 	if now > ttl {
-		// Drop the connection
+		penaliseClient(c, request, c.ReputationMgr.ClientExpiredRequest)
+		s := "Request expired."
+		logging.Warn("%s Client %s, ttl %d", s, clientID.ToString(), ttl)
+		apierror.WriteREST(c, writer, http.StatusBadRequest, messages.ErrorExpired, s)
+		return
+	}
+	// Reject a replay of the request
+	if !checkClientNonce(writer, c, clientID, nonce, ttl) {
 		return
 	}
 
@@ -51,45 +65,60 @@ func HandleClientStandardCIDDiscoverRequestV2(writer rest.ResponseWriter, reques
 
 	var response *fcrmessages.FCRMessage
 
-	receive, err := c.PaymentMgr.Receive(paymentChannelAddress, voucher)
-	if err == nil && receive.Cmp(c.Settings.SearchPrice) >= 0 {
+	receive, ok := receivePayment(writer, c, paymentChannelAddress, voucher)
+	if !ok {
+		return
+	}
+	price := c.Pricing.SearchPrice(pricing.Request{PieceCID: pieceCID, ClientID: clientID})
+	if quote := getQuote(c, request, clientID, pieceCID); quote != nil {
+		price = quote.SearchPrice
+	}
+	paid, paymentRequest, ok := charge(writer, c, paymentChannelAddress, pieceCID, price, receive, request)
+	if !ok {
+		return
+	}
+	if paid {
 		// success
 		subOfferDigests := make([][cidoffer.CIDOfferDigestSize]byte, 0)
 		fundedPaymentChannel := make([]bool, 0)
 
 		for _, offer := range offers {
 			subOfferDigests = append(subOfferDigests, offer.GetMessageDigest())
-			fundedPaymentChannel = append(fundedPaymentChannel, false)
+			fundedPaymentChannel = append(fundedPaymentChannel, c.HasFundedPaymentChannel(offer.GetProviderID()))
+		}
+
+		if exists {
+			c.ReputationMgr.ClientStdDiscOneCidOffer(clientID)
+		} else {
+			c.ReputationMgr.ClientStdDiscNoCidOffers(clientID)
 		}
 
 		// Construct response
 		response, err = fcrmessages.EncodeClientStandardDiscoverResponseV2(pieceCID, nonce, exists, subOfferDigests, fundedPaymentChannel, false, 0)
 	} else {
 		// Insufficient Funds Response
-		if err != nil {
-			logging.Error("PaymentMgr receive " + err.Error())
-		} else {
-			logging.Error("PaymentMgr insufficient funds received " + receive.String() + " (default: " + c.Settings.SearchPrice.String() + ")")
+		c.ReputationMgr.ClientStdDiscNonPayment(clientID)
+		logging.Error("PaymentMgr insufficient funds received %s, payment request %d owes %s", receive.String(), paymentRequest.ID, paymentRequest.Owed.String())
+		response, err = fcrmessages.EncodeClientStandardDiscoverResponseV2(pieceCID, nonce, exists, nil, nil, true, paymentRequest.ID)
+		if err == nil {
+			response, err = payment.AddQuote(response, price, paymentRequest)
 		}
-		// TODO get real payment channel ID
-		var paymentChannelID = int64(42)
-		response, err = fcrmessages.EncodeClientStandardDiscoverResponseV2(pieceCID, nonce, exists, nil, nil, true, paymentChannelID)
 	}
 
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(writer, s, http.StatusBadRequest)
+		apierror.WriteREST(c, writer, http.StatusBadRequest, messages.ErrorInternal, s)
 
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(writer, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, writer, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
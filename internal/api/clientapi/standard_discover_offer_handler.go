@@ -24,35 +24,61 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/pricing"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
 )
 
 // HandleClientStandardDiscoverOfferRequest is used to receive payment to respond to client standard offer query
-func HandleClientStandardDiscoverOfferRequest(writer rest.ResponseWriter, request *fcrmessages.FCRMessage) {
-	// Get core structure
-	c := core.GetSingleInstance()
+func HandleClientStandardDiscoverOfferRequest(c *core.Core, writer rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+	clientID := getClientID(request)
+	if !checkClientReputation(writer, c, clientID, true) {
+		return
+	}
 
 	pieceCID, nonce, ttl, offerDigests, paymentChannelAddress, voucher, err := fcrmessages.DecodeClientStandardDiscoverOfferRequest(request)
 	if err != nil {
+		penaliseClient(c, request, c.ReputationMgr.ClientInvalidMessage)
 		s := "Fail to decode message."
 		logging.Error(s + err.Error())
-		rest.Error(writer, s, http.StatusBadRequest)
+		apierror.WriteREST(c, writer, http.StatusBadRequest, messages.ErrorInvalidMessage, s)
 		return
 	}
 
 	now := util.GetTimeImpl().Now().Unix()
 	if now > ttl {
-		// Drop the connection
+		penaliseClient(c, request, c.ReputationMgr.ClientExpiredRequest)
+		s := "Request expired."
+		logging.Warn("%s Client %s, ttl %d", s, clientID.ToString(), ttl)
+		apierror.WriteREST(c, writer, http.StatusBadRequest, messages.ErrorExpired, s)
+		return
+	}
+	// Reject a replay of the request
+	if !checkClientNonce(writer, c, clientID, nonce, ttl) {
 		return
 	}
 
 	var response *fcrmessages.FCRMessage
 
-	receive, err := c.PaymentMgr.Receive(paymentChannelAddress, voucher)
+	receive, ok := receivePayment(writer, c, paymentChannelAddress, voucher)
+	if !ok {
+		return
+	}
+	// Quote the offers, at the price of the quote referenced by the request if any
+	offerPrice := c.Pricing.OfferPrice(pricing.Request{PieceCID: pieceCID, ClientID: clientID})
+	if quote := getQuote(c, request, clientID, pieceCID); quote != nil {
+		offerPrice = quote.OfferPrice
+	}
 	expectedAmount := new(big.Int).SetInt64(int64(len(offerDigests)))
-	expectedAmount.Mul(c.Settings.OfferPrice, expectedAmount)
-	if err == nil && receive.Cmp(expectedAmount) >= 0 {
+	expectedAmount.Mul(offerPrice, expectedAmount)
+	paid, paymentRequest, ok := charge(writer, c, paymentChannelAddress, pieceCID, expectedAmount, receive, request)
+	if !ok {
+		return
+	}
+	if paid {
 		// Success - Search for offers
 		subOffers := make([]cidoffer.SubCIDOffer, len(offerDigests))
 		fundedPaymentChannel := make([]bool, len(offerDigests))
@@ -60,45 +86,53 @@ func HandleClientStandardDiscoverOfferRequest(writer rest.ResponseWriter, reques
 
 		for i, digest := range offerDigests {
 			offer, exist := c.OffersMgr.GetOfferByDigest(digest)
-			fundedPaymentChannel[i] = exist
 			found = exist
+			if !exist {
+				continue
+			}
+			fundedPaymentChannel[i] = c.HasFundedPaymentChannel(offer.GetProviderID())
 
 			cidOffer, err := offer.GenerateSubCIDOffer(pieceCID)
 			if err != nil {
+				c.ReputationMgr.ProviderInvalidOffer(offer.GetProviderID())
 				continue
 			}
 
 			subOffers[i] = *cidOffer
 		}
 
+		if found {
+			c.ReputationMgr.ClientStdDiscOneCidOffer(clientID)
+		} else {
+			c.ReputationMgr.ClientStdDiscNoCidOffers(clientID)
+		}
+
 		// Construct response
 		response, err = fcrmessages.EncodeClientStandardDiscoverOfferResponse(pieceCID, nonce, found, subOffers, fundedPaymentChannel, false, 0)
 	} else {
 		// Insufficient Funds Response
-		if err != nil {
-			logging.Error("PaymentMgr receive " + err.Error())
-		} else {
-			logging.Error("PaymentMgr insufficient funds received " + receive.String() + " (default: " + c.Settings.SearchPrice.String() + ")")
+		c.ReputationMgr.ClientStdDiscNonPayment(clientID)
+		logging.Error("PaymentMgr insufficient funds received %s, payment request %d owes %s", receive.String(), paymentRequest.ID, paymentRequest.Owed.String())
+		response, err = fcrmessages.EncodeClientStandardDiscoverOfferResponse(pieceCID, nonce, false, nil, nil, true, paymentRequest.ID)
+		if err == nil {
+			response, err = payment.AddQuote(response, expectedAmount, paymentRequest)
 		}
-		// TODO get real payment channel ID
-		var paymentChannelID = int64(42)
-		response, err = fcrmessages.EncodeClientStandardDiscoverResponseV2(pieceCID, nonce, false, nil, nil, true, paymentChannelID)
 	}
 
 	if err != nil {
 		s := "Internal error: Fail to encode message."
 		logging.Error(s + err.Error())
-		rest.Error(writer, s, http.StatusBadRequest)
+		apierror.WriteREST(c, writer, http.StatusBadRequest, messages.ErrorInternal, s)
 
 		return
 	}
 
 	// Sign message
-	err = response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion)
+	err = response.Sign(c.SigningKey())
 	if err != nil {
 		s := "Internal error: Fail to sign message."
 		logging.Error(s + err.Error())
-		rest.Error(writer, s, http.StatusInternalServerError)
+		apierror.WriteREST(c, writer, http.StatusInternalServerError, messages.ErrorInternal, s)
 		return
 	}
 
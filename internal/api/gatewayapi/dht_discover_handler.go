@@ -27,41 +27,48 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // HandleGatewayDHTDiscoverRequest handles the gateway dht discover request
-func HandleGatewayDHTDiscoverRequest(_ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
-	// Get the core structure
-	c := core.GetSingleInstance()
-
+func HandleGatewayDHTDiscoverRequest(c *core.Core, _ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
 	gatewayID, pieceCID, nonce, ttl, _, _, err := fcrmessages.DecodeGatewayDHTDiscoverRequest(request)
 	if err != nil {
-		// Reply with invalid message
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Warn("Fail to decode message: %s", err.Error())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInvalidMessage, "Fail to decode message.")
 	}
 
 	// Get the gateway's signing key
 	gatewayInfo := c.RegisterMgr.GetGateway(gatewayID)
 	if gatewayInfo == nil {
 		logging.Warn("Gateway information not found for %s.", gatewayID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Gateway information not found.")
 	}
 	pubKey, err := gatewayInfo.GetSigningKey()
 	if err != nil {
 		logging.Warn("Fail to obtain the public key for %s", gatewayID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Fail to obtain the public key.")
 	}
 
 	// First verify the message
-	if request.Verify(pubKey) != nil {
+	if c.PeerKeys.Verify(gatewayID, pubKey, request) != nil {
+		// The sender is not penalised, anybody can send a request in its name
 		logging.Warn("Fail to verify the request from %s", gatewayID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorBadSignature, "Fail to verify the request.")
 	}
 
 	// Second check if the message can be discarded.
 	if time.Now().Unix() > ttl {
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Warn("Request from %s expired.", gatewayID.ToString())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorExpired, "Request expired.")
+	}
+
+	// Third reject a replay of the message.
+	if err = c.CheckNonce(core.SenderGateway, gatewayID, nonce, ttl); err != nil {
+		logging.Warn("Reject the request from %s: %s", gatewayID.ToString(), err.Error())
+		return apierror.WriteP2P(c, writer, request, apierror.NonceCode(err), "Request rejected: "+err.Error()+".")
 	}
 
 	// Respond to the request
@@ -73,27 +80,25 @@ func HandleGatewayDHTDiscoverRequest(_ *fcrp2pserver.FCRServerReader, writer *fc
 	for _, offer := range offers {
 		suboffer, err := offer.GenerateSubCIDOffer(pieceCID)
 		if err != nil {
+			c.ReputationMgr.ProviderInvalidOffer(offer.GetProviderID())
 			return err
 		}
 		suboffers = append(suboffers, *suboffer)
-		// TODO, Need to find a way to check if having payment channel set up for a given provider.
-		fundedPaymentChannel = append(fundedPaymentChannel, false)
+		fundedPaymentChannel = append(fundedPaymentChannel, c.HasFundedPaymentChannel(offer.GetProviderID()))
 	}
 
 	// Construct response
 	response, err := fcrmessages.EncodeGatewayDHTDiscoverResponse(pieceCID, nonce, exists, suboffers, fundedPaymentChannel)
 	if err != nil {
-		// TODO: Do we need a response of internal error?
-		// There are three possible errors, 1. Protocol errors (request is not correct) 2. Communication errors (lost connection) and 3. Internal errors.
-		// Need to do error management.
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Error("Internal error in encoding message.")
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in encoding message.")
 	}
 
 	// Sign the response
-	if response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if response.Sign(c.SigningKey()) != nil {
 		logging.Error("Internal error in signing message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in signing message.")
 	}
 
-	return writer.Write(response, c.Settings.TCPInactivityTimeout)
+	return writer.Write(response, c.Settings().TCPInactivityTimeout)
 }
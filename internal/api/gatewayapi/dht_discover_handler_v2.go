@@ -22,84 +22,99 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/pricing"
 )
 
 // HandleGatewayDHTDiscoverRequestV2 handles the gateway dht discover request
-func HandleGatewayDHTDiscoverRequestV2(_ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
-	// Get the core structure
-	c := core.GetSingleInstance()
-
+func HandleGatewayDHTDiscoverRequestV2(c *core.Core, _ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
 	gatewayID, pieceCID, nonce, ttl, paymentChannelAddress, voucher, err := fcrmessages.DecodeGatewayDHTDiscoverRequestV2(request)
 	if err != nil {
-		// Reply with invalid message
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Warn("Fail to decode message: %s", err.Error())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInvalidMessage, "Fail to decode message.")
 	}
 
 	// Get the gateway's signing key
 	gatewayInfo := c.RegisterMgr.GetGateway(gatewayID)
 	if gatewayInfo == nil {
 		logging.Warn("Gateway information not found for %s.", gatewayID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Gateway information not found.")
 	}
 	pubKey, err := gatewayInfo.GetSigningKey()
 	if err != nil {
 		logging.Warn("Fail to obtain the public key for %s", gatewayID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Fail to obtain the public key.")
 	}
 
 	// First verify the message
-	if request.Verify(pubKey) != nil {
+	if c.PeerKeys.Verify(gatewayID, pubKey, request) != nil {
+		// The sender is not penalised, anybody can send a request in its name
 		logging.Warn("Fail to verify the request from %s", gatewayID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorBadSignature, "Fail to verify the request.")
 	}
 
 	// Second check if the message can be discarded.
 	if time.Now().Unix() > ttl {
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Warn("Request from %s expired.", gatewayID.ToString())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorExpired, "Request expired.")
+	}
+
+	// Third reject a replay of the message.
+	if err = c.CheckNonce(core.SenderGateway, gatewayID, nonce, ttl); err != nil {
+		logging.Warn("Reject the request from %s: %s", gatewayID.ToString(), err.Error())
+		return apierror.WriteP2P(c, writer, request, apierror.NonceCode(err), "Request rejected: "+err.Error()+".")
 	}
 
 	amount, err := c.PaymentMgr.Receive(paymentChannelAddress, voucher)
 	if err != nil {
 		logging.Error("Payment manager receive error " + err.Error())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInsufficientPayment, "Fail to receive payment: "+err.Error()+".")
 	}
 
-	// Respond to the request
-	offers, exists := c.OffersMgr.GetOffers(pieceCID)
-
-	subCIDOfferDigests := make([][cidoffer.CIDOfferDigestSize]byte, 0)
-	fundedPaymentChannel := make([]bool, 0)
-
-	for _, offer := range offers {
-		subCIDOfferDigests = append(subCIDOfferDigests, offer.GetMessageDigest())
-		fundedPaymentChannel = append(fundedPaymentChannel, false)
-	}
 	var response *fcrmessages.FCRMessage
 	var encodingErr error
-	if amount.Cmp(c.Settings.SearchPrice) < 0 {
+	// Charge before looking up the offers
+	price := c.Pricing.SearchPrice(pricing.Request{PieceCID: pieceCID})
+	paid, paymentRequest, err := c.PaymentRequestMgr.Charge(paymentChannelAddress, pieceCID, price, amount, payment.RequestIDFromBody(request.GetMessageBody()))
+	if err != nil {
+		logging.Warn("Fail to issue payment request to payment channel %s: %s", paymentChannelAddress, err.Error())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnavailable, "Fail to issue payment request.")
+	}
+	if !paid {
 		// not good - payment required
-		logging.Error("Insufficient Funds, received " + amount.String() + ", expected: " + c.Settings.SearchPrice.String())
-		// TODO get real payment channel ID
-		var paymentChannelID = int64(42)
+		logging.Error("Insufficient Funds, received %s, payment request %d owes %s", amount.String(), paymentRequest.ID, paymentRequest.Owed.String())
 		// Construct response with payment required
-		response, encodingErr = fcrmessages.EncodeGatewayDHTDiscoverResponseV2(pieceCID, nonce, exists, subCIDOfferDigests, fundedPaymentChannel, true, paymentChannelID)
+		response, encodingErr = fcrmessages.EncodeGatewayDHTDiscoverResponseV2(pieceCID, nonce, false, nil, nil, true, paymentRequest.ID)
+		if encodingErr == nil {
+			response, encodingErr = payment.AddQuote(response, price, paymentRequest)
+		}
 	} else {
+		// Respond to the request
+		offers, exists := c.OffersMgr.GetOffers(pieceCID)
+
+		subCIDOfferDigests := make([][cidoffer.CIDOfferDigestSize]byte, 0)
+		fundedPaymentChannel := make([]bool, 0)
+
+		for _, offer := range offers {
+			subCIDOfferDigests = append(subCIDOfferDigests, offer.GetMessageDigest())
+			fundedPaymentChannel = append(fundedPaymentChannel, c.HasFundedPaymentChannel(offer.GetProviderID()))
+		}
 		// all good - Construct response
 		response, encodingErr = fcrmessages.EncodeGatewayDHTDiscoverResponseV2(pieceCID, nonce, exists, subCIDOfferDigests, fundedPaymentChannel, false, 0)
 	}
 	if encodingErr != nil {
-		// TODO: Do we need a response of internal error?
-		// There are three possible errors, 1. Protocol errors (request is not correct) 2. Communication errors (lost connection) and 3. Internal errors.
-		// Need to do error management.
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Error("Internal error in encoding message.")
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in encoding message.")
 	}
 
 	// Sign the response
-	if response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if response.Sign(c.SigningKey()) != nil {
 		logging.Error("Internal error in signing message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in signing message.")
 	}
 
-	return writer.Write(response, c.Settings.TCPInactivityTimeout)
+	return writer.Write(response, c.Settings().TCPInactivityTimeout)
 }
@@ -7,7 +7,11 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/pricing"
 )
 
 /*
@@ -26,82 +30,88 @@ import (
  */
 
 // HandleGatewayDHTOfferRequest handles the gateway dht discover request
-func HandleGatewayDHTOfferRequest(_ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
-	// Get the core structure
-	c := core.GetSingleInstance()
-
+func HandleGatewayDHTOfferRequest(c *core.Core, _ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
 	// TODO, Need to have an id
 	pieceCID, nonce, offerDigests, paymentChannelAddress, voucher, err := fcrmessages.DecodeGatewayDHTDiscoverOfferRequest(request)
 	if err != nil {
-		// Reply with invalid message
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Warn("Fail to decode message: %s", err.Error())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInvalidMessage, "Fail to decode message.")
 	}
 
 	// // Get the gateway's signing key
 	// gatewayInfo := c.RegisterMgr.GetGateway(gatewayID)
 	// if gatewayInfo == nil {
 	// 	logging.Warn("Gateway information not found for %s.", gatewayID.ToString())
-	// 	return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+	// 	return writer.WriteInvalidMessage(c.Settings().TCPInactivityTimeout)
 	// }
 	// pubKey, err := gatewayInfo.GetSigningKey()
 	// if err != nil {
 	// 	logging.Warn("Fail to obtain the public key for %s", gatewayID.ToString())
-	// 	return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+	// 	return writer.WriteInvalidMessage(c.Settings().TCPInactivityTimeout)
 	// }
 
 	// // First verify the message
 	// if request.Verify(pubKey) != nil {
 	// 	logging.Warn("Fail to verify the request from %s", gatewayID.ToString())
-	// 	return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+	// 	return writer.WriteInvalidMessage(c.Settings().TCPInactivityTimeout)
 	// }
 
 	amount, err := c.PaymentMgr.Receive(paymentChannelAddress, voucher)
 	if err != nil {
 		logging.Error("Internal error in payment manager Receive.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInsufficientPayment, "Fail to receive payment: "+err.Error()+".")
 	}
 
+	// Charge before looking up the offers
 	lenOffers := big.NewInt(int64(len(offerDigests)))
-	expectedAmount := c.Settings.OfferPrice.Mul(c.Settings.OfferPrice, lenOffers)
+	expectedAmount := new(big.Int).Mul(c.Pricing.OfferPrice(pricing.Request{PieceCID: pieceCID}), lenOffers)
+	var response *fcrmessages.FCRMessage
+	var encodingErr error
+	paid, paymentRequest, err := c.PaymentRequestMgr.Charge(paymentChannelAddress, pieceCID, expectedAmount, amount, payment.RequestIDFromBody(request.GetMessageBody()))
+	if err != nil {
+		logging.Warn("Fail to issue payment request to payment channel %s: %s", paymentChannelAddress, err.Error())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnavailable, "Fail to issue payment request.")
+	}
+	if !paid {
+		logging.Error("Insufficient Funds, received %s, payment request %d owes %s", amount.String(), paymentRequest.ID, paymentRequest.Owed.String())
+		response, encodingErr = fcrmessages.EncodeGatewayDHTDiscoverOfferResponse(pieceCID, nonce, false, nil, nil, true, paymentRequest.ID)
+		if encodingErr == nil {
+			response, encodingErr = payment.AddQuote(response, expectedAmount, paymentRequest)
+		}
+	} else {
+		subOffers := make([]cidoffer.SubCIDOffer, len(offerDigests))
+		fundedPaymentChannel := make([]bool, len(offerDigests))
+		const found = true
 
-	subOffers := make([]cidoffer.SubCIDOffer, len(offerDigests))
-	fundedPaymentChannel := make([]bool, len(offerDigests))
-	const found = true
+		for i, digest := range offerDigests {
+			offer, exist := c.OffersMgr.GetOfferByDigest(digest)
+			if !exist {
+				continue
+			}
+			fundedPaymentChannel[i] = c.HasFundedPaymentChannel(offer.GetProviderID())
 
-	for i, digest := range offerDigests {
-		offer, exist := c.OffersMgr.GetOfferByDigest(digest)
-		fundedPaymentChannel[i] = exist
+			cidOffer, err := offer.GenerateSubCIDOffer(pieceCID)
+			if err != nil {
+				c.ReputationMgr.ProviderInvalidOffer(offer.GetProviderID())
+				continue
+			}
 
-		cidOffer, err := offer.GenerateSubCIDOffer(pieceCID)
-		if err != nil {
-			continue
+			subOffers[i] = *cidOffer
 		}
 
-		subOffers[i] = *cidOffer
-	}
-	var response *fcrmessages.FCRMessage
-	var encodingErr error
-	if amount.Cmp(expectedAmount) < 0 {
-		logging.Error("Insufficient Funds, received " + amount.String() + ", expected: " + expectedAmount.String())
-		// TODO get real payment channel ID
-		var paymentChannelID = int64(42)
-		response, encodingErr = fcrmessages.EncodeGatewayDHTDiscoverOfferResponse(pieceCID, nonce, found, subOffers, fundedPaymentChannel, true, paymentChannelID)
-	} else {
 		// Construct response
 		response, encodingErr = fcrmessages.EncodeGatewayDHTDiscoverOfferResponse(pieceCID, nonce, found, subOffers, fundedPaymentChannel, false, 0)
 	}
 	if encodingErr != nil {
-		// TODO: Do we need a response of internal error?
-		// There are three possible errors, 1. Protocol errors (request is not correct) 2. Communication errors (lost connection) and 3. Internal errors.
-		// Need to do error management.
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Error("Internal error in encoding message.")
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in encoding message.")
 	}
 
 	// Sign the response
-	if response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if response.Sign(c.SigningKey()) != nil {
 		logging.Error("Internal error in signing message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in signing message.")
 	}
 
-	return writer.Write(response, c.Settings.TCPInactivityTimeout)
+	return writer.Write(response, c.Settings().TCPInactivityTimeout)
 }
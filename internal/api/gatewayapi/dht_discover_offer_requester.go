@@ -25,10 +25,11 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // RequestGatewayDHTDiscoverOffer is used to request a DHT
-func RequestGatewayDHTDiscoverOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
+func RequestGatewayDHTDiscoverOffer(c *core.Core, reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
 	// Get parameters
 	if len(args) != 6 {
 		return nil, errors.New("wrong arguments")
@@ -58,25 +59,22 @@ func RequestGatewayDHTDiscoverOffer(reader *fcrp2pserver.FCRServerReader, writer
 		return nil, errors.New("wrong arguments")
 	}
 
-	// Get the core structure
-	c := core.GetSingleInstance()
-
 	// // Construct message
 	request, err := fcrmessages.EncodeGatewayDHTDiscoverOfferRequest(contentID, nonce, offerDigests, paychAddr, voucher)
 	if err != nil {
 		return nil, err
 	}
 	// Sign the request
-	if request.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if request.Sign(c.SigningKey()) != nil {
 		return nil, errors.New("internal error in signing the request")
 	}
 	// Send the request
-	err = writer.Write(request, c.Settings.TCPInactivityTimeout)
+	err = writer.Write(request, c.Settings().TCPInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
-	// Get a response
-	response, err := reader.Read(c.Settings.TCPInactivityTimeout)
+	// Get a response, the peer may take a while to produce it
+	response, err := reader.Read(c.Settings().TCPLongInactivityTimeout)
 	if err != nil {
 		logging.Info(err.Error())
 		return nil, err
@@ -93,8 +91,12 @@ func RequestGatewayDHTDiscoverOffer(reader *fcrp2pserver.FCRServerReader, writer
 		return nil, errors.New("fail to obatin the public key")
 	}
 
-	if response.Verify(pubKey) != nil {
-		return nil, errors.New("fail to verify the response")
+	if c.PeerKeys.Verify(gatewayID, pubKey, response) != nil {
+		return nil, ErrVerificationFailed
+	}
+	// The gateway may have replied with an error response
+	if err = messages.ErrorFromResponse(response); err != nil {
+		return nil, err
 	}
 	return response, nil
 }
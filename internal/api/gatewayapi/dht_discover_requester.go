@@ -24,10 +24,11 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // RequestGatewayDHTDiscover is used to request a DHT CID Discover.
-func RequestGatewayDHTDiscover(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
+func RequestGatewayDHTDiscover(c *core.Core, reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
 	// Get parameters
 	if len(args) != 2 {
 		return nil, errors.New("wrong arguments")
@@ -41,26 +42,23 @@ func RequestGatewayDHTDiscover(reader *fcrp2pserver.FCRServerReader, writer *fcr
 		return nil, errors.New("wrong arguments")
 	}
 
-	// Get the core structure
-	c := core.GetSingleInstance()
-
 	// Construct message
-	// TODO, ADD nonce, TTL and payment information.
-	request, err := fcrmessages.EncodeGatewayDHTDiscoverRequest(c.GatewayID, contentID, 1, time.Now().Add(10*time.Second).Unix(), "", "")
+	// TODO, ADD TTL and payment information.
+	request, err := fcrmessages.EncodeGatewayDHTDiscoverRequest(c.GatewayID, contentID, newNonce(), time.Now().Add(10*time.Second).Unix(), "", "")
 	if err != nil {
 		return nil, err
 	}
 	// Sign the request
-	if request.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if request.Sign(c.SigningKey()) != nil {
 		return nil, errors.New("internal error in signing the request")
 	}
 	// Send the request
-	err = writer.Write(request, c.Settings.TCPInactivityTimeout)
+	err = writer.Write(request, c.Settings().TCPInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
-	// Get a response
-	response, err := reader.Read(c.Settings.TCPInactivityTimeout)
+	// Get a response, the peer may take a while to produce it
+	response, err := reader.Read(c.Settings().TCPLongInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -76,8 +74,12 @@ func RequestGatewayDHTDiscover(reader *fcrp2pserver.FCRServerReader, writer *fcr
 		return nil, errors.New("fail to obatin the public key")
 	}
 
-	if response.Verify(pubKey) != nil {
-		return nil, errors.New("fail to verify the response")
+	if c.PeerKeys.Verify(gatewayID, pubKey, response) != nil {
+		return nil, ErrVerificationFailed
+	}
+	// The gateway may have replied with an error response
+	if err = messages.ErrorFromResponse(response); err != nil {
+		return nil, err
 	}
 	return response, nil
 }
@@ -24,12 +24,14 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
-// RequestGatewayDHTDiscoverV2 is used to request a DHT CID Discover.
-func RequestGatewayDHTDiscoverV2(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
+// RequestGatewayDHTDiscoverV2 is used to request a DHT CID Discover. The request expires at the given deadline, by
+// which the response is needed.
+func RequestGatewayDHTDiscoverV2(c *core.Core, reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
 	// Get parameters
-	if len(args) != 4 {
+	if len(args) != 5 {
 		return nil, errors.New("wrong arguments")
 	}
 	contentID, ok := args[0].(*cid.ContentID)
@@ -48,27 +50,27 @@ func RequestGatewayDHTDiscoverV2(reader *fcrp2pserver.FCRServerReader, writer *f
 	if !ok {
 		return nil, errors.New("wrong arguments")
 	}
-
-	// Get the core structure
-	c := core.GetSingleInstance()
+	deadline, ok := args[4].(time.Time)
+	if !ok {
+		return nil, errors.New("wrong arguments")
+	}
 
 	// Construct message
-	// TODO, ADD nonce, TTL and payment information.
-	request, err := fcrmessages.EncodeGatewayDHTDiscoverRequestV2(c.GatewayID, contentID, 1, time.Now().Add(10*time.Second).Unix(), paychAddr, voucher)
+	request, err := fcrmessages.EncodeGatewayDHTDiscoverRequestV2(c.GatewayID, contentID, newNonce(), deadline.Unix(), paychAddr, voucher)
 	if err != nil {
 		return nil, err
 	}
 	// Sign the request
-	if request.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if request.Sign(c.SigningKey()) != nil {
 		return nil, errors.New("internal error in signing the request")
 	}
 	// Send the request
-	err = writer.Write(request, c.Settings.TCPInactivityTimeout)
+	err = writer.Write(request, c.Settings().TCPInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
-	// Get a response
-	response, err := reader.Read(c.Settings.TCPInactivityTimeout)
+	// Get a response, the peer may take a while to produce it
+	response, err := reader.Read(c.Settings().TCPLongInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -84,8 +86,12 @@ func RequestGatewayDHTDiscoverV2(reader *fcrp2pserver.FCRServerReader, writer *f
 		return nil, errors.New("fail to obatin the public key")
 	}
 
-	if response.Verify(pubKey) != nil {
-		return nil, errors.New("fail to verify the response")
+	if c.PeerKeys.Verify(gatewayID, pubKey, response) != nil {
+		return nil, ErrVerificationFailed
+	}
+	// The gateway may have replied with an error response
+	if err = messages.ErrorFromResponse(response); err != nil {
+		return nil, err
 	}
 	return response, nil
 }
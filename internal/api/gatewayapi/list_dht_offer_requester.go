@@ -28,7 +28,7 @@ import (
 )
 
 // RequestListCIDOffer is used at start-up to request a list of DHT Offers from a provider with a given provider id.
-func RequestListCIDOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
+func RequestListCIDOffer(c *core.Core, reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
 	// Get parameters
 	if len(args) != 3 {
 		return nil, errors.New("wrong arguments")
@@ -46,9 +46,6 @@ func RequestListCIDOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pser
 		return nil, errors.New("wrong arguments")
 	}
 
-	// Get the core structure
-	c := core.GetSingleInstance()
-
 	request, err := fcrmessages.EncodeGatewayListDHTOfferRequest(
 		c.GatewayID,
 		cidMin,
@@ -62,16 +59,16 @@ func RequestListCIDOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pser
 		return nil, err
 	}
 	// Sign the request
-	if request.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if request.Sign(c.SigningKey()) != nil {
 		return nil, errors.New("internal error in signing the request")
 	}
 	// Send the request
-	err = writer.Write(request, c.Settings.TCPInactivityTimeout)
+	err = writer.Write(request, c.Settings().TCPInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
-	// Get a response
-	response, err := reader.Read(c.Settings.TCPInactivityTimeout)
+	// Get a response, the peer may take a while to produce it
+	response, err := reader.Read(c.Settings().TCPLongInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -86,8 +83,9 @@ func RequestListCIDOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pser
 	if err != nil {
 		return nil, errors.New("fail to obatin the public key")
 	}
-	if response.Verify(pubKey) != nil {
-		return nil, errors.New("fail to verify the response")
+	if c.PeerKeys.Verify(providerID, pubKey, response) != nil {
+		c.ReputationMgr.ProviderVerificationFailure(providerID)
+		return nil, ErrVerificationFailed
 	}
 
 	// Sending acknowledgement
@@ -100,7 +98,8 @@ func RequestListCIDOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pser
 	cidOfferMsgAcks := make([]fcrmessages.FCRMessage, 0)
 	for _, cidOfferMsg := range cidOfferMsgs {
 		// First verify the sub message
-		if cidOfferMsg.Verify(pubKey) != nil {
+		if c.PeerKeys.Verify(providerID, pubKey, &cidOfferMsg) != nil {
+			c.ReputationMgr.ProviderVerificationFailure(providerID)
 			logging.Error("Fail to verify the sub message")
 			continue
 		}
@@ -110,20 +109,23 @@ func RequestListCIDOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pser
 			continue
 		}
 		// Verify the offers
-		for _, cidOffer := range cidOffers {
-			if cidOffer.Verify(pubKey) != nil {
+		for i := range cidOffers {
+			cidOffer := &cidOffers[i]
+			if c.PeerKeys.VerifyFunc(providerID, pubKey, cidOffer.Verify) != nil {
+				c.ReputationMgr.ProviderVerificationFailure(providerID)
 				logging.Error("Fail to verify the offer")
 				continue
 			}
 			// Store the offer
-			if c.OffersMgr.AddDHTOffer(&cidOffer) != nil {
+			if c.OffersMgr.AddDHTOffer(cidOffer) != nil {
 				logging.Error("Fail to store the offer")
 				continue
 			}
 		}
 
 		// Sign the offer message
-		sig, err := fcrcrypto.SignMessage(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion, cidOfferMsg.GetMessageBody())
+		privKey, privKeyVer := c.SigningKey()
+		sig, err := fcrcrypto.SignMessage(privKey, privKeyVer, cidOfferMsg.GetMessageBody())
 		if err != nil {
 			return nil, err
 		}
@@ -138,9 +140,9 @@ func RequestListCIDOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pser
 		return nil, err
 	}
 	// Sign the ack
-	if ack.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if ack.Sign(c.SigningKey()) != nil {
 		return nil, errors.New("error in signing the ack")
 	}
 
-	return nil, writer.Write(ack, c.Settings.TCPInactivityTimeout)
+	return nil, writer.Write(ack, c.Settings().TCPInactivityTimeout)
 }
@@ -0,0 +1,95 @@
+package gatewayapi
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/register"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+)
+
+// maxGatewayCandidates is the maximum number of gateways returned by the register manager for a cid.
+const maxGatewayCandidates = 16
+
+// ErrVerificationFailed is returned by the requesters when the response of a gateway fails signature verification.
+var ErrVerificationFailed = errors.New("fail to verify the response")
+
+// RecordGatewayResponse updates the reputation of a gateway given the outcome of a request sent to it, and records
+// the outcome and the latency of the request in the metrics of the gateway. Errors that are not caused by the
+// gateway, such as a missing register entry, leave the reputation unchanged.
+func RecordGatewayResponse(c *core.Core, gatewayID *nodeid.NodeID, latency time.Duration, err error) {
+	c.Metrics.ObservePeerRequest(gatewayID.ToString(), latency, err == nil)
+	if err == nil {
+		c.ReputationMgr.GatewaySuccessfulResponse(gatewayID)
+		return
+	}
+	if errors.Is(err, ErrVerificationFailed) {
+		c.ReputationMgr.GatewayVerificationFailure(gatewayID)
+		return
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		// Timeouts and connection failures.
+		c.ReputationMgr.GatewayUncontactable(gatewayID)
+	}
+}
+
+// SelectGatewaysNearCID returns up to numDHT gateways close to the given cid to contact. Gateways with a
+// reputation below the skip threshold are left out, and gateways with a reputation below the deprioritise
+// threshold are only selected when there are not enough gateways with a better reputation. The order of
+// closeness is preserved otherwise.
+func SelectGatewaysNearCID(c *core.Core, contentID *cid.ContentID, numDHT int) ([]register.GatewayRegistrar, error) {
+	candidates, err := c.RegisterMgr.GetGatewaysNearCID(contentID, maxGatewayCandidates, c.GatewayID)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		gateway      register.GatewayRegistrar
+		deprioritise bool
+	}
+	selected := make([]candidate, 0, len(candidates))
+	for _, gw := range candidates {
+		id, err := nodeid.NewNodeIDFromHexString(gw.GetNodeID())
+		if err != nil {
+			return nil, err
+		}
+		rep := c.ReputationMgr.GetOrEstablishGatewayReputation(id)
+		if rep < c.Settings().GatewaySkipReputation {
+			logging.Info("Skipping gateway %s with reputation %d", id.ToString(), rep)
+			continue
+		}
+		selected = append(selected, candidate{gateway: gw, deprioritise: rep < c.Settings().GatewayDeprioritiseReputation})
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return !selected[i].deprioritise && selected[j].deprioritise
+	})
+	if len(selected) > numDHT {
+		selected = selected[:numDHT]
+	}
+	res := make([]register.GatewayRegistrar, len(selected))
+	for i := range selected {
+		res[i] = selected[i].gateway
+	}
+	return res, nil
+}
@@ -24,7 +24,7 @@ import (
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
 )
 
-func NotifyProviderGroupCIDOfferSupported(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
+func NotifyProviderGroupCIDOfferSupported(c *core.Core, reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
 	// Get parameters
 	if len(args) != 1 {
 		return nil, errors.New("wrong arguments")
@@ -34,9 +34,6 @@ func NotifyProviderGroupCIDOfferSupported(reader *fcrp2pserver.FCRServerReader,
 		return nil, errors.New("wrong arguments")
 	}
 
-	// Get the core structure
-	c := core.GetSingleInstance()
-
 	request, err := fcrmessages.EncodeGatewayNotifyProviderGroupCIDOfferSupportRequest(
 		c.GatewayID,
 		groupCIDOfferSupported,
@@ -45,16 +42,16 @@ func NotifyProviderGroupCIDOfferSupported(reader *fcrp2pserver.FCRServerReader,
 		return nil, err
 	}
 
-	if request.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if request.Sign(c.SigningKey()) != nil {
 		return nil, errors.New("internal error in signing the request")
 	}
 	// Send the request
-	err = writer.Write(request, c.Settings.TCPInactivityTimeout)
+	err = writer.Write(request, c.Settings().TCPInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
 	// Get a response
-	response, err := reader.Read(c.Settings.TCPInactivityTimeout)
+	response, err := reader.Read(c.Settings().TCPInactivityTimeout)
 	if err != nil {
 		return nil, err
 	}
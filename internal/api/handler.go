@@ -0,0 +1,145 @@
+package api
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/metrics"
+)
+
+// RESTHandler is the signature of a handler served by the REST server.
+type RESTHandler func(w rest.ResponseWriter, request *fcrmessages.FCRMessage)
+
+// P2PHandler is the signature of a handler served by the P2P server.
+type P2PHandler func(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error
+
+// GatewayRESTHandler is the signature of a REST handler serving requests for a given gateway.
+type GatewayRESTHandler func(c *core.Core, w rest.ResponseWriter, request *fcrmessages.FCRMessage)
+
+// GatewayP2PHandler is the signature of a P2P handler serving requests for a given gateway.
+type GatewayP2PHandler func(c *core.Core, reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error
+
+// P2PRequester is the signature of a requester used by the P2P server.
+type P2PRequester func(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error)
+
+// GatewayP2PRequester is the signature of a requester sending requests on behalf of a given gateway.
+type GatewayP2PRequester func(c *core.Core, reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error)
+
+// errShuttingDown is returned to the P2P server to drop connections once shutdown has started.
+var errShuttingDown = errors.New("gateway is shutting down")
+
+// WrapRESTHandler binds a REST handler to a gateway. The handler is tracked as in-flight work, and refused once
+// shutdown has started or while the gateway has not reached the required state. Requests, their latency and their
+// error responses are recorded in the metrics of the gateway.
+func WrapRESTHandler(c *core.Core, required core.State, handler GatewayRESTHandler) RESTHandler {
+	return func(w rest.ResponseWriter, request *fcrmessages.FCRMessage) {
+		rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		defer rw.observe(c, request.GetMessageType(), time.Now())
+		if !c.Drainer.Enter() {
+			logging.Warn("Refusing REST request of type %d: gateway is shutting down", request.GetMessageType())
+			apierror.WriteREST(c, rw, http.StatusServiceUnavailable, messages.ErrorUnavailable, "Gateway is shutting down.")
+			return
+		}
+		defer c.Drainer.Leave()
+		if err := c.Lifecycle.Require(required); err != nil {
+			logging.Warn("Refusing REST request of type %d: %s", request.GetMessageType(), err.Error())
+			apierror.WriteREST(c, rw, http.StatusServiceUnavailable, messages.ErrorNotInitialised, err.Error())
+			return
+		}
+		handler(c, rw, request)
+	}
+}
+
+// WrapP2PHandler binds a P2P handler to a gateway. The handler is tracked as in-flight work, and refused once
+// shutdown has started. Refused requests cause the connection to be dropped, so that the peer fails fast rather than
+// waiting for a response. Requests received while the gateway has not reached the required state get an error
+// response. Requests, their latency and dropped connections are recorded in the metrics of the gateway, error
+// responses are recorded when they are written.
+func WrapP2PHandler(c *core.Core, required core.State, handler GatewayP2PHandler) P2PHandler {
+	return func(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
+		start := time.Now()
+		defer func() {
+			c.Metrics.ObserveRequest(metrics.APIP2P, request.GetMessageType(), time.Since(start))
+		}()
+		if !c.Drainer.Enter() {
+			logging.Warn("Refusing P2P request of type %d: gateway is shutting down", request.GetMessageType())
+			c.Metrics.ObserveError(metrics.APIP2P, request.GetMessageType(), messages.ErrorUnavailable)
+			return errShuttingDown
+		}
+		defer c.Drainer.Leave()
+		if err := c.Lifecycle.Require(required); err != nil {
+			logging.Warn("Refusing P2P request of type %d: %s", request.GetMessageType(), err.Error())
+			return apierror.WriteP2P(c, writer, request, messages.ErrorNotInitialised, err.Error())
+		}
+		err := handler(c, reader, writer, request)
+		if err != nil {
+			c.Metrics.ObserveError(metrics.APIP2P, request.GetMessageType(), messages.ErrorInternal)
+		}
+		return err
+	}
+}
+
+// WrapP2PRequester binds a P2P requester to a gateway.
+func WrapP2PRequester(c *core.Core, requester GatewayP2PRequester) P2PRequester {
+	return func(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
+		return requester(c, reader, writer, args...)
+	}
+}
+
+// recordingWriter records the status and the error code of the response to a REST request.
+type recordingWriter struct {
+	rest.ResponseWriter
+	status int
+	code   messages.ErrorCode
+}
+
+// WriteHeader records the status of the response.
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// WriteJson records the error code of error responses.
+func (w *recordingWriter) WriteJson(v interface{}) error {
+	if response, ok := v.(*fcrmessages.FCRMessage); ok {
+		if code, _, err := messages.DecodeGatewayErrorResponse(response); err == nil {
+			w.code = code
+		}
+	}
+	return w.ResponseWriter.WriteJson(v)
+}
+
+// observe records the request in the metrics of the gateway.
+func (w *recordingWriter) observe(c *core.Core, msgType int32, start time.Time) {
+	c.Metrics.ObserveRequest(metrics.APIREST, msgType, time.Since(start))
+	if w.code != 0 {
+		c.Metrics.ObserveError(metrics.APIREST, msgType, w.code)
+	} else if w.status >= http.StatusBadRequest {
+		c.Metrics.ObserveError(metrics.APIREST, msgType, messages.ErrorInternal)
+	}
+}
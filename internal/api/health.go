@@ -0,0 +1,75 @@
+package api
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+)
+
+// Paths of the health endpoints.
+const (
+	LivenessPath  = "/health/live"
+	ReadinessPath = "/health/ready"
+)
+
+// liveness is the body of liveness responses.
+type liveness struct {
+	Alive bool   `json:"alive"`
+	State string `json:"state"`
+}
+
+// StartHealthServer starts an HTTP server for the liveness and readiness endpoints of a gateway on the given port.
+// The liveness endpoint always answers 200 while the process runs. The readiness endpoint answers 200 when the
+// gateway is ready to serve requests and 503 otherwise, with the outcome of each readiness check in its body.
+func StartHealthServer(c *core.Core, bind string) error {
+	ln, err := net.Listen("tcp", ":"+bind)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, &liveness{Alive: true, State: c.Lifecycle.State().String()})
+	})
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		health := c.Health()
+		status := http.StatusOK
+		if !health.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealth(w, status, health)
+	})
+	go func() {
+		logging.Error(http.Serve(ln, mux).Error())
+	}()
+	logging.Info("Health server starts listening on %s for connections.", bind)
+	return nil
+}
+
+// writeHealth writes a JSON health response.
+func writeHealth(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.Error("Error writing health response: %s", err.Error())
+	}
+}
@@ -25,18 +25,17 @@ import (
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 )
 
 // HandleProviderPublishDHTOfferRequest handles the provider publish dht offer request
-func HandleProviderPublishDHTOfferRequest(_ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
-	// Get the core structure
-	c := core.GetSingleInstance()
-
+func HandleProviderPublishDHTOfferRequest(c *core.Core, _ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
 	providerID, nonce, offers, err := fcrmessages.DecodeProviderPublishDHTOfferRequest(request)
 	if err != nil {
-		// Reply with invalid message
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Warn("Fail to decode message: %s", err.Error())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInvalidMessage, "Fail to decode message.")
 	}
 
 	// Verify the request
@@ -44,49 +43,58 @@ func HandleProviderPublishDHTOfferRequest(_ *fcrp2pserver.FCRServerReader, write
 	providerInfo := c.RegisterMgr.GetProvider(providerID)
 	if providerInfo == nil {
 		logging.Warn("Provider information not found for %s.", providerID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Provider information not found.")
 	}
 	pubKey, err := providerInfo.GetSigningKey()
 	if err != nil {
 		logging.Warn("Fail to obtain the public key for %s", providerID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Fail to obtain the public key.")
 	}
 	if request.Verify(pubKey) != nil {
+		// The sender is not penalised, anybody can send a request in its name
 		logging.Warn("Fail to verify the request from %s", providerID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorBadSignature, "Fail to verify the request.")
+	}
+	// Reject a replay of the request, the request has no ttl so its nonce is remembered for the nonce window
+	if err = c.CheckNonce(core.SenderProvider, providerID, nonce, 0); err != nil {
+		logging.Warn("Reject the request from %s: %s", providerID.ToString(), err.Error())
+		return apierror.WriteP2P(c, writer, request, apierror.NonceCode(err), "Request rejected: "+err.Error()+".")
 	}
 
 	// Verify the offer one by one
-	for _, offer := range offers {
+	for i := range offers {
+		offer := &offers[i]
 		if offer.Verify(pubKey) != nil {
 			logging.Warn("Fail to verify the offer from %s", providerID.ToString())
-			return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+			return apierror.WriteP2P(c, writer, request, messages.ErrorBadSignature, "Fail to verify the offer.")
 		}
 
-		if c.OffersMgr.AddDHTOffer(&offer) != nil {
+		if c.OffersMgr.AddDHTOffer(offer) != nil {
 			logging.Error("Internal error in adding single cid offer.")
-			return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+			return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in adding single cid offer.")
 		}
 	}
+	c.ReputationMgr.ProviderSuccessfulPublish(providerID)
 
 	// Sign the request
-	sig, err := fcrcrypto.SignMessage(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion, request.GetMessageBody())
+	privKey, privKeyVer := c.SigningKey()
+	sig, err := fcrcrypto.SignMessage(privKey, privKeyVer, request.GetMessageBody())
 	if err != nil {
 		logging.Error("Internal error in signing message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in signing message.")
 	}
 
 	// Construct response
 	response, err := fcrmessages.EncodeProviderPublishDHTOfferResponse(nonce, sig)
 	if err != nil {
 		logging.Error("Internal error in encoding message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in encoding message.")
 	}
 	// Sign the response
-	if response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if response.Sign(c.SigningKey()) != nil {
 		logging.Error("Internal error in signing message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in signing message.")
 	}
 
-	return writer.Write(response, c.Settings.TCPInactivityTimeout)
+	return writer.Write(response, c.Settings().TCPInactivityTimeout)
 }
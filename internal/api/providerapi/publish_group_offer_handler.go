@@ -16,7 +16,9 @@ package providerapi
  */
 
 import (
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/apierror"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
 
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
@@ -24,15 +26,12 @@ import (
 )
 
 // HandleProviderPublishGroupOfferRequest handles the provider publish group offer request
-func HandleProviderPublishGroupOfferRequest(_ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
-	// Get the core structure
-	c := core.GetSingleInstance()
-
+func HandleProviderPublishGroupOfferRequest(c *core.Core, _ *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, request *fcrmessages.FCRMessage) error {
 	// TODO Add nonce, it looks like nonce is not needed
 	providerID, _, offer, err := fcrmessages.DecodeProviderPublishGroupOfferRequest(request)
 	if err != nil {
-		// Reply with invalid message
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		logging.Warn("Fail to decode message: %s", err.Error())
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInvalidMessage, "Fail to decode message.")
 	}
 
 	// Verify the request
@@ -40,29 +39,31 @@ func HandleProviderPublishGroupOfferRequest(_ *fcrp2pserver.FCRServerReader, wri
 	providerInfo := c.RegisterMgr.GetProvider(providerID)
 	if providerInfo == nil {
 		logging.Warn("Provider information not found for %s.", providerID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Provider information not found.")
 	}
 	pubKey, err := providerInfo.GetSigningKey()
 	if err != nil {
 		logging.Warn("Fail to obtain the public key for %s", providerID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorUnknownSender, "Fail to obtain the public key.")
 	}
 	if request.Verify(pubKey) != nil {
+		// The sender is not penalised, anybody can send a request in its name
 		logging.Warn("Fail to verify the request from %s", providerID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorBadSignature, "Fail to verify the request.")
 	}
 
 	// Verify the offer
 	if offer.Verify(pubKey) != nil {
 		logging.Warn("Fail to verify the offer from %s", providerID.ToString())
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorBadSignature, "Fail to verify the offer.")
 	}
 
 	// Store the offer
 	if c.OffersMgr.AddGroupOffer(offer) != nil {
 		logging.Error("Internal error in adding group cid offer.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in adding group cid offer.")
 	}
+	c.ReputationMgr.ProviderSuccessfulPublish(providerID)
 
 	// Construct the response
 	response, err := fcrmessages.EncodeProviderPublishGroupOfferResponse(
@@ -71,14 +72,14 @@ func HandleProviderPublishGroupOfferRequest(_ *fcrp2pserver.FCRServerReader, wri
 	)
 	if err != nil {
 		logging.Error("Internal error in encoding message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in encoding message.")
 	}
 
 	// Sign the response
-	if response.Sign(c.GatewayPrivateKey, c.GatewayPrivateKeyVersion) != nil {
+	if response.Sign(c.SigningKey()) != nil {
 		logging.Error("Internal error in signing message.")
-		return writer.WriteInvalidMessage(c.Settings.TCPInactivityTimeout)
+		return apierror.WriteP2P(c, writer, request, messages.ErrorInternal, "Internal error in signing message.")
 	}
 
-	return writer.Write(response, c.Settings.TCPInactivityTimeout)
+	return writer.Write(response, c.Settings().TCPInactivityTimeout)
 }
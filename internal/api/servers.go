@@ -0,0 +1,110 @@
+package api
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrrestserver"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/adminapi"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/clientapi"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/gatewayapi"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api/providerapi"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+// StartServers creates the REST and P2P servers of a gateway, adds the handlers and requesters of the gateway to
+// them, and starts them together with the metrics and health endpoints. The register manager of the gateway must
+// have been created.
+func StartServers(c *core.Core) error {
+	// Start the health endpoints first, so that orchestrators can tell a gateway that is starting from a dead one
+	if c.Settings().BindHealthAPI != "" {
+		if err := StartHealthServer(c, c.Settings().BindHealthAPI); err != nil {
+			return fmt.Errorf("error starting health server: %s", err.Error())
+		}
+	}
+
+	// Create REST Server
+	c.RESTServer = fcrrestserver.NewFCRRESTServer(
+		[]string{c.Settings().BindAdminAPI, c.Settings().BindRestAPI})
+
+	// Add handlers to the REST Server
+	c.RESTServer.
+		// client api
+		AddHandler(c.Settings().BindRestAPI, fcrmessages.ClientEstablishmentRequestType, WrapRESTHandler(c, clientapi.RequiredState, clientapi.HandleClientEstablishmentRequest)).
+		AddHandler(c.Settings().BindRestAPI, fcrmessages.ClientDHTDiscoverRequestType, WrapRESTHandler(c, clientapi.RequiredState, clientapi.HandleClientDHTCIDDiscoverRequest)).
+		AddHandler(c.Settings().BindRestAPI, fcrmessages.ClientDHTDiscoverOfferRequestType, WrapRESTHandler(c, clientapi.PaidRequiredState, clientapi.HandleClientDHTDiscoverOfferRequest)).
+		AddHandler(c.Settings().BindRestAPI, fcrmessages.ClientDHTDiscoverRequestV2Type, WrapRESTHandler(c, clientapi.PaidRequiredState, clientapi.HandleClientDHTCIDDiscoverRequestV2)).
+		AddHandler(c.Settings().BindRestAPI, fcrmessages.ClientStandardDiscoverOfferRequestType, WrapRESTHandler(c, clientapi.PaidRequiredState, clientapi.HandleClientStandardDiscoverOfferRequest)).
+		AddHandler(c.Settings().BindRestAPI, fcrmessages.ClientStandardDiscoverRequestType, WrapRESTHandler(c, clientapi.RequiredState, clientapi.HandleClientStandardCIDDiscoverRequest)).
+		AddHandler(c.Settings().BindRestAPI, fcrmessages.ClientStandardDiscoverRequestV2Type, WrapRESTHandler(c, clientapi.PaidRequiredState, clientapi.HandleClientStandardCIDDiscoverRequestV2)).
+		AddHandler(c.Settings().BindRestAPI, messages.ClientPriceQuoteRequestType, WrapRESTHandler(c, clientapi.RequiredState, clientapi.HandleClientPriceQuoteRequest)).
+		// admin api
+		AddHandler(c.Settings().BindAdminAPI, fcrmessages.GatewayAdminInitialiseKeyRequestType, WrapAdminHandler(c, adminapi.InitialiseRequiredState, adminapi.HandleGatewayAdminInitialiseKeyRequest)).
+		AddHandler(c.Settings().BindAdminAPI, fcrmessages.GatewayAdminInitialiseKeyRequestV2Type, WrapAdminHandler(c, adminapi.InitialiseRequiredState, adminapi.HandleGatewayAdminInitialiseKeyRequestV2)).
+		AddHandler(c.Settings().BindAdminAPI, fcrmessages.GatewayAdminGetReputationRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminGetReputationRequest)).
+		AddHandler(c.Settings().BindAdminAPI, fcrmessages.GatewayAdminSetReputationRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminSetReputationRequest)).
+		AddHandler(c.Settings().BindAdminAPI, fcrmessages.GatewayAdminForceRefreshRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminForceRefreshRequest)).
+		AddHandler(c.Settings().BindAdminAPI, fcrmessages.GatewayAdminListDHTOfferRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminListDHTOffersRequest)).
+		AddHandler(c.Settings().BindAdminAPI, fcrmessages.GatewayAdminUpdateGatewayGroupCIDOfferSupportRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminUpdateGatewayGroupCIDOfferSupportRequest)).
+		AddHandler(c.Settings().BindAdminAPI, messages.GatewayAdminWipeKeysRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminWipeKeysRequest)).
+		AddHandler(c.Settings().BindAdminAPI, messages.GatewayAdminRotateKeyRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminRotateKeyRequest)).
+		AddHandler(c.Settings().BindAdminAPI, messages.GatewayAdminReloadSettingsRequestType, WrapAdminHandler(c, adminapi.RequiredState, adminapi.HandleGatewayAdminReloadSettingsRequest))
+
+	// Start REST Server
+	if err := c.RESTServer.Start(); err != nil {
+		return fmt.Errorf("error starting REST server: %s", err.Error())
+	}
+
+	// Create P2P Server
+	c.P2PServer = fcrp2pserver.NewFCRP2PServer(
+		[]string{c.Settings().BindGatewayAPI, c.Settings().BindProviderAPI},
+		c.RegisterMgr,
+		c.Settings().TCPInactivityTimeout)
+
+	// Add handlers and requesters to the P2P Server
+	c.P2PServer.
+		// gateway api
+		AddHandler(c.Settings().BindGatewayAPI, fcrmessages.GatewayDHTDiscoverRequestType, WrapP2PHandler(c, gatewayapi.RequiredState, gatewayapi.HandleGatewayDHTDiscoverRequest)).
+		AddHandler(c.Settings().BindGatewayAPI, fcrmessages.GatewayDHTDiscoverRequestV2Type, WrapP2PHandler(c, gatewayapi.PaidRequiredState, gatewayapi.HandleGatewayDHTDiscoverRequestV2)).
+		AddHandler(c.Settings().BindGatewayAPI, fcrmessages.GatewayDHTDiscoverOfferRequestType, WrapP2PHandler(c, gatewayapi.PaidRequiredState, gatewayapi.HandleGatewayDHTOfferRequest)).
+		AddRequester(fcrmessages.GatewayDHTDiscoverRequestType, WrapP2PRequester(c, gatewayapi.RequestGatewayDHTDiscover)).
+		AddRequester(fcrmessages.GatewayDHTDiscoverRequestV2Type, WrapP2PRequester(c, gatewayapi.RequestGatewayDHTDiscoverV2)).
+		AddRequester(fcrmessages.GatewayListDHTOfferRequestType, WrapP2PRequester(c, gatewayapi.RequestListCIDOffer)).
+		AddRequester(fcrmessages.GatewayNotifyProviderGroupCIDOfferSupportedRequestType, WrapP2PRequester(c, gatewayapi.NotifyProviderGroupCIDOfferSupported)).
+		AddRequester(fcrmessages.GatewayDHTDiscoverOfferRequestType, WrapP2PRequester(c, gatewayapi.RequestGatewayDHTDiscoverOffer)).
+		// provider api
+		AddHandler(c.Settings().BindProviderAPI, fcrmessages.ProviderPublishGroupOfferRequestType, WrapP2PHandler(c, providerapi.RequiredState, providerapi.HandleProviderPublishGroupOfferRequest)).
+		AddHandler(c.Settings().BindProviderAPI, fcrmessages.ProviderPublishDHTOfferRequestType, WrapP2PHandler(c, providerapi.RequiredState, providerapi.HandleProviderPublishDHTOfferRequest))
+
+	// Start P2P Server
+	if err := c.P2PServer.Start(); err != nil {
+		return fmt.Errorf("error starting P2P server: %s", err.Error())
+	}
+	c.Readiness.SetP2PListening()
+
+	// Start the metrics endpoint
+	if c.Settings().BindMetricsAPI != "" {
+		if err := c.Metrics.Start(c.Settings().BindMetricsAPI); err != nil {
+			return fmt.Errorf("error starting metrics server: %s", err.Error())
+		}
+	}
+	return nil
+}
@@ -21,19 +21,26 @@ package core
 
 import (
 	"encoding/json"
+	"fmt"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmerkletree"
-	fcroffermgr "github.com/ConsenSys/fc-retrieval-common/pkg/offermgr"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
-	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrpaymentmgr"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrregistermgr"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrrestserver"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
 
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/keystore"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/metrics"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/offerstore"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/pricing"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/reputation"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
 	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
 )
 
@@ -48,17 +55,21 @@ type Core struct {
 	ProtocolVersion   int32
 	ProtocolSupported []int32
 
-	// Settings
-	Settings *settings.AppSettings
+	// settings holds the current settings snapshot, replaced as a whole when the settings are reloaded
+	settings atomic.Value
+
+	// SettingsLoader reads the settings again when they are reloaded, settings cannot be reloaded if it is nil
+	SettingsLoader func() (*settings.AppSettings, error)
+	reloadLock     sync.Mutex
 
 	// GatewayID of this gateway
 	GatewayID *nodeid.NodeID
 
-	// Gateway Private Key and algorithm of this gateway
-	GatewayPrivateKey *fcrcrypto.KeyPair
+	// SigningKeys holds the private key the gateway signs with, and the key version it rotates to
+	SigningKeys *SigningKeys
 
-	// GatewayPrivateKeyVersion is the key version number of the private key.
-	GatewayPrivateKeyVersion *fcrcrypto.KeyVersion
+	// PeerKeys verifies the messages of peer gateways, accepting their previous key while they rotate their key
+	PeerKeys *PeerKeys
 
 	// RegisterMgr manages all register related activities
 	RegisterMgr *fcrregistermgr.FCRRegisterMgr
@@ -69,14 +80,29 @@ type Core struct {
 	// RESTServer handles all communication to/from client/admin
 	RESTServer *fcrrestserver.FCRRESTServer
 
-	// Offer Manager
-	OffersMgr *fcroffermgr.FCROfferMgr
+	// Offer Manager, backed by a durable offer store
+	OffersMgr *offerstore.OfferMgr
 
 	// Reputation Manager
 	ReputationMgr *reputation.Reputation
 
 	// PaymentMgr manages all payment related activities
-	PaymentMgr *fcrpaymentmgr.FCRPaymentMgr
+	PaymentMgr payment.Manager
+
+	// Pricing prices the paid requests, and the requests paid to peer gateways
+	Pricing pricing.Policy
+
+	// PeerPrices holds the prices published by the peer gateways in the register
+	PeerPrices *pricing.PeerPrices
+
+	// Quotes holds the price quotes given to clients until they expire
+	Quotes *pricing.QuoteMgr
+
+	// PaymentRequestMgr issues payment requests to nodes that have not paid enough for a request
+	PaymentRequestMgr *payment.RequestMgr
+
+	// ChannelStates caches the state of the payment channels from this gateway to other nodes
+	ChannelStates *payment.ChannelStates
 
 	// RegistrationBlockHash is the hash of the block that registers this gateway
 	// RegistrationTransactionReceipt is the transaction receipt containing the registration event
@@ -89,13 +115,50 @@ type Core struct {
 
 	// GroupCIDOfferSupported indicates from which Providers the Gateway supports group CID offers
 	GroupCIDOfferSupportedForProviders []nodeid.NodeID
+
+	// Drainer tracks in-flight requests so that they can be drained on shutdown
+	Drainer *util.Drainer
+
+	// Lifecycle tracks the state of the gateway, requests are only served once the gateway reaches the state they
+	// require
+	Lifecycle *Lifecycle
+
+	// ClientThrottle limits the request rate of clients with a low reputation
+	ClientThrottle *util.Throttle
+
+	// Keystore persists the keys supplied by the admin, keys are not persisted if it is nil
+	Keystore *keystore.Keystore
+	// identity is the identity last supplied by the admin, as persisted in the keystore
+	identity     keystore.Identity
+	identityLock sync.Mutex
+
+	// AdminPublicKey verifies the signature of admin requests, admin requests are refused if it is nil
+	AdminPublicKey *fcrcrypto.KeyPair
+
+	// AdminReplayGuard rejects admin requests whose nonce has already been used
+	AdminReplayGuard *util.ReplayGuard
+
+	// NonceCache rejects client, gateway and provider messages whose nonce has already been used by their sender
+	NonceCache *util.ReplayGuard
+
+	// Metrics holds the metrics of the gateway, exposed to Prometheus
+	Metrics *metrics.Metrics
+
+	// Readiness records whether the P2P server listens and when the register service was last read
+	Readiness *Readiness
+
+	// stopRegisterSync stops the routine reading the register service, registerSyncDone is closed once it has stopped
+	stopRegisterSync chan bool
+	registerSyncDone chan bool
 }
 
 // Single instance of the gateway
 var instance *Core
 var doOnce sync.Once
 
-// GetSingleInstance returns the single instance of the gateway
+// GetSingleInstance returns the single instance of the gateway. The single instance is optional: it is only
+// created for the process that calls GetSingleInstance with settings, other code should be passed the gateway
+// returned by NewCore.
 func GetSingleInstance(confs ...*settings.AppSettings) *Core {
 	doOnce.Do(func() {
 		if len(confs) == 0 {
@@ -104,38 +167,122 @@ func GetSingleInstance(confs ...*settings.AppSettings) *Core {
 		if len(confs) != 1 {
 			logging.ErrorAndPanic("More than one sets of settings supplied to Gateway start-up")
 		}
+		var err error
+		instance, err = NewCore(confs[0])
+		if err != nil {
+			logging.ErrorAndPanic("Error creating gateway: %s", err.Error())
+		}
+	})
+	return instance
+}
+
+// NewCore creates a gateway with the given settings. Several gateways can be created in the same process, as long
+// as they use different data directories and bind addresses.
+func NewCore(conf *settings.AppSettings) (*Core, error) {
+	var mockProof fcrmerkletree.FCRMerkleProof
+	err := json.Unmarshal([]byte{
+		34, 65, 65, 65, 65, 77, 70, 115,
+		105, 81, 85, 70, 66, 81, 85, 70,
+		66, 81, 85, 70, 66, 81, 85, 70,
+		66, 81, 85, 70, 66, 81, 85, 70,
+		66, 81, 85, 70, 66, 81, 85, 70,
+		66, 81, 85, 70, 66, 81, 85, 70,
+		66, 81, 85, 70, 66, 81, 85, 70,
+		66, 81, 85, 70, 66, 81, 85, 70,
+		66, 82, 84, 48, 105, 88, 81, 65,
+		65, 65, 65, 78, 98, 77, 86, 48,
+		61, 34}, &mockProof)
+	if err != nil {
+		return nil, err
+	}
 
-		var mockProof fcrmerkletree.FCRMerkleProof
-		err := json.Unmarshal([]byte{
-			34, 65, 65, 65, 65, 77, 70, 115,
-			105, 81, 85, 70, 66, 81, 85, 70,
-			66, 81, 85, 70, 66, 81, 85, 70,
-			66, 81, 85, 70, 66, 81, 85, 70,
-			66, 81, 85, 70, 66, 81, 85, 70,
-			66, 81, 85, 70, 66, 81, 85, 70,
-			66, 81, 85, 70, 66, 81, 85, 70,
-			66, 81, 85, 70, 66, 81, 85, 70,
-			66, 82, 84, 48, 105, 88, 81, 65,
-			65, 65, 65, 78, 98, 77, 86, 48,
-			61, 34}, &mockProof)
+	offerStore, err := offerstore.NewStore(conf.OfferStore, filepath.Join(conf.DataDir, "offers"))
+	if err != nil {
+		return nil, fmt.Errorf("error opening offer store: %s", err.Error())
+	}
+
+	reputationBackend, err := reputation.NewFileBackend(conf.ReputationDir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening reputation directory: %s", err.Error())
+	}
+	reputationMgr, err := reputation.NewReputation(reputationBackend)
+	if err != nil {
+		return nil, fmt.Errorf("error restoring reputation: %s", err.Error())
+	}
+	reputationMgr.StartSnapshots(conf.ReputationSnapshotInterval)
+
+	var keys *keystore.Keystore
+	passphrase, err := keystore.Passphrase(conf.KeystorePassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		logging.Warn("No keystore passphrase configured (KEYSTORE_PASSPHRASE or KEYSTORE_PASSPHRASE_FILE): keys will not be persisted")
+	} else {
+		keys, err = keystore.NewKeystore(conf.KeystoreFile, passphrase)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+	}
 
-		instance = &Core{
-			ProtocolVersion:                protocolVersion,
-			ProtocolSupported:              []int32{protocolVersion, protocolSupported},
-			Settings:                       confs[0],
-			GatewayID:                      nil,
-			GatewayPrivateKey:              nil,
-			GatewayPrivateKeyVersion:       nil,
-			OffersMgr:                      fcroffermgr.NewFCROfferMgr(),
-			ReputationMgr:                  reputation.GetSingleInstance(),
-			RegistrationBlockHash:          "TODO",
-			RegistrationTransactionReceipt: "TODO",
-			RegistrationMerkleRoot:         "TODO",
-			RegistrationMerkleProof:        &mockProof, //TODO
+	var adminPublicKey *fcrcrypto.KeyPair
+	if conf.AdminPublicKey == "" {
+		logging.Warn("No admin public key configured (ADMIN_PUBLIC_KEY): admin requests will be refused")
+	} else {
+		adminPublicKey, err = fcrcrypto.DecodePublicKey(conf.AdminPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding admin public key: %s", err.Error())
 		}
-	})
-	return instance
+	}
+
+	paymentRequestMgr := payment.NewRequestMgr(conf.PaymentRequestTTL, conf.PaymentRequestLimit, conf.PaymentRequestPayerLimit)
+	if err = paymentRequestMgr.Load(paymentRequestsFile(conf)); err != nil {
+		return nil, fmt.Errorf("error restoring payment requests: %s", err.Error())
+	}
+
+	offersMgr := offerstore.NewOfferMgr(offerStore)
+	gatewayMetrics := metrics.NewMetrics()
+	gatewayMetrics.WatchOffers(offersMgr)
+	gatewayMetrics.WatchReputation(reputationMgr)
+
+	c := &Core{
+		ProtocolVersion:                protocolVersion,
+		ProtocolSupported:              []int32{protocolVersion, protocolSupported},
+		GatewayID:                      nil,
+		SigningKeys:                    NewSigningKeys(),
+		PeerKeys:                       NewPeerKeys(conf.KeyGraceWindow),
+		OffersMgr:                      offersMgr,
+		ReputationMgr:                  reputationMgr,
+		PeerPrices:                     pricing.NewPeerPrices(),
+		Quotes:                         pricing.NewQuoteMgr(),
+		PaymentRequestMgr:              paymentRequestMgr,
+		ChannelStates:                  payment.NewChannelStates(),
+		RegistrationBlockHash:          "TODO",
+		RegistrationTransactionReceipt: "TODO",
+		RegistrationMerkleRoot:         "TODO",
+		RegistrationMerkleProof:        &mockProof, //TODO
+		Drainer:                        util.NewDrainer(),
+		Lifecycle:                      NewLifecycle(),
+		ClientThrottle:                 util.NewThrottle(),
+		AdminPublicKey:                 adminPublicKey,
+		Keystore:                       keys,
+		AdminReplayGuard:               util.NewReplayGuard(conf.NonceCacheSize),
+		NonceCache:                     util.NewReplayGuard(conf.NonceCacheSize),
+		Metrics:                        gatewayMetrics,
+		Readiness:                      NewReadiness(),
+	}
+	c.settings.Store(conf)
+	c.Pricing = pricing.NewRules(c.Settings, c.Drainer.InFlight, reputationMgr, c.PeerPrices)
+	return c, nil
+}
+
+// paymentRequestsFile returns the file the outstanding payment requests and the credits of payers are flushed to.
+func paymentRequestsFile(conf *settings.AppSettings) string {
+	return filepath.Join(conf.DataDir, "payment_requests.json")
+}
+
+// SigningKey returns the private key the gateway signs with, and its version. It returns nil if the keys have not
+// been initialised by the admin.
+func (c *Core) SigningKey() (*fcrcrypto.KeyPair, *fcrcrypto.KeyVersion) {
+	return c.SigningKeys.Current()
 }
@@ -0,0 +1,59 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+func testSettings(t *testing.T) *settings.AppSettings {
+	dir := t.TempDir()
+	return &settings.AppSettings{
+		DataDir:       dir,
+		OfferStore:    settings.DefaultOfferStore,
+		ReputationDir: filepath.Join(dir, "reputation"),
+
+		ReputationSnapshotInterval: time.Minute,
+	}
+}
+
+func TestNewCoreCreatesIndependentGateways(t *testing.T) {
+	c1, err := NewCore(testSettings(t))
+	assert.Empty(t, err)
+	c2, err := NewCore(testSettings(t))
+	assert.Empty(t, err)
+
+	assert.NotSame(t, c1, c2)
+	assert.NotSame(t, c1.OffersMgr, c2.OffersMgr)
+	assert.NotSame(t, c1.ReputationMgr, c2.ReputationMgr)
+	assert.NotSame(t, c1.Drainer, c2.Drainer)
+
+	assert.Empty(t, c1.FlushState())
+	assert.Empty(t, c2.FlushState())
+}
+
+func TestNewCoreRejectsInvalidSettings(t *testing.T) {
+	conf := testSettings(t)
+	conf.OfferStore = "unknown"
+	_, err := NewCore(conf)
+	assert.NotEmpty(t, err)
+}
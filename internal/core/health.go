@@ -0,0 +1,140 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"sync"
+	"time"
+)
+
+// Names of the readiness checks of a gateway.
+const (
+	HealthCheckLifecycle = "lifecycle"
+	HealthCheckKeys      = "keys"
+	HealthCheckPayment   = "payment"
+	HealthCheckRegister  = "register"
+	HealthCheckP2P       = "p2p"
+)
+
+// HealthCheck is the outcome of one readiness check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Health is the status of a gateway, as reported to operators and orchestrators.
+type Health struct {
+	Ready     bool          `json:"ready"`
+	State     string        `json:"state"`
+	GatewayID string        `json:"gateway_id,omitempty"`
+	Checks    []HealthCheck `json:"checks"`
+}
+
+// Readiness records the state of the parts of the gateway that can not be queried when a readiness check is made:
+// whether the P2P server listens, and when the register service was last read. It is safe for concurrent use.
+type Readiness struct {
+	lock           sync.RWMutex
+	p2pListening   bool
+	registerSynced time.Time // Time of the last successful read of the register service
+	registerErr    error     // Error of the last read of the register service, nil if it succeeded
+}
+
+// NewReadiness creates the readiness of a gateway that has not started its servers.
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// SetP2PListening records that the P2P server listens for connections.
+func (r *Readiness) SetP2PListening() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.p2pListening = true
+}
+
+// RecordRegisterSync records the outcome of a read of the register service.
+func (r *Readiness) RecordRegisterSync(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.registerErr = err
+	if err == nil {
+		r.registerSynced = time.Now()
+	}
+}
+
+// Health returns the status of the gateway. The gateway is ready when it is serving, its key and payment manager
+// are initialised, its P2P server listens and it has read the register service within REGISTER_SYNC_MAX_AGE.
+func (c *Core) Health() *Health {
+	c.Readiness.lock.RLock()
+	p2pListening := c.Readiness.p2pListening
+	registerSynced := c.Readiness.registerSynced
+	registerErr := c.Readiness.registerErr
+	c.Readiness.lock.RUnlock()
+
+	state := c.Lifecycle.State()
+	health := &Health{State: state.String()}
+	if c.GatewayID != nil {
+		health.GatewayID = c.GatewayID.ToString()
+	}
+	check := func(name string, ok bool, detail string) {
+		health.Checks = append(health.Checks, HealthCheck{Name: name, OK: ok, Detail: detail})
+	}
+
+	if state == StateServing {
+		check(HealthCheckLifecycle, true, "")
+	} else {
+		check(HealthCheckLifecycle, false, "gateway is "+state.String())
+	}
+
+	if key, _ := c.SigningKey(); key != nil {
+		check(HealthCheckKeys, true, "")
+	} else {
+		check(HealthCheckKeys, false, "key not initialised")
+	}
+
+	if c.PaymentMgr != nil {
+		check(HealthCheckPayment, true, "")
+	} else {
+		check(HealthCheckPayment, false, "payment manager not initialised")
+	}
+
+	switch {
+	case registerSynced.IsZero() && registerErr != nil:
+		check(HealthCheckRegister, false, "register never read: "+registerErr.Error())
+	case registerSynced.IsZero():
+		check(HealthCheckRegister, false, "register never read")
+	case time.Since(registerSynced) > c.Settings().RegisterSyncMaxAge:
+		detail := "register last read " + time.Since(registerSynced).Round(time.Second).String() + " ago"
+		if registerErr != nil {
+			detail += ": " + registerErr.Error()
+		}
+		check(HealthCheckRegister, false, detail)
+	default:
+		check(HealthCheckRegister, true, "")
+	}
+
+	if p2pListening {
+		check(HealthCheckP2P, true, "")
+	} else {
+		check(HealthCheckP2P, false, "P2P server not listening")
+	}
+
+	health.Ready = true
+	for _, result := range health.Checks {
+		health.Ready = health.Ready && result.OK
+	}
+	return health
+}
@@ -0,0 +1,79 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failedChecks returns the names of the readiness checks that failed.
+func failedChecks(health *Health) []string {
+	var failed []string
+	for _, check := range health.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+func TestHealthBeforeStartup(t *testing.T) {
+	c, err := NewCore(testSettings(t))
+	require.NoError(t, err)
+	defer c.FlushState()
+
+	health := c.Health()
+	assert.False(t, health.Ready)
+	assert.Equal(t, StateUninitialised.String(), health.State)
+	assert.Equal(t, []string{HealthCheckLifecycle, HealthCheckKeys, HealthCheckPayment, HealthCheckRegister, HealthCheckP2P}, failedChecks(health))
+}
+
+func TestHealthRegisterFreshness(t *testing.T) {
+	available := int32(1)
+	register := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer register.Close()
+
+	conf := testSettings(t)
+	conf.RegisterAPIURL = register.URL
+	conf.RegisterSyncMaxAge = 50 * time.Millisecond
+	c, err := NewCore(conf)
+	require.NoError(t, err)
+	defer c.FlushState()
+	c.Readiness.SetP2PListening()
+
+	c.RefreshRegister()
+	assert.NotContains(t, failedChecks(c.Health()), HealthCheckRegister)
+
+	// A failed read does not make the gateway unready until the last successful read is too old.
+	atomic.StoreInt32(&available, 0)
+	c.RefreshRegister()
+	assert.NotContains(t, failedChecks(c.Health()), HealthCheckRegister)
+	time.Sleep(2 * conf.RegisterSyncMaxAge)
+	assert.Contains(t, failedChecks(c.Health()), HealthCheckRegister)
+}
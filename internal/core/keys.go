@@ -0,0 +1,240 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/keystore"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/metrics"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+// InitialiseKey sets the identity and signing key of the gateway. They are persisted by SaveKeys.
+func (c *Core) InitialiseKey(nodeID *nodeid.NodeID, privKey *fcrcrypto.KeyPair, privKeyVer *fcrcrypto.KeyVersion) {
+	c.setKey(nodeID, privKey, privKeyVer)
+
+	c.identityLock.Lock()
+	defer c.identityLock.Unlock()
+	c.identity.NodeID = nodeID.ToString()
+	c.identity.PrivateKey = privKey.EncodePrivateKey()
+	c.identity.PrivateKeyVersion = privKeyVer.EncodeKeyVersion()
+	c.identity.PendingPrivateKey = ""
+	c.identity.PendingPrivateKeyVersion = 0
+	c.identity.PendingActivation = 0
+}
+
+// RotateKey schedules the rotation of the signing key to a new key version. The new key is published to the register
+// at the activation time, and the gateway signs with it one register refresh later, so that peers have read the new
+// key by the time it is used. Until then, peers that have read the new key still accept the previous key within the
+// grace window. The rotation is persisted by SaveKeys.
+func (c *Core) RotateKey(privKey *fcrcrypto.KeyPair, privKeyVer *fcrcrypto.KeyVersion, activation time.Time) error {
+	minDelay := c.Settings().KeyActivationMinDelay
+	if minDelay < c.Settings().RegisterRefreshDuration {
+		minDelay = c.Settings().RegisterRefreshDuration
+	}
+	delay := time.Until(activation)
+	if delay < minDelay {
+		return fmt.Errorf("activation must be at least %s from now", minDelay)
+	}
+	if delay > c.Settings().KeyGraceWindow {
+		return fmt.Errorf("activation must be at most %s from now", c.Settings().KeyGraceWindow)
+	}
+
+	if c.RegisterMgr == nil || c.RegisterMgr.GetGateway(c.GatewayID) == nil {
+		return errors.New("gateway not found in the register")
+	}
+
+	if err := c.SigningKeys.Schedule(privKey, privKeyVer, activation.Add(c.Settings().RegisterRefreshDuration)); err != nil {
+		return err
+	}
+
+	currentKey, currentVer := c.SigningKeys.Current()
+	c.identityLock.Lock()
+	defer c.identityLock.Unlock()
+	c.identity.PrivateKey = currentKey.EncodePrivateKey()
+	c.identity.PrivateKeyVersion = currentVer.EncodeKeyVersion()
+	c.identity.PendingPrivateKey = privKey.EncodePrivateKey()
+	c.identity.PendingPrivateKeyVersion = privKeyVer.EncodeKeyVersion()
+	c.identity.PendingActivation = activation.Unix()
+	time.AfterFunc(time.Until(activation), c.publishPendingKey)
+	logging.Info("Signing key rotates to version %d at %s", privKeyVer.EncodeKeyVersion(), activation.String())
+	return nil
+}
+
+// InitialisePayment creates the payment manager of the gateway, paying from the given wallet. The wallet key and
+// lotus credentials are persisted by SaveKeys.
+func (c *Core) InitialisePayment(walletPrivKey string, lotusAPIAddr string, lotusAuthToken string) error {
+	if err := c.setPayment(walletPrivKey, lotusAPIAddr, lotusAuthToken); err != nil {
+		return err
+	}
+
+	c.identityLock.Lock()
+	defer c.identityLock.Unlock()
+	c.identity.WalletPrivateKey = walletPrivKey
+	c.identity.LotusAPIAddr = lotusAPIAddr
+	c.identity.LotusAuthToken = lotusAuthToken
+	return nil
+}
+
+// SaveKeys persists the keys supplied by the admin in the keystore, if there is one.
+func (c *Core) SaveKeys() error {
+	if c.Keystore == nil {
+		return nil
+	}
+	c.identityLock.Lock()
+	id := c.identity
+	c.identityLock.Unlock()
+	return c.Keystore.Save(&id)
+}
+
+// LoadKeys initialises the keys of the gateway from the keystore, if keys have been persisted. It is called at
+// start-up, so that the admin does not need to initialise the keys again after a restart.
+func (c *Core) LoadKeys() error {
+	if c.Keystore == nil {
+		return nil
+	}
+	id, err := c.Keystore.Load()
+	if err != nil {
+		return err
+	}
+	if id == nil {
+		logging.Info("No keys in the keystore, waiting for the admin to initialise the keys")
+		return nil
+	}
+
+	nodeID, err := nodeid.NewNodeIDFromHexString(id.NodeID)
+	if err != nil {
+		return fmt.Errorf("invalid node id in keystore: %s", err.Error())
+	}
+	privKey, err := fcrcrypto.DecodePrivateKey(id.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid private key in keystore: %s", err.Error())
+	}
+	c.setKey(nodeID, privKey, fcrcrypto.DecodeKeyVersion(id.PrivateKeyVersion))
+	if id.HasPendingKey() {
+		pendingKey, err := fcrcrypto.DecodePrivateKey(id.PendingPrivateKey)
+		if err != nil {
+			return fmt.Errorf("invalid pending private key in keystore: %s", err.Error())
+		}
+		pendingVer := fcrcrypto.DecodeKeyVersion(id.PendingPrivateKeyVersion)
+		activation := time.Unix(id.PendingActivation, 0)
+		if err = c.SigningKeys.Schedule(pendingKey, pendingVer, activation.Add(c.Settings().RegisterRefreshDuration)); err != nil {
+			return fmt.Errorf("invalid pending private key in keystore: %s", err.Error())
+		}
+		time.AfterFunc(time.Until(activation), c.publishPendingKey)
+	}
+	if id.HasPayment() {
+		if err = c.setPayment(id.WalletPrivateKey, id.LotusAPIAddr, id.LotusAuthToken); err != nil {
+			return err
+		}
+	}
+
+	c.identityLock.Lock()
+	c.identity = *id
+	c.identityLock.Unlock()
+	logging.Info("Loaded keys of gateway %s from the keystore", id.NodeID)
+	return nil
+}
+
+// WipeKeys removes the keys from the keystore. The keys in use are kept until the gateway stops, after which the
+// admin must initialise the keys again.
+func (c *Core) WipeKeys() error {
+	c.identityLock.Lock()
+	defer c.identityLock.Unlock()
+	c.identity = keystore.Identity{}
+	if c.Keystore == nil {
+		return nil
+	}
+	return c.Keystore.Wipe()
+}
+
+// setKey sets the identity and signing key of the gateway.
+func (c *Core) setKey(nodeID *nodeid.NodeID, privKey *fcrcrypto.KeyPair, privKeyVer *fcrcrypto.KeyVersion) {
+	c.GatewayID = nodeID
+	c.SigningKeys.Set(privKey, privKeyVer)
+	c.Lifecycle.SetKeyed()
+}
+
+// publishPendingKey publishes the key version the gateway rotates to in the register, once its activation time has
+// come and if the register does not hold it yet. It is called at the activation time and every time the register is
+// read, so that a publication that failed, or fell due while the gateway was stopped, is retried.
+func (c *Core) publishPendingKey() {
+	c.identityLock.Lock()
+	pending, activation := c.identity.PendingPrivateKey, time.Unix(c.identity.PendingActivation, 0)
+	c.identityLock.Unlock()
+	if pending == "" || time.Now().Before(activation) || c.RegisterMgr == nil || c.GatewayID == nil {
+		return
+	}
+	privKey, err := fcrcrypto.DecodePrivateKey(pending)
+	if err != nil {
+		logging.Error("Invalid pending signing key: %s", err.Error())
+		return
+	}
+	pubKey, err := privKey.EncodePublicKey()
+	if err != nil {
+		logging.Error("Invalid pending signing key: %s", err.Error())
+		return
+	}
+	if gateway := c.RegisterMgr.GetGateway(c.GatewayID); gateway != nil {
+		if registered, err := gateway.GetSigningKey(); err == nil {
+			if encoded, err := registered.EncodePublicKey(); err == nil && encoded == pubKey {
+				return
+			}
+		}
+	}
+	if err = c.publishSigningKey(privKey); err != nil {
+		logging.Error("Error publishing the signing key: %s", err.Error())
+		return
+	}
+	logging.Info("Published the signing key the gateway rotates to")
+}
+
+// publishSigningKey publishes the public key of the given signing key in the register entry of the gateway.
+func (c *Core) publishSigningKey(privKey *fcrcrypto.KeyPair) error {
+	if c.RegisterMgr == nil {
+		return errors.New("register manager not started")
+	}
+	gateway := c.RegisterMgr.GetGateway(c.GatewayID)
+	if gateway == nil {
+		return errors.New("gateway not found in the register")
+	}
+	signingKey, err := privKey.EncodePublicKey()
+	if err != nil {
+		return err
+	}
+	entry := gateway.Serialize()
+	entry.SigningKey = signingKey
+	return c.RegisterMgr.RegisterGateway(&entry)
+}
+
+// setPayment creates the payment manager of the gateway and starts refreshing the state of its payment channels.
+func (c *Core) setPayment(walletPrivKey string, lotusAPIAddr string, lotusAuthToken string) error {
+	paymentMgr, balanceLookup, err := payment.NewManager(c.Settings().PaymentManager, walletPrivKey, lotusAPIAddr, lotusAuthToken)
+	if err != nil {
+		return err
+	}
+	c.PaymentMgr = metrics.NewPaymentManager(c.ChannelStates.Track(paymentMgr), c.Metrics)
+	c.ChannelStates.StartRefresh(c.Settings().PaymentChannelRefreshInterval, balanceLookup)
+	c.Lifecycle.SetPaymentReady()
+	return nil
+}
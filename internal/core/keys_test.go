@@ -0,0 +1,70 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+func TestKeysReloadedAfterRestart(t *testing.T) {
+	conf := testSettings(t)
+	conf.KeystoreFile = filepath.Join(conf.DataDir, "keystore")
+	conf.KeystorePassphraseFile = filepath.Join(conf.DataDir, "passphrase")
+	conf.PaymentManager = payment.ManagerTypeMemory
+	conf.PaymentChannelRefreshInterval = time.Minute
+	require.NoError(t, ioutil.WriteFile(conf.KeystorePassphraseFile, []byte("passphrase"), 0600))
+
+	c, err := NewCore(conf)
+	require.NoError(t, err)
+	key, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	nodeID := nodeid.NewRandomNodeID()
+	c.InitialiseKey(nodeID, key, fcrcrypto.InitialKeyVersion())
+	require.NoError(t, c.InitialisePayment("wallet", "", ""))
+	require.NoError(t, c.SaveKeys())
+	require.NoError(t, c.FlushState())
+
+	// A restarted gateway is payment ready without the admin.
+	restarted, err := NewCore(conf)
+	require.NoError(t, err)
+	require.NoError(t, restarted.LoadKeys())
+	assert.Equal(t, StatePaymentReady, restarted.Lifecycle.State())
+	assert.Equal(t, nodeID.ToString(), restarted.GatewayID.ToString())
+	restartedKey, _ := restarted.SigningKey()
+	assert.Equal(t, key.EncodePrivateKey(), restartedKey.EncodePrivateKey())
+	assert.NotNil(t, restarted.PaymentMgr)
+
+	// Once wiped, a restarted gateway waits for the admin.
+	require.NoError(t, restarted.WipeKeys())
+	require.NoError(t, restarted.FlushState())
+	wiped, err := NewCore(conf)
+	require.NoError(t, err)
+	require.NoError(t, wiped.LoadKeys())
+	assert.Equal(t, StateUninitialised, wiped.Lifecycle.State())
+	assert.False(t, wiped.SigningKeys.HasKey())
+	assert.Empty(t, wiped.FlushState())
+}
@@ -0,0 +1,143 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"sync"
+)
+
+// State is a state in the lifecycle of a gateway. States are ordered: a gateway in a state can serve the requests
+// that require that state or an earlier one, except once it is draining.
+type State int
+
+const (
+	// StateUninitialised is the state of a gateway that has no key yet
+	StateUninitialised State = iota
+	// StateKeyed is the state of a gateway that has a key, and can sign its responses
+	StateKeyed
+	// StatePaymentReady is the state of a gateway that has a key and a payment manager, and can serve paid requests
+	StatePaymentReady
+	// StateServing is the state of a gateway that is payment ready and has completed its startup
+	StateServing
+	// StateDraining is the state of a gateway that is shutting down, and no longer serves any request
+	StateDraining
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateUninitialised:
+		return "uninitialised"
+	case StateKeyed:
+		return "keyed"
+	case StatePaymentReady:
+		return "payment-ready"
+	case StateServing:
+		return "serving"
+	case StateDraining:
+		return "draining"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// NotReadyError is returned when a request requires a state the gateway has not reached, or the gateway is draining.
+type NotReadyError struct {
+	Required State
+	Current  State
+}
+
+// Error returns the error message.
+func (e *NotReadyError) Error() string {
+	return fmt.Sprintf("gateway is not ready: request requires state %s, gateway is %s", e.Required, e.Current)
+}
+
+// Lifecycle tracks the state of a gateway. The gateway becomes keyed when its key is initialised, payment ready when
+// its payment manager is initialised, and serving once it is payment ready and its startup has completed, whichever
+// happens last. It is safe for concurrent use.
+type Lifecycle struct {
+	state   State
+	started bool
+	lock    sync.RWMutex
+}
+
+// NewLifecycle creates the lifecycle of an uninitialised gateway.
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{state: StateUninitialised}
+}
+
+// State returns the current state.
+func (l *Lifecycle) State() State {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.state
+}
+
+// Require returns a NotReadyError if the gateway can not serve requests requiring the given state.
+func (l *Lifecycle) Require(required State) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.state == StateDraining || l.state < required {
+		return &NotReadyError{Required: required, Current: l.state}
+	}
+	return nil
+}
+
+// SetKeyed records that the key of the gateway has been initialised.
+func (l *Lifecycle) SetKeyed() {
+	l.advance(StateKeyed)
+}
+
+// SetPaymentReady records that the key and the payment manager of the gateway have been initialised.
+func (l *Lifecycle) SetPaymentReady() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.started {
+		l.advanceLocked(StateServing)
+	} else {
+		l.advanceLocked(StatePaymentReady)
+	}
+}
+
+// SetStarted records that the startup of the gateway has completed.
+func (l *Lifecycle) SetStarted() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.started = true
+	if l.state == StatePaymentReady {
+		l.state = StateServing
+	}
+}
+
+// SetDraining records that the gateway is shutting down. It is final.
+func (l *Lifecycle) SetDraining() {
+	l.advance(StateDraining)
+}
+
+// advance moves to the given state, unless the gateway is already in that state or a later one.
+func (l *Lifecycle) advance(to State) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.advanceLocked(to)
+}
+
+// advanceLocked is advance for callers holding the lock.
+func (l *Lifecycle) advanceLocked(to State) {
+	if l.state < to {
+		l.state = to
+	}
+}
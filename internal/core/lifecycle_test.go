@@ -0,0 +1,54 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	l := NewLifecycle()
+	assert.Equal(t, StateUninitialised, l.State())
+	assert.NoError(t, l.Require(StateUninitialised))
+
+	err := l.Require(StateKeyed)
+	var notReady *NotReadyError
+	assert.True(t, errors.As(err, &notReady))
+	assert.Equal(t, StateKeyed, notReady.Required)
+	assert.Equal(t, StateUninitialised, notReady.Current)
+
+	l.SetKeyed()
+	assert.NoError(t, l.Require(StateKeyed))
+	assert.Error(t, l.Require(StatePaymentReady))
+
+	// Serving once payment ready and started, in any order.
+	l.SetStarted()
+	assert.Equal(t, StateKeyed, l.State())
+	l.SetPaymentReady()
+	assert.Equal(t, StateServing, l.State())
+
+	// Initialising the key again does not go back.
+	l.SetKeyed()
+	assert.Equal(t, StateServing, l.State())
+
+	l.SetDraining()
+	assert.Error(t, l.Require(StateUninitialised))
+	l.SetPaymentReady()
+	assert.Equal(t, StateDraining, l.State())
+}
@@ -0,0 +1,50 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+// Kinds of senders of the messages whose nonce is checked by CheckNonce.
+const (
+	SenderClient   = "client"
+	SenderGateway  = "gateway"
+	SenderProvider = "provider"
+)
+
+// ErrTTLTooFar is returned by CheckNonce when the ttl of a message is further in the future than the nonce window.
+var ErrTTLTooFar = errors.New("ttl is further than the nonce window")
+
+// CheckNonce rejects a message whose nonce has already been used by its sender. The nonce is remembered until the
+// ttl of the message, a unix timestamp, after which the message is rejected as expired anyway. The nonce of a message
+// without a ttl, for which ttl is 0, is remembered for the nonce window. It returns util.ErrReplay if the message is
+// a replay, ErrTTLTooFar if its ttl is further than the nonce window, so that no nonce is remembered for longer, and
+// util.ErrReplayGuardFull if the nonce cache is full.
+func (c *Core) CheckNonce(sender string, senderID *nodeid.NodeID, nonce int64, ttl int64) error {
+	expiry := time.Now().Add(c.Settings().NonceWindow)
+	if ttl != 0 {
+		if time.Unix(ttl, 0).After(expiry) {
+			return ErrTTLTooFar
+		}
+		expiry = time.Unix(ttl, 0)
+	}
+	return c.NonceCache.Check(sender+":"+senderID.ToString()+":"+strconv.FormatInt(nonce, 10), expiry)
+}
@@ -0,0 +1,57 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+// RestoreOffers reloads the offers persisted before the last shutdown. Each offer is re-verified against the
+// signing key of its provider: the offers of providers the register manager does not know yet are restored by a
+// later register refresh, see restorePendingOffers.
+func (c *Core) RestoreOffers() error {
+	restored, dropped, err := c.OffersMgr.Restore(c.getProviderSigningKey)
+	if err != nil {
+		return err
+	}
+	logging.Info("Restored %d offers from the offer store, dropped %d expired or invalid offers", restored, dropped)
+	return nil
+}
+
+// restorePendingOffers restores the persisted offers that could not be restored yet, as the signing key of their
+// provider was not known.
+func (c *Core) restorePendingOffers() {
+	if c.OffersMgr.Pending() == 0 {
+		return
+	}
+	restored, dropped := c.OffersMgr.RestorePending(c.getProviderSigningKey)
+	if restored > 0 || dropped > 0 {
+		logging.Info("Restored %d pending offers from the offer store, dropped %d expired or invalid offers", restored, dropped)
+	}
+}
+
+// getProviderSigningKey returns the signing key of a provider, as registered in the register.
+func (c *Core) getProviderSigningKey(providerID *nodeid.NodeID) (*fcrcrypto.KeyPair, error) {
+	providerInfo := c.RegisterMgr.GetProvider(providerID)
+	if providerInfo == nil {
+		return nil, errors.New("provider information not found")
+	}
+	return providerInfo.GetSigningKey()
+}
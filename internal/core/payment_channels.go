@@ -0,0 +1,34 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+// HasFundedPaymentChannel returns true if the gateway has a payment channel to a provider with more than
+// TOPUP_THRESHOLD available. The state of the payment channel is read from the payment channel state cache, so no
+// payment is made and no lotus node is queried.
+func (c *Core) HasFundedPaymentChannel(providerID *nodeid.NodeID) bool {
+	if c.RegisterMgr == nil {
+		return false
+	}
+	provider := c.RegisterMgr.GetProvider(providerID)
+	if provider == nil {
+		return false
+	}
+	return c.ChannelStates.IsFunded(provider.GetAddress(), c.Settings().TopupThreshold)
+}
@@ -0,0 +1,115 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+// PeerKeys remembers the signing keys of the peer gateways and providers, as read from the register. When a peer
+// rotates its signing key, the register publishes the new key before the peer starts signing with it. The previous
+// key of the peer is therefore still accepted, until the peer is seen signing with its new key or the grace window
+// expires. It is safe for concurrent use.
+type PeerKeys struct {
+	grace time.Duration
+	peers map[string]*peerKey
+	lock  sync.Mutex
+}
+
+// peerKey is the signing key of a peer and the key it replaced.
+type peerKey struct {
+	current  string
+	previous *fcrcrypto.KeyPair
+	changed  time.Time
+}
+
+// NewPeerKeys creates a PeerKeys accepting the previous key of a peer for the given grace window.
+func NewPeerKeys(grace time.Duration) *PeerKeys {
+	return &PeerKeys{
+		grace: grace,
+		peers: make(map[string]*peerKey),
+	}
+}
+
+// Verify verifies a message signed by the given peer, whose signing key in the register is pubKey. The message is
+// also accepted if it is signed by the previous key of the peer, within the grace window.
+func (p *PeerKeys) Verify(nodeID *nodeid.NodeID, pubKey *fcrcrypto.KeyPair, msg *fcrmessages.FCRMessage) error {
+	return p.VerifyFunc(nodeID, pubKey, func(key *fcrcrypto.KeyPair) error {
+		// A failed verification clears the signature of the message, every attempt is made on a copy.
+		attempt := *msg
+		return attempt.Verify(key)
+	})
+}
+
+// VerifyFunc verifies data signed by the given peer, whose signing key in the register is pubKey, with the given
+// verify function. The data is also accepted if it is signed by the previous key of the peer, within the grace window.
+func (p *PeerKeys) VerifyFunc(nodeID *nodeid.NodeID, pubKey *fcrcrypto.KeyPair, verify func(*fcrcrypto.KeyPair) error) error {
+	previous := p.observe(nodeID, pubKey)
+	err := verify(pubKey)
+	if err == nil {
+		if previous != nil {
+			p.retire(nodeID)
+		}
+		return nil
+	}
+	if previous != nil && verify(previous) == nil {
+		return nil
+	}
+	return err
+}
+
+// observe records the signing key of the given peer and returns its previous key, if it is within the grace
+// window.
+func (p *PeerKeys) observe(nodeID *nodeid.NodeID, pubKey *fcrcrypto.KeyPair) *fcrcrypto.KeyPair {
+	encoded, err := pubKey.EncodePublicKey()
+	if err != nil {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	peer, ok := p.peers[nodeID.ToString()]
+	if !ok {
+		p.peers[nodeID.ToString()] = &peerKey{current: encoded}
+		return nil
+	}
+	if peer.current != encoded {
+		previous, err := fcrcrypto.DecodePublicKey(peer.current)
+		if err != nil {
+			previous = nil
+		}
+		peer.current = encoded
+		peer.previous = previous
+		peer.changed = time.Now()
+	}
+	if peer.previous != nil && time.Since(peer.changed) > p.grace {
+		peer.previous = nil
+	}
+	return peer.previous
+}
+
+// retire stops accepting the previous key of the given peer.
+func (p *PeerKeys) retire(nodeID *nodeid.NodeID) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if peer, ok := p.peers[nodeID.ToString()]; ok {
+		peer.previous = nil
+	}
+}
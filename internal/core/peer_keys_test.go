@@ -0,0 +1,56 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerKeys(t *testing.T) {
+	oldKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	newKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	gatewayID := nodeid.NewRandomNodeID()
+	signed := func(key *fcrcrypto.KeyPair) *fcrmessages.FCRMessage {
+		msg := fcrmessages.CreateFCRMessage(fcrmessages.GatewayDHTDiscoverResponseType, []byte("{}"))
+		require.NoError(t, msg.Sign(key, fcrcrypto.InitialKeyVersion()))
+		return msg
+	}
+
+	p := NewPeerKeys(time.Hour)
+	assert.NoError(t, p.Verify(gatewayID, oldKey, signed(oldKey)))
+	assert.Error(t, p.Verify(gatewayID, oldKey, signed(newKey)))
+
+	// The register publishes the new key, the old key is still accepted until the new key is used.
+	assert.NoError(t, p.Verify(gatewayID, newKey, signed(oldKey)))
+	assert.NoError(t, p.Verify(gatewayID, newKey, signed(newKey)))
+	assert.Error(t, p.Verify(gatewayID, newKey, signed(oldKey)))
+
+	// The old key is not accepted after the grace window.
+	p = NewPeerKeys(time.Millisecond)
+	assert.NoError(t, p.Verify(gatewayID, oldKey, signed(oldKey)))
+	assert.NoError(t, p.Verify(gatewayID, newKey, signed(oldKey)))
+	time.Sleep(2 * time.Millisecond)
+	assert.Error(t, p.Verify(gatewayID, newKey, signed(oldKey)))
+}
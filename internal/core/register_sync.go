@@ -0,0 +1,80 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/request"
+)
+
+// StartRegister starts the routine of the register manager, and a routine that reads the register service every
+// REGISTER_REFRESH_DURATION to track whether the view of the register is fresh. The register manager only logs the
+// errors it gets from the register service, so the gateway reads the register service itself to know about them, and
+// to read the prices published by the gateways. The register manager of the gateway must have been created.
+func (c *Core) StartRegister() error {
+	if err := c.RegisterMgr.Start(); err != nil {
+		c.Readiness.RecordRegisterSync(fmt.Errorf("error starting register manager: %s", err.Error()))
+		return err
+	}
+	c.RefreshRegister()
+	c.stopRegisterSync = make(chan bool)
+	c.registerSyncDone = make(chan bool)
+	go func(stop chan bool, done chan bool) {
+		defer close(done)
+		ticker := time.NewTicker(c.Settings().RegisterRefreshDuration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.RefreshRegister()
+			case <-stop:
+				return
+			}
+		}
+	}(c.stopRegisterSync, c.registerSyncDone)
+	return nil
+}
+
+// stopRegister stops the routine reading the register service, if it has been started.
+func (c *Core) stopRegister() {
+	if c.stopRegisterSync == nil {
+		return
+	}
+	close(c.stopRegisterSync)
+	<-c.registerSyncDone
+	c.stopRegisterSync = nil
+}
+
+// RefreshRegister reads the list of gateways from the register service, records the outcome and updates the prices
+// published by the gateways. The persisted offers of providers that were not known yet are restored, and a signing
+// key due to be published is published.
+func (c *Core) RefreshRegister() {
+	c.publishPendingKey()
+	rspBytes, err := request.NewHttpCommunicator().GetJSON(c.Settings().RegisterAPIURL + "/registers/gateway/")
+	if err == nil {
+		if err = c.PeerPrices.Update(rspBytes); err != nil {
+			err = fmt.Errorf("invalid response from register service: %s", err.Error())
+		}
+	}
+	if err != nil {
+		logging.Warn("Error reading register service: %s", err.Error())
+	}
+	c.Readiness.RecordRegisterSync(err)
+	c.restorePendingOffers()
+}
@@ -0,0 +1,61 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+// ErrReloadNotSupported is returned when the settings are reloaded but the gateway has no settings loader.
+var ErrReloadNotSupported = errors.New("settings reload is not supported by this gateway")
+
+// Settings returns the current settings of the gateway. The settings returned are never modified: reloading the
+// settings replaces them with a new snapshot, so callers reading several settings should read them from the same
+// snapshot.
+func (c *Core) Settings() *settings.AppSettings {
+	return c.settings.Load().(*settings.AppSettings)
+}
+
+// ReloadSettings reads the settings again with the settings loader, and applies the reloadable settings that have
+// changed. The other settings that have changed are reported as requiring a restart, and are not applied. The
+// settings are left unchanged if they cannot be read or are invalid.
+func (c *Core) ReloadSettings() (*settings.ReloadReport, error) {
+	if c.SettingsLoader == nil {
+		return nil, ErrReloadNotSupported
+	}
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	next, err := c.SettingsLoader()
+	if err != nil {
+		return nil, err
+	}
+	current := c.Settings()
+	reloaded, report := current.Reload(next)
+	c.settings.Store(reloaded)
+
+	if reloaded.LogLevel != current.LogLevel {
+		logging.SetLogLevel(reloaded.LogLevel)
+	}
+	logging.Info("Settings reloaded: applied [%s], restart required for [%s]",
+		strings.Join(report.Reloaded, ", "), strings.Join(report.RestartRequired, ", "))
+	return report, nil
+}
@@ -0,0 +1,55 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+)
+
+// FlushState persists any state held in memory by the gateway and closes the stores. It is called on shutdown, and
+// only once in-flight requests have been drained, as handlers must not write to closed stores. All flushes are
+// attempted, and the first error encountered is returned.
+func (c *Core) FlushState() error {
+	var firstErr error
+	record := func(name string, err error) {
+		if err == nil {
+			return
+		}
+		logging.Error("Error flushing %s: %s", name, err.Error())
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Offers are written to the offer store as they are accepted, only expired ones need to be removed.
+	logging.Info("Closing offer store")
+	record("offer store", c.OffersMgr.Prune())
+	record("offer store", c.OffersMgr.Close())
+
+	logging.Info("Writing reputation snapshot")
+	record("reputation", c.ReputationMgr.Close())
+
+	logging.Info("Writing payment requests and credits")
+	record("payment requests", c.PaymentRequestMgr.Flush(paymentRequestsFile(c.Settings())))
+
+	c.stopRegister()
+	c.ChannelStates.StopRefresh()
+	if c.PaymentMgr != nil {
+		logging.Info("Shutting down payment manager")
+		c.PaymentMgr.Shutdown()
+	}
+	return firstErr
+}
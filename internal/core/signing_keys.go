@@ -0,0 +1,121 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+)
+
+// SigningKeys holds the signing key of the gateway and the key version it rotates to. A new key version is
+// scheduled ahead of its activation, so that it can be published to the register and picked up by the peers before
+// the gateway starts signing with it. It is safe for concurrent use.
+type SigningKeys struct {
+	current *signingKey
+	pending *signingKey
+	lock    sync.RWMutex
+}
+
+// signingKey is a key version and the time from which the gateway signs with it.
+type signingKey struct {
+	key        *fcrcrypto.KeyPair
+	version    *fcrcrypto.KeyVersion
+	activation time.Time
+}
+
+// NewSigningKeys creates an empty set of signing keys.
+func NewSigningKeys() *SigningKeys {
+	return &SigningKeys{}
+}
+
+// Set sets the signing key, active immediately. Any scheduled key version is discarded.
+func (s *SigningKeys) Set(key *fcrcrypto.KeyPair, version *fcrcrypto.KeyVersion) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current = &signingKey{key: key, version: version, activation: time.Now()}
+	s.pending = nil
+}
+
+// Schedule schedules a new key version, which becomes the signing key at the given activation time. The new version
+// must be greater than the version of the signing key. A key version that is scheduled and not yet active is
+// replaced.
+func (s *SigningKeys) Schedule(key *fcrcrypto.KeyPair, version *fcrcrypto.KeyVersion, activation time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.promote()
+	if s.current == nil {
+		return errors.New("no signing key to rotate")
+	}
+	if version.EncodeKeyVersion() <= s.current.version.EncodeKeyVersion() {
+		return errors.New("key version must be greater than the version of the signing key")
+	}
+	s.pending = &signingKey{key: key, version: version, activation: activation}
+	return nil
+}
+
+// Cancel discards the scheduled key version, if it is not yet active.
+func (s *SigningKeys) Cancel() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.promote()
+	s.pending = nil
+}
+
+// Current returns the key the gateway signs with, and its version. It returns nil if there is no signing key.
+func (s *SigningKeys) Current() (*fcrcrypto.KeyPair, *fcrcrypto.KeyVersion) {
+	s.lock.RLock()
+	pending := s.pending
+	current := s.current
+	s.lock.RUnlock()
+	if pending != nil && !time.Now().Before(pending.activation) {
+		s.lock.Lock()
+		s.promote()
+		current = s.current
+		s.lock.Unlock()
+	}
+	if current == nil {
+		return nil, nil
+	}
+	return current.key, current.version
+}
+
+// Pending returns the scheduled key version and its activation time. It returns nil if no key version is scheduled.
+func (s *SigningKeys) Pending() (*fcrcrypto.KeyPair, *fcrcrypto.KeyVersion, time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.promote()
+	if s.pending == nil {
+		return nil, nil, time.Time{}
+	}
+	return s.pending.key, s.pending.version, s.pending.activation
+}
+
+// HasKey returns true if the gateway has a signing key.
+func (s *SigningKeys) HasKey() bool {
+	key, _ := s.Current()
+	return key != nil
+}
+
+// promote makes the scheduled key version the signing key once it is active. The caller must hold the write lock.
+func (s *SigningKeys) promote() {
+	if s.pending != nil && !time.Now().Before(s.pending.activation) {
+		s.current = s.pending
+		s.pending = nil
+	}
+}
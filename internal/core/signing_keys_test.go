@@ -0,0 +1,66 @@
+package core
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigningKeys(t *testing.T) {
+	oldKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	newKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+
+	s := NewSigningKeys()
+	assert.False(t, s.HasKey())
+	assert.Error(t, s.Schedule(newKey, fcrcrypto.DecodeKeyVersion(2), time.Now()))
+
+	s.Set(oldKey, fcrcrypto.DecodeKeyVersion(1))
+	assert.Error(t, s.Schedule(newKey, fcrcrypto.DecodeKeyVersion(1), time.Now()))
+
+	// The old key is used until the activation.
+	activation := time.Now().Add(50 * time.Millisecond)
+	require.NoError(t, s.Schedule(newKey, fcrcrypto.DecodeKeyVersion(2), activation))
+	key, ver := s.Current()
+	assert.Equal(t, oldKey.EncodePrivateKey(), key.EncodePrivateKey())
+	assert.Equal(t, uint32(1), ver.EncodeKeyVersion())
+	pending, _, pendingActivation := s.Pending()
+	assert.Equal(t, newKey.EncodePrivateKey(), pending.EncodePrivateKey())
+	assert.True(t, activation.Equal(pendingActivation))
+
+	time.Sleep(time.Until(activation))
+	key, ver = s.Current()
+	assert.Equal(t, newKey.EncodePrivateKey(), key.EncodePrivateKey())
+	assert.Equal(t, uint32(2), ver.EncodeKeyVersion())
+	pending, _, _ = s.Pending()
+	assert.Nil(t, pending)
+
+	// A cancelled rotation is never activated.
+	require.NoError(t, s.Schedule(oldKey, fcrcrypto.DecodeKeyVersion(3), time.Now()))
+	s.Cancel()
+	_, ver = s.Current()
+	assert.Equal(t, uint32(3), ver.EncodeKeyVersion())
+	require.NoError(t, s.Schedule(oldKey, fcrcrypto.DecodeKeyVersion(4), time.Now().Add(time.Hour)))
+	s.Cancel()
+	_, ver = s.Current()
+	assert.Equal(t, uint32(3), ver.EncodeKeyVersion())
+}
@@ -0,0 +1,62 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/request"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+func TestAdminAuthentication(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	gw := n.Gateways[0]
+	refresh, err := fcrmessages.EncodeGatewayAdminForceRefreshRequest(true)
+	require.NoError(t, err)
+
+	// send signs an admin request with a key and sends it as is, it returns an error if the request is rejected.
+	send := func(msg *fcrmessages.FCRMessage, key *fcrcrypto.KeyPair) error {
+		require.NoError(t, msg.Sign(key, fcrcrypto.InitialKeyVersion()))
+		_, err := request.NewHttpCommunicator().SendMessage(gw.Register.NetworkInfoAdmin, msg)
+		return err
+	}
+
+	// Requests must be signed by the admin, and carry a nonce and a timestamp that are not replayed.
+	now := time.Now()
+	authenticated, err := messages.AddAdminAuthentication(refresh, now.UnixNano(), now)
+	require.NoError(t, err)
+	otherKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	assert.Error(t, send(authenticated, otherKey))
+	assert.NoError(t, send(authenticated, n.AdminKey))
+	assert.Error(t, send(authenticated, n.AdminKey))
+	assert.Error(t, send(refresh, n.AdminKey))
+
+	// The requests of the admin tooling that can not add a nonce and a timestamp are accepted during the transition.
+	gw.Conf.Set("ADMIN_LEGACY_REQUESTS", "true")
+	reloadSettings(t, n, gw)
+	assert.NoError(t, send(refresh, n.AdminKey))
+	assert.Error(t, send(refresh, otherKey))
+	assert.Error(t, send(authenticated, n.AdminKey))
+}
@@ -0,0 +1,72 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+func TestFundedProviderPaymentChannel(t *testing.T) {
+	n := NewNetwork(t, 1, 1)
+	client := NewClient()
+	provider := n.Providers[0]
+	gw := n.Gateways[0]
+
+	pieceCID := cid.NewRandomContentID()
+	offer, err := provider.NewOffer([]cid.ContentID{*pieceCID}, 10)
+	require.NoError(t, err)
+	require.NoError(t, provider.PublishDHTOffers(gw, []cidoffer.CIDOffer{*offer}))
+
+	// discover returns whether the gateway reports a funded payment channel to the provider of the offer.
+	discover := func(nonce int64) bool {
+		request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(pieceCID, nonce, time.Now().Add(time.Minute).Unix(), "paych-client", Voucher(gw.Core.Settings().SearchPrice))
+		require.NoError(t, err)
+		response, err := client.Send(gw, request)
+		require.NoError(t, err)
+		_, _, found, _, funded, paymentRequired, _, err := fcrmessages.DecodeClientStandardDiscoverResponseV2(response)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.False(t, paymentRequired)
+		require.Len(t, funded, 1)
+		return funded[0]
+	}
+	assert.False(t, discover(1))
+
+	// The payment channel the gateway opens to the provider is funded until no more than TOPUP_THRESHOLD is left.
+	topup, err := payment.ParseAmount("1 FIL")
+	require.NoError(t, err)
+	require.NoError(t, gw.Core.PaymentMgr.Topup(provider.Register.Address, topup))
+	_, _, _, err = gw.Core.PaymentMgr.Pay(provider.Register.Address, 0, gw.Core.Settings().SearchPrice)
+	require.NoError(t, err)
+	assert.True(t, discover(2))
+
+	left := new(big.Int).Sub(topup, gw.Core.Settings().SearchPrice)
+	left.Sub(left, gw.Core.Settings().TopupThreshold)
+	_, _, _, err = gw.Core.PaymentMgr.Pay(provider.Register.Address, 0, left)
+	require.NoError(t, err)
+	assert.False(t, discover(3))
+}
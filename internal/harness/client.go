@@ -0,0 +1,69 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/request"
+)
+
+// Client sends requests to the client REST API of gateways.
+type Client struct {
+	communicator request.HttpCommunications
+}
+
+// NewClient creates a client.
+func NewClient() *Client {
+	return &Client{communicator: request.NewHttpCommunicator()}
+}
+
+// Send sends a request to a gateway, and verifies that the response is signed by the gateway.
+func (c *Client) Send(gw *Gateway, msg *fcrmessages.FCRMessage) (*fcrmessages.FCRMessage, error) {
+	response, err := c.communicator.SendMessage(gw.Register.NetworkInfoClient, msg)
+	if err != nil {
+		return nil, err
+	}
+	if err = response.Verify(gw.Key); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SendForStatus sends a request to a gateway without checking the HTTP status, and returns the status together with the
+// response, verified to be signed by the gateway. It is used to inspect the error responses of the gateway.
+func (c *Client) SendForStatus(gw *Gateway, msg *fcrmessages.FCRMessage) (int, *fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return 0, nil, err
+	}
+	r, err := http.Post("http://"+gw.Register.NetworkInfoClient+"/v1", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer r.Body.Close()
+	var response fcrmessages.FCRMessage
+	if err = json.NewDecoder(r.Body).Decode(&response); err != nil {
+		return r.StatusCode, nil, err
+	}
+	if err = response.Verify(gw.Key); err != nil {
+		return r.StatusCode, nil, err
+	}
+	return r.StatusCode, &response, nil
+}
@@ -0,0 +1,24 @@
+/*
+Package harness - runs gateways in process for end-to-end tests, without Docker or a lotus node.
+
+A Network starts a fake register service, standing in for the service at REGISTER_API_URL, a number of gateways on
+loopback ports and a number of scripted fake providers. Gateways are given their keys through the admin API, and
+use a fake payment manager. Providers publish offers to gateways over the provider P2P port, and a Client sends
+requests to the client REST API of gateways.
+*/
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
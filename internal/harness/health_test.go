@@ -0,0 +1,64 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+)
+
+// getHealth gets a health endpoint of a gateway and decodes its body.
+func getHealth(t *testing.T, gw *Gateway, path string, body interface{}) int {
+	r, err := http.Get(gw.HealthURL + path)
+	require.NoError(t, err)
+	defer r.Body.Close()
+	require.NoError(t, json.NewDecoder(r.Body).Decode(body))
+	return r.StatusCode
+}
+
+func TestHealth(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	gw := n.Gateways[0]
+
+	var health core.Health
+	assert.Equal(t, http.StatusOK, getHealth(t, gw, api.ReadinessPath, &health))
+	assert.True(t, health.Ready)
+	assert.Equal(t, core.StateServing.String(), health.State)
+	assert.Equal(t, gw.ID.ToString(), health.GatewayID)
+	for _, check := range health.Checks {
+		assert.True(t, check.OK, check.Name)
+	}
+
+	// A draining gateway is alive, but no longer ready.
+	gw.Core.Lifecycle.SetDraining()
+	health = core.Health{}
+	assert.Equal(t, http.StatusServiceUnavailable, getHealth(t, gw, api.ReadinessPath, &health))
+	assert.False(t, health.Ready)
+	assert.Equal(t, core.HealthCheckLifecycle, health.Checks[0].Name)
+	assert.False(t, health.Checks[0].OK)
+
+	var live map[string]interface{}
+	assert.Equal(t, http.StatusOK, getHealth(t, gw, api.LivenessPath, &live))
+	assert.Equal(t, true, live["alive"])
+	assert.Equal(t, core.StateDraining.String(), live["state"])
+}
@@ -0,0 +1,100 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+func TestRotateKey(t *testing.T) {
+	n := NewNetwork(t, 3, 1)
+	client := NewClient()
+	provider := n.Providers[0]
+	gwA, gwB := n.Gateways[0], n.Gateways[1]
+
+	pieceCID := cid.NewRandomContentID()
+	offer, err := provider.NewOffer([]cid.ContentID{*pieceCID}, 10)
+	require.NoError(t, err)
+	require.NoError(t, provider.PublishDHTOffers(gwB, []cidoffer.CIDOffer{*offer}))
+
+	// discover asks gateway A to discover the offer through gateway B, and returns the response of gateway B.
+	discover := func(nonce int64) fcrmessages.FCRMessage {
+		ttl := time.Now().Add(time.Minute).Unix()
+		request, err := fcrmessages.EncodeClientDHTDiscoverRequest(pieceCID, nonce, ttl, 1, false, "", "")
+		require.NoError(t, err)
+		response, err := client.Send(gwA, request)
+		require.NoError(t, err)
+		_, responses, unContactable, _, _, _, err := fcrmessages.DecodeClientDHTDiscoverResponse(response)
+		require.NoError(t, err)
+		assert.Empty(t, unContactable)
+		require.Len(t, responses, 1)
+		return responses[0]
+	}
+	response := discover(1)
+	require.NoError(t, response.Verify(gwB.Key))
+
+	// Gateway B schedules the rotation, the new key is not published before the activation.
+	newKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	activation := time.Now().Add(3 * keyActivationMinDelay)
+	rotate, err := messages.EncodeGatewayAdminRotateKeyRequest(newKey, fcrcrypto.DecodeKeyVersion(2), activation)
+	require.NoError(t, err)
+	rotated, err := n.SendAdminRequest(gwB, rotate)
+	require.NoError(t, err)
+	scheduled, err := messages.DecodeGatewayAdminRotateKeyResponse(rotated)
+	require.NoError(t, err)
+	assert.True(t, scheduled)
+
+	registeredKey := func() string {
+		signingKey, err := gwA.Core.RegisterMgr.GetGateway(gwB.ID).GetSigningKey()
+		require.NoError(t, err)
+		registered, err := signingKey.EncodePublicKey()
+		require.NoError(t, err)
+		return registered
+	}
+	oldPubKey, err := gwB.Key.EncodePublicKey()
+	require.NoError(t, err)
+	newPubKey, err := newKey.EncodePublicKey()
+	require.NoError(t, err)
+	n.Refresh()
+	assert.Equal(t, oldPubKey, registeredKey())
+
+	// At the activation, gateway B publishes its new key. Gateway A has read it from the register and still accepts
+	// the old key, which gateway B keeps signing with for another register refresh.
+	time.Sleep(time.Until(activation))
+	n.Refresh()
+	n.Refresh()
+	assert.Equal(t, newPubKey, registeredKey())
+	response = discover(2)
+	require.NoError(t, response.Verify(gwB.Key))
+
+	// Once every peer has read the new key, gateway B signs with it.
+	time.Sleep(time.Until(activation.Add(keyActivationMinDelay)))
+	gwB.Key = newKey
+	response = discover(3)
+	require.NoError(t, response.Verify(newKey))
+}
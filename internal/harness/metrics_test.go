@@ -0,0 +1,87 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// scrape returns the metrics exposed by a gateway.
+func scrape(t *testing.T, gw *Gateway) string {
+	r, err := http.Get(gw.MetricsURL)
+	require.NoError(t, err)
+	defer r.Body.Close()
+	require.Equal(t, http.StatusOK, r.StatusCode)
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	n := NewNetwork(t, 3, 1)
+	client := NewClient()
+	provider := n.Providers[0]
+	gwA, gwB := n.Gateways[0], n.Gateways[1]
+
+	pieceCID := cid.NewRandomContentID()
+	offer, err := provider.NewOffer([]cid.ContentID{*pieceCID}, 10)
+	require.NoError(t, err)
+	require.NoError(t, provider.PublishDHTOffers(gwB, []cidoffer.CIDOffer{*offer}))
+
+	request, err := fcrmessages.EncodeClientDHTDiscoverRequest(pieceCID, 1, time.Now().Add(time.Minute).Unix(), 1, false, "", "")
+	require.NoError(t, err)
+	_, err = client.Send(gwA, request)
+	require.NoError(t, err)
+	request, err = fcrmessages.EncodeClientDHTDiscoverRequest(pieceCID, 2, time.Now().Add(-time.Minute).Unix(), 1, false, "", "")
+	require.NoError(t, err)
+	_, err = client.Send(gwA, request)
+	require.Error(t, err)
+
+	digest := offer.GetMessageDigest()
+	paid := new(big.Int).Set(gwB.Core.Settings().OfferPrice)
+	request, err = fcrmessages.EncodeClientStandardDiscoverOfferRequest(pieceCID, 3, time.Now().Add(time.Minute).Unix(), [][cidoffer.CIDOfferDigestSize]byte{digest}, "paych-client", Voucher(paid))
+	require.NoError(t, err)
+	_, err = client.Send(gwB, request)
+	require.NoError(t, err)
+
+	metricsA := scrape(t, gwA)
+	clientType := fcrmessages.ClientDHTDiscoverRequestType
+	assert.Contains(t, metricsA, fmt.Sprintf("fcr_gateway_requests_total{api=\"rest\",type=\"%d\"} 2", clientType))
+	assert.Contains(t, metricsA, fmt.Sprintf("fcr_gateway_request_duration_seconds_count{api=\"rest\",type=\"%d\"} 2", clientType))
+	assert.Contains(t, metricsA, fmt.Sprintf("fcr_gateway_request_errors_total{api=\"rest\",code=\"expired\",type=\"%d\"} 1", clientType))
+	assert.Contains(t, metricsA, fmt.Sprintf("fcr_gateway_dht_peer_requests_total{peer=\"%s\",result=\"success\"} 1", gwB.ID.ToString()))
+	assert.Contains(t, metricsA, "fcr_gateway_reputation_count{kind=\"client\"} 1")
+
+	metricsB := scrape(t, gwB)
+	assert.Contains(t, metricsB, fmt.Sprintf("fcr_gateway_requests_total{api=\"p2p\",type=\"%d\"} 1", fcrmessages.ProviderPublishDHTOfferRequestType))
+	assert.Contains(t, metricsB, fmt.Sprintf("fcr_gateway_requests_total{api=\"p2p\",type=\"%d\"} 1", fcrmessages.GatewayDHTDiscoverRequestType))
+	assert.Contains(t, metricsB, "fcr_gateway_offers{kind=\"dht\"} 1")
+	amount, _ := new(big.Float).SetInt(paid).Float64()
+	assert.Contains(t, metricsB, "fcr_gateway_payments_attofil_total{direction=\"received\"} "+strconv.FormatFloat(amount, 'g', -1, 64))
+}
@@ -0,0 +1,298 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrregistermgr"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/register"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/request"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/config"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/api"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/core"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/metrics"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+// startupTimeout is the time allowed for the servers of a node to start listening.
+const startupTimeout = 5 * time.Second
+
+// tcpInactivityTimeout is the TCP inactivity timeout of the nodes, longer than the default so that tests are not
+// flaky on a busy machine.
+const tcpInactivityTimeout = time.Second
+
+// keyActivationMinDelay is the minimum delay before a rotated key is used, and the register refresh duration of the
+// gateways, short so that key rotations can be tested.
+const keyActivationMinDelay = time.Second
+
+// Gateway is a gateway started in process.
+type Gateway struct {
+	Core       *core.Core
+	ID         *nodeid.NodeID
+	Key        *fcrcrypto.KeyPair
+	PaymentMgr *PaymentMgr
+	Register   register.GatewayRegister
+	MetricsURL string
+	HealthURL  string
+
+	// Conf is the configuration of the gateway, changes to it are read when the gateway reloads its settings
+	Conf *viper.Viper
+}
+
+// Network is a set of gateways and providers started in process, sharing a fake register service.
+type Network struct {
+	Register  *Register
+	Gateways  []*Gateway
+	Providers []*Provider
+
+	// AdminKey signs the admin requests sent to the gateways
+	AdminKey *fcrcrypto.KeyPair
+
+	dataDir string
+	t       testing.TB
+}
+
+// NewNetwork starts a network of gateways and providers. The network is closed when the test completes.
+func NewNetwork(t testing.TB, numGateways int, numProviders int) *Network {
+	adminKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	if err != nil {
+		t.Fatalf("Error generating admin key: %s", err.Error())
+	}
+	n := &Network{
+		Register:  NewRegister(),
+		Gateways:  make([]*Gateway, 0),
+		Providers: make([]*Provider, 0),
+		AdminKey:  adminKey,
+		dataDir:   t.TempDir(),
+		t:         t,
+	}
+	// Registered after the data directory, so that the state is flushed before the directory is removed.
+	t.Cleanup(n.Close)
+	// The DHT ring of the register manager skips the lowest node ID, and may return the excluded gateway, when it is
+	// asked for more gateways than it holds. Gateway IDs are given from highest to lowest so that lookups from the
+	// first gateway are deterministic: they return the gateways in between the first and the last one.
+	ids := make([]*nodeid.NodeID, numGateways)
+	for i := range ids {
+		ids[i] = nodeid.NewRandomNodeID()
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].ToString() > ids[j].ToString()
+	})
+	for i, id := range ids {
+		n.Gateways = append(n.Gateways, n.startGateway(i, id))
+	}
+	for i := 0; i < numProviders; i++ {
+		n.Providers = append(n.Providers, n.startProvider(i))
+	}
+	n.Refresh()
+	return n
+}
+
+// Refresh makes every node read the register service, so that they know about each other.
+func (n *Network) Refresh() {
+	for _, gw := range n.Gateways {
+		gw.Core.RegisterMgr.Refresh()
+		gw.Core.RefreshRegister()
+	}
+	for _, p := range n.Providers {
+		p.registerMgr.Refresh()
+	}
+}
+
+// Close drains the gateways, flushes their state and stops the register service. The servers of the nodes can not
+// be stopped, they keep listening until the test process exits.
+func (n *Network) Close() {
+	for _, gw := range n.Gateways {
+		gw.Core.Lifecycle.SetDraining()
+		if !gw.Core.Drainer.Drain(gw.Core.Settings().ShutdownTimeout) {
+			n.t.Errorf("Shutdown timeout exceeded with requests still in flight")
+			continue
+		}
+		gw.Core.RegisterMgr.Shutdown()
+		if err := gw.Core.FlushState(); err != nil {
+			n.t.Errorf("Error flushing gateway state: %s", err.Error())
+		}
+	}
+	n.Register.Close()
+}
+
+// SendAdminRequest signs an admin request with the admin key and sends it to a gateway.
+func (n *Network) SendAdminRequest(gw *Gateway, msg *fcrmessages.FCRMessage) (*fcrmessages.FCRMessage, error) {
+	// Admin requests carry a nonce and a timestamp in their body to protect against replays.
+	now := time.Now()
+	adminRequest, err := messages.AddAdminAuthentication(msg, now.UnixNano(), now)
+	if err != nil {
+		return nil, err
+	}
+	if err = adminRequest.Sign(n.AdminKey, fcrcrypto.InitialKeyVersion()); err != nil {
+		return nil, err
+	}
+	response, err := request.NewHttpCommunicator().SendMessage(gw.Register.NetworkInfoAdmin, adminRequest)
+	if err != nil {
+		return nil, err
+	}
+	if err = response.Verify(gw.Key); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// startGateway starts a gateway, registers it and initialises its key through the admin API.
+func (n *Network) startGateway(i int, id *nodeid.NodeID) *Gateway {
+	adminPubKey, err := n.AdminKey.EncodePublicKey()
+	if err != nil {
+		n.t.Fatalf("Error encoding admin key: %s", err.Error())
+	}
+	conf := viper.New()
+	conf.Set("IP", "127.0.0.1")
+	conf.Set("BIND_REST_API", freePort(n.t))
+	conf.Set("BIND_ADMIN_API", freePort(n.t))
+	conf.Set("BIND_GATEWAY_API", freePort(n.t))
+	conf.Set("BIND_PROVIDER_API", freePort(n.t))
+	conf.Set("BIND_METRICS_API", freePort(n.t))
+	conf.Set("BIND_HEALTH_API", freePort(n.t))
+	conf.Set("REGISTER_API_URL", n.Register.URL())
+	conf.Set("ADMIN_PUBLIC_KEY", adminPubKey)
+	conf.Set("TCP_INACTIVITY_TIMEOUT", tcpInactivityTimeout.String())
+	conf.Set("REGISTER_REFRESH_DURATION", keyActivationMinDelay.String())
+	conf.Set("KEY_ACTIVATION_MIN_DELAY", keyActivationMinDelay.String())
+	conf.Set("DATA_DIR", filepath.Join(n.dataDir, fmt.Sprintf("gateway%d", i)))
+	appSettings, err := config.Map(conf)
+	if err != nil {
+		n.t.Fatalf("Error mapping gateway configuration: %s", err.Error())
+	}
+
+	c, err := core.NewCore(&appSettings)
+	if err != nil {
+		n.t.Fatalf("Error creating gateway: %s", err.Error())
+	}
+	c.SettingsLoader = func() (*settings.AppSettings, error) {
+		appSettings, err := config.Map(conf)
+		if err != nil {
+			return nil, err
+		}
+		return &appSettings, nil
+	}
+	c.RegisterMgr = fcrregistermgr.NewFCRRegisterMgr(appSettings.RegisterAPIURL, true, true, appSettings.RegisterRefreshDuration)
+	if err = api.StartServers(c); err != nil {
+		n.t.Fatalf("Error starting gateway servers: %s", err.Error())
+	}
+	if err = c.StartRegister(); err != nil {
+		n.t.Fatalf("Error starting register manager: %s", err.Error())
+	}
+
+	key, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	if err != nil {
+		n.t.Fatalf("Error generating gateway key: %s", err.Error())
+	}
+	pubKey, err := key.EncodePublicKey()
+	if err != nil {
+		n.t.Fatalf("Error encoding gateway key: %s", err.Error())
+	}
+	gw := &Gateway{
+		Core:       c,
+		ID:         id,
+		Key:        key,
+		PaymentMgr: NewPaymentMgr(),
+		Register: register.GatewayRegister{
+			NodeID:              "",
+			Address:             fmt.Sprintf("gateway%d", i),
+			RootSigningKey:      pubKey,
+			SigningKey:          pubKey,
+			NetworkInfoGateway:  appSettings.NetworkInfoGateway,
+			NetworkInfoProvider: appSettings.NetworkInfoProvider,
+			NetworkInfoClient:   appSettings.NetworkInfoClient,
+			NetworkInfoAdmin:    appSettings.NetworkInfoAdmin,
+		},
+		MetricsURL: "http://127.0.0.1:" + appSettings.BindMetricsAPI + "/metrics",
+		HealthURL:  "http://127.0.0.1:" + appSettings.BindHealthAPI,
+		Conf:       conf,
+	}
+	gw.Register.NodeID = gw.ID.ToString()
+	n.Register.AddGateway(gw.Register)
+	waitForListener(n.t, gw.Register.NetworkInfoAdmin)
+	waitForListener(n.t, gw.Register.NetworkInfoClient)
+	waitForListener(n.t, gw.Register.NetworkInfoGateway)
+
+	// Initialise the key of the gateway as an admin would.
+	initialise, err := fcrmessages.EncodeGatewayAdminInitialiseKeyRequest(gw.ID, key, fcrcrypto.InitialKeyVersion())
+	if err != nil {
+		n.t.Fatalf("Error encoding initialise key request: %s", err.Error())
+	}
+	if _, err = n.SendAdminRequest(gw, initialise); err != nil {
+		n.t.Fatalf("Error initialising gateway key: %s", err.Error())
+	}
+	c.PaymentMgr = metrics.NewPaymentManager(c.ChannelStates.Track(gw.PaymentMgr), c.Metrics)
+	c.Lifecycle.SetPaymentReady()
+	c.Lifecycle.SetStarted()
+	return gw
+}
+
+// usedPorts are the ports already returned by freePort. The operating system may hand out a port again once it has
+// been closed, before the gateway it was given to listens on it.
+var usedPorts = struct {
+	sync.Mutex
+	ports map[int]bool
+}{ports: make(map[int]bool)}
+
+// freePort returns a port that is free on the loopback interface, and that has not been returned before.
+func freePort(t testing.TB) string {
+	usedPorts.Lock()
+	defer usedPorts.Unlock()
+	for {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Error finding a free port: %s", err.Error())
+		}
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+		if !usedPorts.ports[port] {
+			usedPorts.ports[port] = true
+			return strconv.Itoa(port)
+		}
+	}
+}
+
+// waitForListener waits until a server listens on an address.
+func waitForListener(t testing.TB, address string) {
+	deadline := time.Now().Add(startupTimeout)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server not listening on %s: %s", address, err.Error())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
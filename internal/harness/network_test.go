@@ -0,0 +1,328 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+func TestPublishAndDiscover(t *testing.T) {
+	n := NewNetwork(t, 3, 1)
+	client := NewClient()
+	provider := n.Providers[0]
+	gwA, gwB := n.Gateways[0], n.Gateways[1]
+
+	pieceCID := cid.NewRandomContentID()
+	offer, err := provider.NewOffer([]cid.ContentID{*pieceCID}, 10)
+	require.NoError(t, err)
+	require.NoError(t, provider.PublishDHTOffers(gwB, []cidoffer.CIDOffer{*offer}))
+
+	ttl := time.Now().Add(time.Minute).Unix()
+
+	// Standard discover: only the gateway the offer was published to knows about it.
+	request, err := fcrmessages.EncodeClientStandardDiscoverRequest(pieceCID, 1, ttl, "", "")
+	require.NoError(t, err)
+	response, err := client.Send(gwB, request)
+	require.NoError(t, err)
+	_, _, found, subOffers, _, err := fcrmessages.DecodeClientStandardDiscoverResponse(response)
+	require.NoError(t, err)
+	assert.True(t, found)
+	require.Len(t, subOffers, 1)
+	assert.Equal(t, provider.ID.ToString(), subOffers[0].GetProviderID().ToString())
+
+	response, err = client.Send(gwA, request)
+	require.NoError(t, err)
+	_, _, found, _, _, err = fcrmessages.DecodeClientStandardDiscoverResponse(response)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// DHT discover: the gateway holding the offer is asked on behalf of the client.
+	request, err = fcrmessages.EncodeClientDHTDiscoverRequest(pieceCID, 2, ttl, 1, false, "", "")
+	require.NoError(t, err)
+	response, err = client.Send(gwA, request)
+	require.NoError(t, err)
+	contacted, responses, unContactable, _, _, _, err := fcrmessages.DecodeClientDHTDiscoverResponse(response)
+	require.NoError(t, err)
+	assert.Empty(t, unContactable)
+	require.Len(t, contacted, 1)
+	assert.Equal(t, gwB.ID.ToString(), contacted[0].ToString())
+	require.Len(t, responses, 1)
+	require.NoError(t, responses[0].Verify(gwB.Key))
+	_, _, found, offers, _, err := fcrmessages.DecodeGatewayDHTDiscoverResponse(&responses[0])
+	require.NoError(t, err)
+	assert.True(t, found)
+	require.Len(t, offers, 1)
+	assert.Equal(t, provider.ID.ToString(), offers[0].GetProviderID().ToString())
+
+	// Offer discover is paid for each offer digest.
+	digest := offer.GetMessageDigest()
+	paid := new(big.Int).Set(gwB.Core.Settings().OfferPrice)
+	request, err = fcrmessages.EncodeClientStandardDiscoverOfferRequest(pieceCID, 3, ttl, [][cidoffer.CIDOfferDigestSize]byte{digest}, "paych-client", Voucher(paid))
+	require.NoError(t, err)
+	response, err = client.Send(gwB, request)
+	require.NoError(t, err)
+	_, _, found, subOffers, _, paymentRequired, _, err := fcrmessages.DecodeClientStandardDiscoverOfferResponse(response)
+	require.NoError(t, err)
+	assert.False(t, paymentRequired)
+	assert.True(t, found)
+	require.Len(t, subOffers, 1)
+	assert.Equal(t, 0, paid.Cmp(gwB.PaymentMgr.Received("paych-client")))
+}
+
+func TestReplayRejected(t *testing.T) {
+	n := NewNetwork(t, 3, 1)
+	client := NewClient()
+	gwA := n.Gateways[0]
+
+	pieceCID := cid.NewRandomContentID()
+	request, err := fcrmessages.EncodeClientDHTDiscoverRequest(pieceCID, 1, time.Now().Add(time.Minute).Unix(), 1, false, "", "")
+	require.NoError(t, err)
+	_, err = client.Send(gwA, request)
+	require.NoError(t, err)
+
+	// The same request is not served again, a new nonce is.
+	_, err = client.Send(gwA, request)
+	assert.Error(t, err)
+	request, err = fcrmessages.EncodeClientDHTDiscoverRequest(pieceCID, 2, time.Now().Add(time.Minute).Unix(), 1, false, "", "")
+	require.NoError(t, err)
+	_, err = client.Send(gwA, request)
+	assert.NoError(t, err)
+}
+
+func TestReplayAfterFloodRejected(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	client := NewClient()
+	gw := n.Gateways[0]
+	gw.Core.NonceCache = util.NewReplayGuard(3)
+	ttl := time.Now().Add(time.Minute).Unix()
+	pieceCID := cid.NewRandomContentID()
+
+	captured, err := fcrmessages.EncodeClientStandardDiscoverRequest(pieceCID, 1, ttl, "", "")
+	require.NoError(t, err)
+	_, err = client.Send(gw, captured)
+	require.NoError(t, err)
+
+	// Flooding the nonce cache gets requests refused, rather than evicting the nonce of the captured request.
+	var status int
+	for nonce := int64(2); nonce <= 10; nonce++ {
+		request, err := fcrmessages.EncodeClientStandardDiscoverRequest(pieceCID, nonce, ttl, "", "")
+		require.NoError(t, err)
+		status, _, err = client.SendForStatus(gw, request)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	status, response, err := client.SendForStatus(gw, captured)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	var gwErr *messages.GatewayError
+	require.True(t, errors.As(messages.ErrorFromResponse(response), &gwErr))
+	assert.Equal(t, messages.ErrorReplay, gwErr.Code)
+}
+
+func TestFarTTLRejected(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	client := NewClient()
+	gw := n.Gateways[0]
+
+	// A nonce is never remembered for longer than the nonce window.
+	ttl := time.Now().Add(gw.Core.Settings().NonceWindow + time.Hour).Unix()
+	request, err := fcrmessages.EncodeClientStandardDiscoverRequest(cid.NewRandomContentID(), 1, ttl, "", "")
+	require.NoError(t, err)
+	status, response, err := client.SendForStatus(gw, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	var gwErr *messages.GatewayError
+	require.True(t, errors.As(messages.ErrorFromResponse(response), &gwErr))
+	assert.Equal(t, messages.ErrorInvalidMessage, gwErr.Code)
+}
+
+func TestPeerRequestExpiresWithClientRequest(t *testing.T) {
+	n := NewNetwork(t, 3, 0)
+	client := NewClient()
+	gwA, gwB := n.Gateways[0], n.Gateways[1]
+	gwB.Conf.Set("NONCE_WINDOW", "5s")
+	reloadSettings(t, n, gwB)
+	pieceCID, err := cid.NewContentIDFromHexString(gwB.ID.ToString())
+	require.NoError(t, err)
+	peerPrice := gwA.Core.Pricing.PeerSearchPrice(gwB.ID)
+
+	// discover asks gateway A to discover through gateway B, and returns whether gateway B was contacted.
+	discover := func(nonce int64, ttl time.Time) bool {
+		request, err := fcrmessages.EncodeClientDHTDiscoverRequestV2(pieceCID, nonce, ttl.Unix(), 1, false, "paych-client", Voucher(peerPrice))
+		require.NoError(t, err)
+		response, err := client.Send(gwA, request)
+		require.NoError(t, err)
+		contacted, _, unContactable, _, _, _, err := fcrmessages.DecodeClientDHTDiscoverResponseV2(response)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(contacted)+len(unContactable))
+		return len(contacted) == 1
+	}
+
+	// The request to gateway B expires with the client request: within the nonce window of gateway B it is served,
+	// beyond it it is rejected.
+	assert.True(t, discover(1, time.Now().Add(4*time.Second)))
+	assert.False(t, discover(2, time.Now().Add(time.Minute)))
+}
+
+func TestExpiredRequestGetsErrorResponse(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	client := NewClient()
+	gw := n.Gateways[0]
+
+	request, err := fcrmessages.EncodeClientDHTDiscoverRequest(cid.NewRandomContentID(), 1, time.Now().Add(-time.Minute).Unix(), 1, false, "", "")
+	require.NoError(t, err)
+	status, response, err := client.SendForStatus(gw, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	var gwErr *messages.GatewayError
+	require.True(t, errors.As(messages.ErrorFromResponse(response), &gwErr))
+	assert.Equal(t, messages.ErrorExpired, gwErr.Code)
+}
+
+func TestCreditSpentOnlyWithVoucher(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	client := NewClient()
+	gw := n.Gateways[0]
+	ttl := time.Now().Add(time.Minute).Unix()
+	price := gw.Core.Settings().SearchPrice
+
+	// The victim overpays, and is credited the difference.
+	request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), 1, ttl, "paych-victim", Voucher(new(big.Int).Mul(price, big.NewInt(2))))
+	require.NoError(t, err)
+	_, err = client.Send(gw, request)
+	require.NoError(t, err)
+	assert.Equal(t, price.String(), gw.Core.PaymentRequestMgr.GetCredit("paych-victim").String())
+
+	// A request naming the payment channel of the victim without a valid voucher on it is rejected.
+	request, err = fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), 2, ttl, "paych-victim", "junk")
+	require.NoError(t, err)
+	status, response, err := client.SendForStatus(gw, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPaymentRequired, status)
+	var gwErr *messages.GatewayError
+	require.True(t, errors.As(messages.ErrorFromResponse(response), &gwErr))
+	assert.Equal(t, messages.ErrorInsufficientPayment, gwErr.Code)
+	assert.Equal(t, price.String(), gw.Core.PaymentRequestMgr.GetCredit("paych-victim").String())
+}
+
+func TestUnprovenRequestsLeaveReputationUntouched(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	client := NewClient()
+	gw := n.Gateways[0]
+	expired := time.Now().Add(-time.Minute).Unix()
+	victim, anonymous := channelClientID(t, "paych-victim"), channelClientID(t, "")
+	victimRep := gw.Core.ReputationMgr.GetOrEstablishClientReputation(victim)
+	anonymousRep := gw.Core.ReputationMgr.GetOrEstablishClientReputation(anonymous)
+
+	// Expired requests naming the payment channel of the victim without a valid voucher, or no payment channel, prove
+	// nothing.
+	for nonce := int64(1); nonce <= 5; nonce++ {
+		request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), nonce, expired, "paych-victim", "forged")
+		require.NoError(t, err)
+		_, err = client.Send(gw, request)
+		assert.Error(t, err)
+		request, err = fcrmessages.EncodeClientStandardDiscoverRequest(cid.NewRandomContentID(), nonce, expired, "", "")
+		require.NoError(t, err)
+		_, err = client.Send(gw, request)
+		assert.Error(t, err)
+	}
+	rep, _ := gw.Core.ReputationMgr.GetClientReputation(victim)
+	assert.Equal(t, victimRep, rep)
+	rep, _ = gw.Core.ReputationMgr.GetClientReputation(anonymous)
+	assert.Equal(t, anonymousRep, rep)
+}
+
+func TestMisbehavingClientRefused(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	client := NewClient()
+	gw := n.Gateways[0]
+	gw.Conf.Set("CLIENT_REFUSE_REPUTATION", "0")
+	reloadSettings(t, n, gw)
+	expired := time.Now().Add(-time.Minute).Unix()
+	ttl := time.Now().Add(time.Minute).Unix()
+	clientID := channelClientID(t, "paych-bad")
+	initialRep := gw.Core.ReputationMgr.GetOrEstablishClientReputation(clientID)
+
+	// Every expired request whose voucher is received lowers the reputation of the client.
+	nonce := int64(0)
+	for rep := initialRep; rep >= 0; rep, _ = gw.Core.ReputationMgr.GetClientReputation(clientID) {
+		nonce++
+		require.Less(t, nonce, initialRep+10, "reputation not lowered")
+		request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), nonce, expired, "paych-bad", Voucher(big.NewInt(1)))
+		require.NoError(t, err)
+		status, _, err := client.SendForStatus(gw, request)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, status)
+	}
+	assert.Equal(t, big.NewInt(nonce).String(), gw.Core.PaymentRequestMgr.GetCredit("paych-bad").String())
+
+	// The client is now refused, while other clients are still served.
+	request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), nonce+1, ttl, "paych-bad", Voucher(gw.Core.Settings().SearchPrice))
+	require.NoError(t, err)
+	status, response, err := client.SendForStatus(gw, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+	var gwErr *messages.GatewayError
+	require.True(t, errors.As(messages.ErrorFromResponse(response), &gwErr))
+	assert.Equal(t, messages.ErrorRefused, gwErr.Code)
+	request, err = fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), 1, ttl, "paych-good", Voucher(gw.Core.Settings().SearchPrice))
+	require.NoError(t, err)
+	_, err = client.Send(gw, request)
+	assert.NoError(t, err)
+}
+
+// channelClientID returns the id of the client paying from a payment channel.
+func channelClientID(t *testing.T, paychAddr string) *nodeid.NodeID {
+	hash := sha256.Sum256([]byte(paychAddr))
+	id, err := nodeid.NewNodeIDFromBytes(hash[:])
+	require.NoError(t, err)
+	return id
+}
+
+func TestForgedRequestLeavesSenderReputationUntouched(t *testing.T) {
+	n := NewNetwork(t, 1, 1)
+	gw, provider := n.Gateways[0], n.Providers[0]
+	gw.Core.ReputationMgr.SetProviderReputation(provider.ID, 0)
+
+	// A request signed with another key in the name of the provider is rejected, without penalising the provider.
+	key, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	forger := &Provider{ID: provider.ID, Key: key, p2pServer: provider.p2pServer}
+	offer, err := forger.NewOffer([]cid.ContentID{*cid.NewRandomContentID()}, 10)
+	require.NoError(t, err)
+	assert.Error(t, forger.PublishDHTOffers(gw, []cidoffer.CIDOffer{*offer}))
+	rep, _ := gw.Core.ReputationMgr.GetProviderReputation(provider.ID)
+	assert.Equal(t, int64(0), rep)
+}
@@ -0,0 +1,143 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+)
+
+// PaymentMgr is a fake payment manager. A voucher is the decimal amount it pays, and the payment channel to a
+// recipient is named after the recipient. Payment channels never run out of funds, unless a top up is required
+// with RequireTopup, and payments never fail, unless they are made to fail with FailPayments.
+type PaymentMgr struct {
+	lock     sync.Mutex
+	received map[string]*big.Int
+	paid     map[string]*big.Int
+	topups   map[string]*big.Int
+	unfunded map[string]bool
+	failing  map[string]bool
+}
+
+// NewPaymentMgr creates a fake payment manager.
+func NewPaymentMgr() *PaymentMgr {
+	return &PaymentMgr{
+		received: make(map[string]*big.Int),
+		paid:     make(map[string]*big.Int),
+		topups:   make(map[string]*big.Int),
+		unfunded: make(map[string]bool),
+		failing:  make(map[string]bool),
+	}
+}
+
+// Voucher returns the voucher paying amount.
+func Voucher(amount *big.Int) string {
+	return amount.String()
+}
+
+// Topup tops up the payment channel to a recipient.
+func (m *PaymentMgr) Topup(recipient string, amount *big.Int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	add(m.topups, recipient, amount)
+	delete(m.unfunded, recipient)
+	return nil
+}
+
+// Pay pays amount to a recipient, unless the payment channel to the recipient requires a top up.
+func (m *PaymentMgr) Pay(recipient string, lane uint64, amount *big.Int) (string, string, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.failing[recipient] {
+		return "", "", false, errors.New("payment failed")
+	}
+	if m.unfunded[recipient] {
+		return "", "", true, nil
+	}
+	add(m.paid, recipient, amount)
+	return "paych-" + recipient, Voucher(amount), false, nil
+}
+
+// Receive receives a voucher on a payment channel.
+func (m *PaymentMgr) Receive(channel string, voucher string) (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(voucher, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, errors.New("invalid voucher")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	add(m.received, channel, amount)
+	return amount, nil
+}
+
+// Shutdown does nothing.
+func (m *PaymentMgr) Shutdown() {
+}
+
+// RequireTopup makes the next payments to a recipient require a top up.
+func (m *PaymentMgr) RequireTopup(recipient string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.unfunded[recipient] = true
+}
+
+// FailPayments makes the next payments to a recipient fail.
+func (m *PaymentMgr) FailPayments(recipient string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.failing[recipient] = true
+}
+
+// Received returns the total amount received on a payment channel.
+func (m *PaymentMgr) Received(channel string) *big.Int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return get(m.received, channel)
+}
+
+// Paid returns the total amount paid to a recipient.
+func (m *PaymentMgr) Paid(recipient string) *big.Int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return get(m.paid, recipient)
+}
+
+// ToppedUp returns the total amount the payment channel to a recipient has been topped up by.
+func (m *PaymentMgr) ToppedUp(recipient string) *big.Int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return get(m.topups, recipient)
+}
+
+// add adds amount to the total of key.
+func add(totals map[string]*big.Int, key string, amount *big.Int) {
+	total, ok := totals[key]
+	if !ok {
+		total = big.NewInt(0)
+		totals[key] = total
+	}
+	total.Add(total, amount)
+}
+
+// get returns a copy of the total of key.
+func get(totals map[string]*big.Int, key string) *big.Int {
+	total, ok := totals[key]
+	if !ok {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(total)
+}
@@ -0,0 +1,77 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+func TestPaymentRequestCompleted(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	client := NewClient()
+	gw := n.Gateways[0]
+	ttl := time.Now().Add(time.Minute).Unix()
+	pieceCID := cid.NewRandomContentID()
+	price := gw.Core.Settings().SearchPrice
+
+	// An underpaid request gets a payment request for the amount still owed.
+	request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(pieceCID, 1, ttl, "paych-client", Voucher(big.NewInt(1)))
+	require.NoError(t, err)
+	response, err := client.Send(gw, request)
+	require.NoError(t, err)
+	_, _, _, _, _, paymentRequired, requestID, err := fcrmessages.DecodeClientStandardDiscoverResponseV2(response)
+	require.NoError(t, err)
+	require.True(t, paymentRequired)
+	assert.NotZero(t, requestID)
+	_, owed := payment.QuoteFromBody(response.GetMessageBody())
+	expected := new(big.Int).Sub(price, big.NewInt(1))
+	require.Equal(t, expected.String(), owed.String())
+
+	// The request is served once resent with the amount owed and a reference to the payment request, although the
+	// amount owed alone does not cover the price.
+	request, err = fcrmessages.EncodeClientStandardDiscoverRequestV2(pieceCID, 2, ttl, "paych-client", Voucher(owed))
+	require.NoError(t, err)
+	request, err = payment.AddRequestID(request, requestID)
+	require.NoError(t, err)
+	response, err = client.Send(gw, request)
+	require.NoError(t, err)
+	_, _, _, _, _, paymentRequired, _, err = fcrmessages.DecodeClientStandardDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.False(t, paymentRequired)
+	assert.Equal(t, price.String(), gw.PaymentMgr.Received("paych-client").String())
+	assert.Equal(t, "0", gw.Core.PaymentRequestMgr.GetCredit("paych-client").String())
+
+	// The payment request is settled, it can not be referenced again.
+	request, err = fcrmessages.EncodeClientStandardDiscoverRequestV2(pieceCID, 3, ttl, "paych-client", Voucher(owed))
+	require.NoError(t, err)
+	request, err = payment.AddRequestID(request, requestID)
+	require.NoError(t, err)
+	response, err = client.Send(gw, request)
+	require.NoError(t, err)
+	_, _, _, _, _, paymentRequired, _, err = fcrmessages.DecodeClientStandardDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.True(t, paymentRequired)
+}
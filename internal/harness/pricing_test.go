@@ -0,0 +1,135 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+func TestPricingPolicy(t *testing.T) {
+	n := NewNetwork(t, 3, 0)
+	client := NewClient()
+	gwA, gwB := n.Gateways[0], n.Gateways[1]
+	ttl := time.Now().Add(time.Minute).Unix()
+	unpaid := Voucher(big.NewInt(0))
+
+	// Gateway A charges clients three times its search price for every CID, and new clients get half off.
+	gwA.Conf.Set("PRICE_CID_RANGES", "00-ff:300")
+	gwA.Conf.Set("PRICE_REPUTATION_DISCOUNTS", "0:50")
+	reloadSettings(t, n, gwA)
+	expected := new(big.Int).Mul(gwA.Core.Settings().SearchPrice, big.NewInt(3))
+	expected.Quo(expected, big.NewInt(2))
+
+	request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), 1, ttl, "paych-client", unpaid)
+	require.NoError(t, err)
+	response, err := client.Send(gwA, request)
+	require.NoError(t, err)
+	_, _, _, _, _, paymentRequired, _, err := fcrmessages.DecodeClientStandardDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.True(t, paymentRequired)
+	quote, owed := payment.QuoteFromBody(response.GetMessageBody())
+	require.NotNil(t, quote)
+	assert.Equal(t, expected.String(), quote.String())
+	assert.Equal(t, expected.String(), owed.String())
+
+	// Gateway B publishes its search price in the register, gateway A charges the client what it pays gateway B.
+	peerPrice, err := payment.ParseAmount("2 nanoFIL")
+	require.NoError(t, err)
+	gwB.Conf.Set("SEARCH_PRICE", "2 nanoFIL")
+	reloadSettings(t, n, gwB)
+	n.Register.SetGatewayPrices(gwB.ID.ToString(), "2 nanoFIL", "")
+	n.Refresh()
+
+	request, err = fcrmessages.EncodeClientDHTDiscoverRequestV2(cid.NewRandomContentID(), 2, ttl, 1, false, "paych-client", unpaid)
+	require.NoError(t, err)
+	response, err = client.Send(gwA, request)
+	require.NoError(t, err)
+	_, _, _, _, paymentRequired, _, err = fcrmessages.DecodeClientDHTDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.True(t, paymentRequired)
+	quote, _ = payment.QuoteFromBody(response.GetMessageBody())
+	require.NotNil(t, quote)
+	assert.Equal(t, peerPrice.String(), quote.String())
+
+	request, err = fcrmessages.EncodeClientDHTDiscoverRequestV2(cid.NewRandomContentID(), 3, ttl, 1, false, "paych-client", Voucher(peerPrice))
+	require.NoError(t, err)
+	response, err = client.Send(gwA, request)
+	require.NoError(t, err)
+	contacted, _, unContactable, _, paymentRequired, _, err := fcrmessages.DecodeClientDHTDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.False(t, paymentRequired)
+	assert.Empty(t, unContactable)
+	require.Len(t, contacted, 1)
+	assert.Equal(t, gwB.ID.ToString(), contacted[0].ToString())
+	assert.Equal(t, peerPrice.String(), gwA.PaymentMgr.Paid(gwB.Register.Address).String())
+}
+
+func TestFailedGatewayCreditedBack(t *testing.T) {
+	n := NewNetwork(t, 3, 0)
+	client := NewClient()
+	gwA, gwB, gwC := n.Gateways[0], n.Gateways[1], n.Gateways[2]
+	ttl := time.Now().Add(time.Minute).Unix()
+	peerPrice := gwA.Core.Pricing.PeerSearchPrice(gwB.ID)
+	require.Equal(t, peerPrice.String(), gwA.Core.Pricing.PeerSearchPrice(gwC.ID).String())
+
+	// Gateway B is paid by gateway A, but refuses the request as it is shutting down: what was paid to it is spent.
+	gwB.Core.Lifecycle.SetDraining()
+	discoverNear(t, client, gwA, gwB, 1, ttl, peerPrice)
+	assert.Equal(t, peerPrice.String(), gwA.PaymentMgr.Paid(gwB.Register.Address).String())
+	assert.Equal(t, "0", gwA.Core.PaymentRequestMgr.GetCredit("paych-client").String())
+
+	// Gateway C can't be paid, so its charge is credited back.
+	gwA.PaymentMgr.FailPayments(gwC.Register.Address)
+	discoverNear(t, client, gwA, gwC, 2, ttl, peerPrice)
+	assert.Equal(t, "0", gwA.PaymentMgr.Paid(gwC.Register.Address).String())
+	assert.Equal(t, peerPrice.String(), gwA.Core.PaymentRequestMgr.GetCredit("paych-client").String())
+}
+
+// discoverNear sends a DHT discovery paying amount to gw for the CID of target's node ID, so that target is the only
+// gateway contacted, and checks that target could not be contacted.
+func discoverNear(t *testing.T, client *Client, gw *Gateway, target *Gateway, nonce int64, ttl int64, amount *big.Int) {
+	pieceCID, err := cid.NewContentIDFromHexString(target.ID.ToString())
+	require.NoError(t, err)
+	request, err := fcrmessages.EncodeClientDHTDiscoverRequestV2(pieceCID, nonce, ttl, 1, false, "paych-client", Voucher(amount))
+	require.NoError(t, err)
+	response, err := client.Send(gw, request)
+	require.NoError(t, err)
+	contacted, _, unContactable, _, paymentRequired, _, err := fcrmessages.DecodeClientDHTDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.False(t, paymentRequired)
+	assert.Empty(t, contacted)
+	require.Len(t, unContactable, 1)
+	assert.Equal(t, target.ID.ToString(), unContactable[0].ToString())
+}
+
+// reloadSettings makes a gateway reload its settings through the admin API.
+func reloadSettings(t *testing.T, n *Network, gw *Gateway) {
+	request, err := messages.EncodeGatewayAdminReloadSettingsRequest()
+	require.NoError(t, err)
+	_, err = n.SendAdminRequest(gw, request)
+	require.NoError(t, err)
+}
@@ -0,0 +1,136 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrp2pserver"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrregistermgr"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/register"
+)
+
+// offerTTL is the lifetime of the offers created by fake providers.
+const offerTTL = time.Hour
+
+// Provider is a scripted fake provider. It does not listen on any port, it only publishes offers to gateways.
+type Provider struct {
+	ID       *nodeid.NodeID
+	Key      *fcrcrypto.KeyPair
+	Register register.ProviderRegister
+
+	registerMgr *fcrregistermgr.FCRRegisterMgr
+	p2pServer   *fcrp2pserver.FCRP2PServer
+}
+
+// startProvider creates a provider, registers it and starts its P2P server.
+func (n *Network) startProvider(i int) *Provider {
+	key, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	if err != nil {
+		n.t.Fatalf("Error generating provider key: %s", err.Error())
+	}
+	pubKey, err := key.EncodePublicKey()
+	if err != nil {
+		n.t.Fatalf("Error encoding provider key: %s", err.Error())
+	}
+	p := &Provider{
+		ID:  nodeid.NewRandomNodeID(),
+		Key: key,
+	}
+	p.Register = register.ProviderRegister{
+		NodeID:         p.ID.ToString(),
+		Address:        fmt.Sprintf("provider%d", i),
+		RootSigningKey: pubKey,
+		SigningKey:     pubKey,
+	}
+	n.Register.AddProvider(p.Register)
+
+	p.registerMgr = fcrregistermgr.NewFCRRegisterMgr(n.Register.URL(), false, true, time.Hour)
+	if err = p.registerMgr.Start(); err != nil {
+		n.t.Fatalf("Error starting provider register manager: %s", err.Error())
+	}
+	p.p2pServer = fcrp2pserver.NewFCRP2PServer(nil, p.registerMgr, tcpInactivityTimeout)
+	p.p2pServer.AddRequester(fcrmessages.ProviderPublishDHTOfferRequestType, requestPublishDHTOffer)
+	if err = p.p2pServer.Start(); err != nil {
+		n.t.Fatalf("Error starting provider P2P server: %s", err.Error())
+	}
+	return p
+}
+
+// NewOffer creates an offer signed by the provider for the given piece CIDs.
+func (p *Provider) NewOffer(cids []cid.ContentID, price uint64) (*cidoffer.CIDOffer, error) {
+	offer, err := cidoffer.NewCIDOffer(p.ID, cids, price, time.Now().Add(offerTTL).Unix(), 42)
+	if err != nil {
+		return nil, err
+	}
+	if err = offer.Sign(p.Key, fcrcrypto.InitialKeyVersion()); err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// PublishDHTOffers publishes offers to a gateway over its provider P2P port, and verifies the acknowledgement.
+func (p *Provider) PublishDHTOffers(gw *Gateway, offers []cidoffer.CIDOffer) error {
+	response, err := p.p2pServer.RequestGatewayFromProvider(gw.ID, fcrmessages.ProviderPublishDHTOfferRequestType, p, offers)
+	if err != nil {
+		return err
+	}
+	if err = response.Verify(gw.Key); err != nil {
+		return err
+	}
+	_, sig, err := fcrmessages.DecodeProviderPublishDHTOfferResponse(response)
+	if err != nil {
+		return err
+	}
+	if sig == "" {
+		return errors.New("empty acknowledgement signature")
+	}
+	return nil
+}
+
+// requestPublishDHTOffer is the requester sending a publish DHT offer request. It takes the provider and the offers.
+func requestPublishDHTOffer(reader *fcrp2pserver.FCRServerReader, writer *fcrp2pserver.FCRServerWriter, args ...interface{}) (*fcrmessages.FCRMessage, error) {
+	if len(args) != 2 {
+		return nil, errors.New("wrong arguments")
+	}
+	p, ok := args[0].(*Provider)
+	if !ok {
+		return nil, errors.New("wrong arguments")
+	}
+	offers, ok := args[1].([]cidoffer.CIDOffer)
+	if !ok {
+		return nil, errors.New("wrong arguments")
+	}
+	request, err := fcrmessages.EncodeProviderPublishDHTOfferRequest(p.ID, rand.Int63(), offers)
+	if err != nil {
+		return nil, err
+	}
+	if err = request.Sign(p.Key, fcrcrypto.InitialKeyVersion()); err != nil {
+		return nil, err
+	}
+	if err = writer.Write(request, tcpInactivityTimeout); err != nil {
+		return nil, err
+	}
+	return reader.Read(tcpInactivityTimeout)
+}
@@ -0,0 +1,141 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+func TestPriceQuote(t *testing.T) {
+	n := NewNetwork(t, 3, 0)
+	client := NewClient()
+	gwA, gwB := n.Gateways[0], n.Gateways[1]
+	ttl := time.Now().Add(time.Minute).Unix()
+	pieceCID := cid.NewRandomContentID()
+
+	gwB.Conf.Set("SEARCH_PRICE", "2 nanoFIL")
+	reloadSettings(t, n, gwB)
+	n.Register.SetGatewayPrices(gwB.ID.ToString(), "2 nanoFIL", "")
+	n.Refresh()
+
+	request, err := messages.EncodeClientPriceQuoteRequest(pieceCID, 10, ttl, 1, "paych-client")
+	require.NoError(t, err)
+	response, err := client.Send(gwA, request)
+	require.NoError(t, err)
+	quoteID, _, searchPrice, offerPrice, numDHT, dhtCost, expiry, manager, address, requestTTL, err := messages.DecodeClientPriceQuoteResponse(response)
+	require.NoError(t, err)
+	peerPrice, err := payment.ParseAmount("2 nanoFIL")
+	require.NoError(t, err)
+	assert.Equal(t, gwA.Core.Settings().SearchPrice.String(), searchPrice.String())
+	assert.Equal(t, gwA.Core.Settings().OfferPrice.String(), offerPrice.String())
+	assert.Equal(t, int64(1), numDHT)
+	assert.Equal(t, peerPrice.String(), dhtCost.String())
+	assert.WithinDuration(t, time.Now().Add(gwA.Core.Settings().PriceQuoteTTL), expiry, 2*time.Second)
+	assert.Equal(t, gwA.Core.Settings().PaymentManager, manager)
+	assert.Equal(t, gwA.Register.Address, address)
+	assert.Equal(t, gwA.Core.Settings().PaymentRequestTTL, requestTTL)
+
+	// The quote request can not be replayed.
+	status, response, err := client.SendForStatus(gwA, request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	var gwErr *messages.GatewayError
+	require.True(t, errors.As(messages.ErrorFromResponse(response), &gwErr))
+	assert.Equal(t, messages.ErrorReplay, gwErr.Code)
+
+	// Prices go up after the quote, the quote is still honoured for the client and the CID.
+	gwA.Conf.Set("SEARCH_PRICE", "1 FIL")
+	reloadSettings(t, n, gwA)
+	gwB.Conf.Set("SEARCH_PRICE", "4 nanoFIL")
+	reloadSettings(t, n, gwB)
+	n.Register.SetGatewayPrices(gwB.ID.ToString(), "4 nanoFIL", "")
+	n.Refresh()
+
+	request, err = fcrmessages.EncodeClientStandardDiscoverRequestV2(pieceCID, 1, ttl, "paych-client", Voucher(searchPrice))
+	require.NoError(t, err)
+	response, err = client.Send(gwA, withQuote(t, request, quoteID))
+	require.NoError(t, err)
+	_, _, _, _, _, paymentRequired, _, err := fcrmessages.DecodeClientStandardDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.False(t, paymentRequired)
+
+	request, err = fcrmessages.EncodeClientStandardDiscoverRequestV2(pieceCID, 2, ttl, "paych-other", Voucher(searchPrice))
+	require.NoError(t, err)
+	response, err = client.Send(gwA, withQuote(t, request, quoteID))
+	require.NoError(t, err)
+	_, _, _, _, _, paymentRequired, _, err = fcrmessages.DecodeClientStandardDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.True(t, paymentRequired)
+	quote, _ := payment.QuoteFromBody(response.GetMessageBody())
+	require.NotNil(t, quote)
+	assert.Equal(t, gwA.Core.Settings().SearchPrice.String(), quote.String())
+
+	// Gateway B's price went up, so the quote is not honoured for it and the current price is asked for.
+	request, err = fcrmessages.EncodeClientDHTDiscoverRequestV2(pieceCID, 3, ttl, 1, false, "paych-client", Voucher(dhtCost))
+	require.NoError(t, err)
+	response, err = client.Send(gwA, withQuote(t, request, quoteID))
+	require.NoError(t, err)
+	_, _, _, _, paymentRequired, _, err = fcrmessages.DecodeClientDHTDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.True(t, paymentRequired)
+	quote, _ = payment.QuoteFromBody(response.GetMessageBody())
+	require.NotNil(t, quote)
+	newPeerPrice, err := payment.ParseAmount("4 nanoFIL")
+	require.NoError(t, err)
+	assert.Equal(t, newPeerPrice.String(), quote.String())
+
+	// Once gateway B's price falls below the quote, the quoted cost is charged and gateway B is paid its new price.
+	gwB.Conf.Set("SEARCH_PRICE", "1 nanoFIL")
+	reloadSettings(t, n, gwB)
+	n.Register.SetGatewayPrices(gwB.ID.ToString(), "1 nanoFIL", "")
+	n.Refresh()
+
+	request, err = fcrmessages.EncodeClientDHTDiscoverRequestV2(pieceCID, 4, ttl, 1, false, "paych-client", Voucher(dhtCost))
+	require.NoError(t, err)
+	response, err = client.Send(gwA, withQuote(t, request, quoteID))
+	require.NoError(t, err)
+	contacted, _, _, _, paymentRequired, _, err := fcrmessages.DecodeClientDHTDiscoverResponseV2(response)
+	require.NoError(t, err)
+	assert.False(t, paymentRequired)
+	require.Len(t, contacted, 1)
+	assert.Equal(t, gwB.ID.ToString(), contacted[0].ToString())
+	newPeerPrice, err = payment.ParseAmount("1 nanoFIL")
+	require.NoError(t, err)
+	assert.Equal(t, newPeerPrice.String(), gwA.PaymentMgr.Paid(gwB.Register.Address).String())
+}
+
+// withQuote returns a copy of a client request referencing a price quote.
+func withQuote(t *testing.T, request *fcrmessages.FCRMessage, quoteID int64) *fcrmessages.FCRMessage {
+	body := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(request.GetMessageBody(), &body))
+	body["quote_id"] = quoteID
+	quoted, err := json.Marshal(body)
+	require.NoError(t, err)
+	return fcrmessages.CreateFCRMessage(request.GetMessageType(), quoted)
+}
@@ -0,0 +1,155 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/register"
+)
+
+// Register is a fake register service. It holds the gateways and providers registered with it in memory.
+type Register struct {
+	server *httptest.Server
+
+	lock      sync.RWMutex
+	gateways  []register.GatewayRegister
+	prices    map[string]gatewayPrices
+	providers []register.ProviderRegister
+}
+
+// gatewayPrices are the prices a gateway publishes along with its register entry.
+type gatewayPrices struct {
+	SearchPrice string `json:"searchPrice,omitempty"`
+	OfferPrice  string `json:"offerPrice,omitempty"`
+}
+
+// gatewayEntry is the register entry of a gateway, as served by the register service.
+type gatewayEntry struct {
+	register.GatewayRegister
+	gatewayPrices
+}
+
+// NewRegister starts a fake register service.
+func NewRegister() *Register {
+	r := &Register{
+		gateways:  make([]register.GatewayRegister, 0),
+		prices:    make(map[string]gatewayPrices),
+		providers: make([]register.ProviderRegister, 0),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/registers/gateway", r.handleGateways)
+	mux.HandleFunc("/registers/gateway/", r.handleGateways)
+	mux.HandleFunc("/registers/provider", r.handleProviders)
+	mux.HandleFunc("/registers/provider/", r.handleProviders)
+	r.server = httptest.NewServer(mux)
+	return r
+}
+
+// URL returns the URL of the register service, to be used as REGISTER_API_URL.
+func (r *Register) URL() string {
+	return r.server.URL
+}
+
+// AddGateway registers a gateway.
+func (r *Register) AddGateway(gateway register.GatewayRegister) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.gateways = append(r.gateways, gateway)
+}
+
+// SetGatewayPrices publishes the search and offer prices of a gateway, in the format of the price settings.
+func (r *Register) SetGatewayPrices(nodeID string, searchPrice string, offerPrice string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.prices[nodeID] = gatewayPrices{SearchPrice: searchPrice, OfferPrice: offerPrice}
+}
+
+// AddProvider registers a provider.
+func (r *Register) AddProvider(provider register.ProviderRegister) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.providers = append(r.providers, provider)
+}
+
+// Close stops the register service.
+func (r *Register) Close() {
+	r.server.Close()
+}
+
+// handleGateways serves the gateway registers.
+func (r *Register) handleGateways(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch req.Method {
+	case http.MethodGet:
+		entries := make([]gatewayEntry, len(r.gateways))
+		for i, gateway := range r.gateways {
+			entries[i] = gatewayEntry{GatewayRegister: gateway, gatewayPrices: r.prices[gateway.NodeID]}
+		}
+		writeJSON(w, entries)
+	case http.MethodPost:
+		gateway := register.GatewayRegister{}
+		if err := json.NewDecoder(req.Body).Decode(&gateway); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// A gateway registering again, to publish a new signing key, replaces its entry.
+		for i := range r.gateways {
+			if r.gateways[i].NodeID == gateway.NodeID {
+				r.gateways[i] = gateway
+				return
+			}
+		}
+		r.gateways = append(r.gateways, gateway)
+	case http.MethodDelete:
+		r.gateways = make([]register.GatewayRegister, 0)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProviders serves the provider registers.
+func (r *Register) handleProviders(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, r.providers)
+	case http.MethodPost:
+		provider := register.ProviderRegister{}
+		if err := json.NewDecoder(req.Body).Decode(&provider); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.providers = append(r.providers, provider)
+	case http.MethodDelete:
+		r.providers = make([]register.ProviderRegister, 0)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,54 @@
+package harness
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+func TestReloadSettings(t *testing.T) {
+	n := NewNetwork(t, 1, 0)
+	gw := n.Gateways[0]
+	bindRestAPI := gw.Core.Settings().BindRestAPI
+
+	// The search price is applied, the REST port and the client network info derived from it only change after a
+	// restart.
+	gw.Conf.Set("SEARCH_PRICE", "2 nanoFIL")
+	gw.Conf.Set("BIND_REST_API", freePort(t))
+	request, err := messages.EncodeGatewayAdminReloadSettingsRequest()
+	require.NoError(t, err)
+	response, err := n.SendAdminRequest(gw, request)
+	require.NoError(t, err)
+	reloaded, restartRequired, err := messages.DecodeGatewayAdminReloadSettingsResponse(response)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SEARCH_PRICE"}, reloaded)
+	assert.Equal(t, []string{"BIND_REST_API", "CLIENT_NETWORK_INFO"}, restartRequired)
+	assert.Equal(t, "2000000000", gw.Core.Settings().SearchPrice.String())
+	assert.Equal(t, bindRestAPI, gw.Core.Settings().BindRestAPI)
+
+	// Invalid settings are not applied.
+	gw.Conf.Set("SEARCH_PRICE", "free")
+	request, err = messages.EncodeGatewayAdminReloadSettingsRequest()
+	require.NoError(t, err)
+	_, err = n.SendAdminRequest(gw, request)
+	assert.Error(t, err)
+	assert.Equal(t, "2000000000", gw.Core.Settings().SearchPrice.String())
+}
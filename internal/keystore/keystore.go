@@ -0,0 +1,220 @@
+package keystore
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv is the environment variable holding the passphrase of the keystore.
+const PassphraseEnv = "KEYSTORE_PASSPHRASE"
+
+// fileVersion is the version of the format of keystore files.
+const fileVersion = 1
+
+// Parameters of the scrypt key derivation.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	keySize      = 32
+	saltSize     = 16
+	filePerm     = 0600
+	tmpExtension = ".tmp"
+)
+
+// Identity is the identity of the gateway and the keys supplied by the admin.
+type Identity struct {
+	NodeID            string `json:"node_id"`
+	PrivateKey        string `json:"private_key"`
+	PrivateKeyVersion uint32 `json:"private_key_version"`
+
+	// The pending fields are only set while a key rotation is scheduled. The activation is a unix timestamp.
+	PendingPrivateKey        string `json:"pending_private_key,omitempty"`
+	PendingPrivateKeyVersion uint32 `json:"pending_private_key_version,omitempty"`
+	PendingActivation        int64  `json:"pending_activation,omitempty"`
+
+	// The payment fields are only set once the payment manager has been initialised.
+	WalletPrivateKey string `json:"wallet_private_key,omitempty"`
+	LotusAPIAddr     string `json:"lotus_api_addr,omitempty"`
+	LotusAuthToken   string `json:"lotus_auth_token,omitempty"`
+}
+
+// HasPayment returns true if the identity holds the keys of the payment manager.
+func (id *Identity) HasPayment() bool {
+	return id.WalletPrivateKey != ""
+}
+
+// HasPendingKey returns true if the identity holds a key version that the gateway rotates to.
+func (id *Identity) HasPendingKey() bool {
+	return id.PendingPrivateKey != ""
+}
+
+// file is the content of a keystore file.
+type file struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keystore stores an identity in a file, encrypted with AES-GCM under a key derived from a passphrase with scrypt.
+// It is safe for concurrent use.
+type Keystore struct {
+	path       string
+	passphrase []byte
+	lock       sync.Mutex
+}
+
+// NewKeystore creates a keystore stored in the file at path.
+func NewKeystore(path string, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty keystore passphrase")
+	}
+	return &Keystore{path: path, passphrase: []byte(passphrase)}, nil
+}
+
+// Passphrase returns the passphrase of the keystore: the content of the environment variable KEYSTORE_PASSPHRASE if
+// it is set, or else the first line of passphraseFile. It returns an empty passphrase if neither is set.
+func Passphrase(passphraseFile string) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if passphraseFile == "" {
+		return "", nil
+	}
+	content, err := ioutil.ReadFile(passphraseFile)
+	if err != nil {
+		return "", fmt.Errorf("error reading keystore passphrase file: %s", err.Error())
+	}
+	passphrase := strings.SplitN(string(content), "\n", 2)[0]
+	return strings.TrimRight(passphrase, "\r"), nil
+}
+
+// Save encrypts an identity and stores it, replacing any stored identity.
+func (k *Keystore) Save(id *Identity) error {
+	plaintext, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, saltSize)
+	if _, err = rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := k.cipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	content, err := json.Marshal(file{
+		Version:    fileVersion,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if err = os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so that a crash never leaves a partially written keystore.
+	tmp := k.path + tmpExtension
+	if err = ioutil.WriteFile(tmp, content, filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// Load decrypts and returns the stored identity, or nil if no identity is stored.
+func (k *Keystore) Load() (*Identity, error) {
+	k.lock.Lock()
+	content, err := ioutil.ReadFile(k.path)
+	k.lock.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := file{}
+	if err = json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("invalid keystore file: %s", err.Error())
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported keystore file version: %d", f.Version)
+	}
+	aead, err := k.cipher(f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid keystore file: bad nonce")
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("error decrypting keystore: wrong passphrase or corrupted file")
+	}
+	id := &Identity{}
+	if err = json.Unmarshal(plaintext, id); err != nil {
+		return nil, fmt.Errorf("invalid keystore content: %s", err.Error())
+	}
+	return id, nil
+}
+
+// Wipe removes the stored identity. Wiping an empty keystore is not an error.
+func (k *Keystore) Wipe() error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if err := os.Remove(k.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(k.path + tmpExtension); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// cipher returns the AES-GCM cipher keyed with the key derived from the passphrase and salt.
+func (k *Keystore) cipher(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(k.passphrase, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,79 @@
+package keystore
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystoreSaveLoadWipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore")
+	k, err := NewKeystore(path, "passphrase")
+	require.NoError(t, err)
+
+	id, err := k.Load()
+	require.NoError(t, err)
+	assert.Nil(t, id)
+
+	saved := &Identity{NodeID: "node", PrivateKey: "key", PrivateKeyVersion: 1, WalletPrivateKey: "wallet"}
+	require.NoError(t, k.Save(saved))
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "wallet")
+
+	id, err = k.Load()
+	require.NoError(t, err)
+	assert.Equal(t, saved, id)
+	assert.True(t, id.HasPayment())
+
+	// The identity can not be decrypted with another passphrase.
+	other, err := NewKeystore(path, "other passphrase")
+	require.NoError(t, err)
+	_, err = other.Load()
+	assert.Error(t, err)
+
+	require.NoError(t, k.Wipe())
+	id, err = k.Load()
+	require.NoError(t, err)
+	assert.Nil(t, id)
+	require.NoError(t, k.Wipe())
+}
+
+func TestPassphrase(t *testing.T) {
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	require.NoError(t, ioutil.WriteFile(passphraseFile, []byte("from file\n"), 0600))
+
+	os.Unsetenv(PassphraseEnv)
+	passphrase, err := Passphrase(passphraseFile)
+	require.NoError(t, err)
+	assert.Equal(t, "from file", passphrase)
+
+	passphrase, err = Passphrase("")
+	require.NoError(t, err)
+	assert.Equal(t, "", passphrase)
+
+	os.Setenv(PassphraseEnv, "from env")
+	defer os.Unsetenv(PassphraseEnv)
+	passphrase, err = Passphrase(passphraseFile)
+	require.NoError(t, err)
+	assert.Equal(t, "from env", passphrase)
+}
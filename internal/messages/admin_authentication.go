@@ -0,0 +1,69 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// adminAuthentication are the fields added to the body of an admin request to protect it against replays. They are
+// covered by the signature of the request, so the request must be signed once they are added.
+type adminAuthentication struct {
+	Nonce     int64 `json:"nonce"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// AddAdminAuthentication returns a copy of an admin request, as encoded by the admin encoders of fcrmessages or of
+// this package, with a nonce and a timestamp added to its body. The returned request is not signed.
+func AddAdminAuthentication(fcrMsg *fcrmessages.FCRMessage, nonce int64, timestamp time.Time) (*fcrmessages.FCRMessage, error) {
+	body := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(fcrMsg.GetMessageBody(), &body); err != nil {
+		return nil, err
+	}
+	auth, err := json.Marshal(adminAuthentication{Nonce: nonce, Timestamp: timestamp.Unix()})
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(auth, &body); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(fcrMsg.GetMessageType(), raw), nil
+}
+
+// DecodeAdminAuthentication is used to get the nonce and the timestamp of an admin request. It returns false if the
+// request carries no timestamp, as the requests encoded without AddAdminAuthentication.
+func DecodeAdminAuthentication(fcrMsg *fcrmessages.FCRMessage) (
+	int64, // nonce
+	time.Time, // timestamp
+	bool, // found
+	error, // error
+) {
+	msg := adminAuthentication{}
+	if err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg); err != nil {
+		return 0, time.Time{}, false, err
+	}
+	if msg.Timestamp == 0 {
+		return 0, time.Time{}, false, nil
+	}
+	return msg.Nonce, time.Unix(msg.Timestamp, 0), true, nil
+}
@@ -0,0 +1,49 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+func TestAdminAuthentication(t *testing.T) {
+	request, err := fcrmessages.EncodeGatewayAdminForceRefreshRequest(true)
+	require.NoError(t, err)
+	_, _, found, err := DecodeAdminAuthentication(request)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	timestamp := time.Unix(1000, 0)
+	authenticated, err := AddAdminAuthentication(request, 42, timestamp)
+	require.NoError(t, err)
+	assert.Equal(t, request.GetMessageType(), authenticated.GetMessageType())
+	nonce, decodedTimestamp, found, err := DecodeAdminAuthentication(authenticated)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(42), nonce)
+	assert.Equal(t, timestamp, decodedTimestamp)
+
+	// The fields of the request are kept.
+	refresh, err := fcrmessages.DecodeGatewayAdminForceRefreshRequest(authenticated)
+	require.NoError(t, err)
+	assert.True(t, refresh)
+}
@@ -0,0 +1,84 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// clientPriceQuoteRequest is the request from client to gateway to quote the prices of the requests on a cid. The
+// payment channel address identifies the client the quote is given to, and the number of gateways to contact
+// prices a DHT discovery, if it is not 0. The nonce and ttl are used, as for the other client requests, to reject
+// replays.
+type clientPriceQuoteRequest struct {
+	PieceCID  string `json:"piece_cid"`
+	Nonce     int64  `json:"nonce"`
+	TTL       int64  `json:"ttl"`
+	NumDHT    int64  `json:"num_dht"`
+	PaychAddr string `json:"payment_channel_address"`
+}
+
+// EncodeClientPriceQuoteRequest is used to get the FCRMessage of clientPriceQuoteRequest
+func EncodeClientPriceQuoteRequest(
+	pieceCID *cid.ContentID,
+	nonce int64,
+	ttl int64,
+	numDHT int64,
+	paychAddr string,
+) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(clientPriceQuoteRequest{
+		PieceCID:  pieceCID.ToString(),
+		Nonce:     nonce,
+		TTL:       ttl,
+		NumDHT:    numDHT,
+		PaychAddr: paychAddr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(ClientPriceQuoteRequestType, body), nil
+}
+
+// DecodeClientPriceQuoteRequest is used to get the fields from FCRMessage of clientPriceQuoteRequest
+func DecodeClientPriceQuoteRequest(fcrMsg *fcrmessages.FCRMessage) (
+	*cid.ContentID, // piece cid
+	int64, // nonce
+	int64, // ttl
+	int64, // num dht
+	string, // payment channel address
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != ClientPriceQuoteRequestType {
+		return nil, 0, 0, 0, "", errors.New("message type mismatch")
+	}
+	msg := clientPriceQuoteRequest{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return nil, 0, 0, 0, "", err
+	}
+	contentID, err := cid.NewContentIDFromHexString(msg.PieceCID)
+	if err != nil {
+		return nil, 0, 0, 0, "", err
+	}
+	if msg.NumDHT < 0 {
+		return nil, 0, 0, 0, "", errors.New("negative num dht")
+	}
+	return contentID, msg.Nonce, msg.TTL, msg.NumDHT, msg.PaychAddr, nil
+}
@@ -0,0 +1,110 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// clientPriceQuoteResponse is the response to clientPriceQuoteRequest. It gives the prices, in attoFIL, honoured
+// for requests referencing the quote id until the expiry, and the payment channel parameters accepted by the gateway.
+type clientPriceQuoteResponse struct {
+	QuoteID           int64  `json:"quote_id"`
+	PieceCID          string `json:"piece_cid"`
+	SearchPrice       string `json:"search_price"`
+	OfferPrice        string `json:"offer_price"`
+	NumDHT            int64  `json:"num_dht"`
+	DHTCost           string `json:"dht_cost"`
+	Expiry            int64  `json:"expiry"`
+	PaymentManager    string `json:"payment_manager"`
+	PaymentAddress    string `json:"payment_address"`
+	PaymentRequestTTL int64  `json:"payment_request_ttl"`
+}
+
+// EncodeClientPriceQuoteResponse is used to get the FCRMessage of clientPriceQuoteResponse
+func EncodeClientPriceQuoteResponse(
+	quoteID int64,
+	pieceCID *cid.ContentID,
+	searchPrice *big.Int,
+	offerPrice *big.Int,
+	numDHT int64,
+	dhtCost *big.Int,
+	expiry time.Time,
+	paymentManager string,
+	paymentAddress string,
+	paymentRequestTTL time.Duration,
+) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(clientPriceQuoteResponse{
+		QuoteID:           quoteID,
+		PieceCID:          pieceCID.ToString(),
+		SearchPrice:       searchPrice.String(),
+		OfferPrice:        offerPrice.String(),
+		NumDHT:            numDHT,
+		DHTCost:           dhtCost.String(),
+		Expiry:            expiry.Unix(),
+		PaymentManager:    paymentManager,
+		PaymentAddress:    paymentAddress,
+		PaymentRequestTTL: int64(paymentRequestTTL / time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(ClientPriceQuoteResponseType, body), nil
+}
+
+// DecodeClientPriceQuoteResponse is used to get the fields from FCRMessage of clientPriceQuoteResponse
+func DecodeClientPriceQuoteResponse(fcrMsg *fcrmessages.FCRMessage) (
+	int64, // quote id
+	*cid.ContentID, // piece cid
+	*big.Int, // search price
+	*big.Int, // offer price
+	int64, // num dht
+	*big.Int, // dht cost
+	time.Time, // expiry
+	string, // payment manager
+	string, // payment address
+	time.Duration, // payment request ttl
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != ClientPriceQuoteResponseType {
+		return 0, nil, nil, nil, 0, nil, time.Time{}, "", "", 0, errors.New("message type mismatch")
+	}
+	msg := clientPriceQuoteResponse{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return 0, nil, nil, nil, 0, nil, time.Time{}, "", "", 0, err
+	}
+	contentID, err := cid.NewContentIDFromHexString(msg.PieceCID)
+	if err != nil {
+		return 0, nil, nil, nil, 0, nil, time.Time{}, "", "", 0, err
+	}
+	prices := make([]*big.Int, 0, 3)
+	for _, price := range []string{msg.SearchPrice, msg.OfferPrice, msg.DHTCost} {
+		amount, ok := new(big.Int).SetString(price, 10)
+		if !ok {
+			return 0, nil, nil, nil, 0, nil, time.Time{}, "", "", 0, errors.New("invalid price")
+		}
+		prices = append(prices, amount)
+	}
+	return msg.QuoteID, contentID, prices[0], prices[1], msg.NumDHT, prices[2], time.Unix(msg.Expiry, 0),
+		msg.PaymentManager, msg.PaymentAddress, time.Duration(msg.PaymentRequestTTL) * time.Second, nil
+}
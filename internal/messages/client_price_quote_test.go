@@ -0,0 +1,60 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPriceQuote(t *testing.T) {
+	pieceCID, err := cid.NewContentIDFromHexString("0102")
+	require.NoError(t, err)
+
+	request, err := EncodeClientPriceQuoteRequest(pieceCID, 5, 1060, 2, "paych")
+	require.NoError(t, err)
+	decodedCID, nonce, ttl, numDHT, paychAddr, err := DecodeClientPriceQuoteRequest(request)
+	require.NoError(t, err)
+	assert.Equal(t, pieceCID.ToString(), decodedCID.ToString())
+	assert.Equal(t, int64(5), nonce)
+	assert.Equal(t, int64(1060), ttl)
+	assert.Equal(t, int64(2), numDHT)
+	assert.Equal(t, "paych", paychAddr)
+
+	expiry := time.Unix(1000, 0)
+	response, err := EncodeClientPriceQuoteResponse(7, pieceCID, big.NewInt(10), big.NewInt(20), 2, big.NewInt(30), expiry, "memory", "gateway0", time.Minute)
+	require.NoError(t, err)
+	quoteID, decodedCID, searchPrice, offerPrice, numDHT, dhtCost, decodedExpiry, manager, address, requestTTL, err := DecodeClientPriceQuoteResponse(response)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), quoteID)
+	assert.Equal(t, pieceCID.ToString(), decodedCID.ToString())
+	assert.Equal(t, big.NewInt(10), searchPrice)
+	assert.Equal(t, big.NewInt(20), offerPrice)
+	assert.Equal(t, int64(2), numDHT)
+	assert.Equal(t, big.NewInt(30), dhtCost)
+	assert.Equal(t, expiry, decodedExpiry)
+	assert.Equal(t, "memory", manager)
+	assert.Equal(t, "gateway0", address)
+	assert.Equal(t, time.Minute, requestTTL)
+
+	_, _, _, _, _, err = DecodeClientPriceQuoteRequest(response)
+	assert.Error(t, err)
+}
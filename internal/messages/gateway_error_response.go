@@ -0,0 +1,128 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// ErrorCode is the reason why a gateway refuses a request.
+type ErrorCode int32
+
+// Error codes of error responses.
+const (
+	ErrorInvalidMessage      ErrorCode = 1  // The request can not be decoded or is not valid
+	ErrorExpired             ErrorCode = 2  // The ttl or timestamp of the request has passed
+	ErrorBadSignature        ErrorCode = 3  // The signature of the request or of its content does not verify
+	ErrorUnknownSender       ErrorCode = 4  // The sender of the request is not in the register
+	ErrorInsufficientPayment ErrorCode = 5  // The request is not paid for, or its payment is not valid
+	ErrorNotInitialised      ErrorCode = 6  // The gateway has not reached the state required to serve the request
+	ErrorReplay              ErrorCode = 7  // The nonce of the request has already been used
+	ErrorRefused             ErrorCode = 8  // The sender is not allowed to send the request, for instance because of its reputation
+	ErrorUnavailable         ErrorCode = 9  // The gateway is shutting down or overloaded
+	ErrorInternal            ErrorCode = 10 // The gateway failed to serve the request
+)
+
+// String returns the name of the error code.
+func (code ErrorCode) String() string {
+	switch code {
+	case ErrorInvalidMessage:
+		return "invalid message"
+	case ErrorExpired:
+		return "expired"
+	case ErrorBadSignature:
+		return "bad signature"
+	case ErrorUnknownSender:
+		return "unknown sender"
+	case ErrorInsufficientPayment:
+		return "insufficient payment"
+	case ErrorNotInitialised:
+		return "not initialised"
+	case ErrorReplay:
+		return "replay"
+	case ErrorRefused:
+		return "refused"
+	case ErrorUnavailable:
+		return "unavailable"
+	case ErrorInternal:
+		return "internal"
+	default:
+		return fmt.Sprintf("unknown error code %d", int32(code))
+	}
+}
+
+// GatewayError is the error carried by an error response.
+type GatewayError struct {
+	Code   ErrorCode
+	Detail string
+}
+
+// Error returns the code and detail of the error.
+func (e *GatewayError) Error() string {
+	return fmt.Sprintf("gateway error (%s): %s", e.Code.String(), e.Detail)
+}
+
+// gatewayErrorResponse is the response of a gateway to a request it refuses, on both the REST and P2P APIs.
+type gatewayErrorResponse struct {
+	Code   ErrorCode `json:"code"`
+	Detail string    `json:"detail"`
+}
+
+// EncodeGatewayErrorResponse is used to get the FCRMessage of gatewayErrorResponse
+func EncodeGatewayErrorResponse(code ErrorCode, detail string) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(gatewayErrorResponse{
+		Code:   code,
+		Detail: detail,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(GatewayErrorResponseType, body), nil
+}
+
+// DecodeGatewayErrorResponse is used to get the fields from FCRMessage of gatewayErrorResponse
+func DecodeGatewayErrorResponse(fcrMsg *fcrmessages.FCRMessage) (
+	ErrorCode, // code
+	string, // detail
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != GatewayErrorResponseType {
+		return 0, "", errors.New("message type mismatch")
+	}
+	msg := gatewayErrorResponse{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return 0, "", err
+	}
+	return msg.Code, msg.Detail, nil
+}
+
+// ErrorFromResponse returns the error carried by a response if it is an error response, as a *GatewayError, and nil
+// otherwise.
+func ErrorFromResponse(fcrMsg *fcrmessages.FCRMessage) error {
+	if fcrMsg.GetMessageType() != GatewayErrorResponseType {
+		return nil
+	}
+	code, detail, err := DecodeGatewayErrorResponse(fcrMsg)
+	if err != nil {
+		return err
+	}
+	return &GatewayError{Code: code, Detail: detail}
+}
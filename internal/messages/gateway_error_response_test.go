@@ -0,0 +1,44 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayErrorResponse(t *testing.T) {
+	response, err := EncodeGatewayErrorResponse(ErrorExpired, "Request expired.")
+	require.NoError(t, err)
+	code, detail, err := DecodeGatewayErrorResponse(response)
+	require.NoError(t, err)
+	assert.Equal(t, ErrorExpired, code)
+	assert.Equal(t, "Request expired.", detail)
+
+	var gatewayErr *GatewayError
+	require.True(t, errors.As(ErrorFromResponse(response), &gatewayErr))
+	assert.Equal(t, ErrorExpired, gatewayErr.Code)
+	assert.Equal(t, "gateway error (expired): Request expired.", gatewayErr.Error())
+
+	other, err := EncodeGatewayAdminWipeKeysResponse(true)
+	require.NoError(t, err)
+	assert.NoError(t, ErrorFromResponse(other))
+	_, _, err = DecodeGatewayErrorResponse(other)
+	assert.Error(t, err)
+}
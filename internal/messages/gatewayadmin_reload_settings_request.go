@@ -0,0 +1,45 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// gatewayAdminReloadSettingsRequest is the request from an admin client to a gateway to reload its settings
+type gatewayAdminReloadSettingsRequest struct {
+}
+
+// EncodeGatewayAdminReloadSettingsRequest is used to get the FCRMessage of gatewayAdminReloadSettingsRequest
+func EncodeGatewayAdminReloadSettingsRequest() (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(gatewayAdminReloadSettingsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(GatewayAdminReloadSettingsRequestType, body), nil
+}
+
+// DecodeGatewayAdminReloadSettingsRequest is used to check the FCRMessage of gatewayAdminReloadSettingsRequest
+func DecodeGatewayAdminReloadSettingsRequest(fcrMsg *fcrmessages.FCRMessage) error {
+	if fcrMsg.GetMessageType() != GatewayAdminReloadSettingsRequestType {
+		return errors.New("message type mismatch")
+	}
+	msg := gatewayAdminReloadSettingsRequest{}
+	return json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+}
@@ -0,0 +1,63 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// gatewayAdminReloadSettingsResponse is the response to gatewayAdminReloadSettingsRequest, listing the settings
+// that changed by their configuration key
+type gatewayAdminReloadSettingsResponse struct {
+	Reloaded        []string `json:"reloaded"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// EncodeGatewayAdminReloadSettingsResponse is used to get the FCRMessage of gatewayAdminReloadSettingsResponse
+func EncodeGatewayAdminReloadSettingsResponse(
+	reloaded []string,
+	restartRequired []string,
+) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(gatewayAdminReloadSettingsResponse{
+		Reloaded:        reloaded,
+		RestartRequired: restartRequired,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(GatewayAdminReloadSettingsResponseType, body), nil
+}
+
+// DecodeGatewayAdminReloadSettingsResponse is used to get the fields from FCRMessage of
+// gatewayAdminReloadSettingsResponse
+func DecodeGatewayAdminReloadSettingsResponse(fcrMsg *fcrmessages.FCRMessage) (
+	[]string, // reloaded
+	[]string, // restart required
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != GatewayAdminReloadSettingsResponseType {
+		return nil, nil, errors.New("message type mismatch")
+	}
+	msg := gatewayAdminReloadSettingsResponse{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg.Reloaded, msg.RestartRequired, nil
+}
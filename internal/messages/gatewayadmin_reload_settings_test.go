@@ -0,0 +1,38 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayAdminReloadSettings(t *testing.T) {
+	request, err := EncodeGatewayAdminReloadSettingsRequest()
+	require.NoError(t, err)
+	require.NoError(t, DecodeGatewayAdminReloadSettingsRequest(request))
+
+	response, err := EncodeGatewayAdminReloadSettingsResponse([]string{"SEARCH_PRICE"}, []string{"BIND_REST_API"})
+	require.NoError(t, err)
+	reloaded, restartRequired, err := DecodeGatewayAdminReloadSettingsResponse(response)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SEARCH_PRICE"}, reloaded)
+	assert.Equal(t, []string{"BIND_REST_API"}, restartRequired)
+
+	assert.Error(t, DecodeGatewayAdminReloadSettingsRequest(response))
+}
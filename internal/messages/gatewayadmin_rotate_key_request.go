@@ -0,0 +1,72 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// gatewayAdminRotateKeyRequest is the request from an admin client to a gateway to rotate its signing key to a new
+// key version, from the given activation time.
+type gatewayAdminRotateKeyRequest struct {
+	PrivateKey        string `json:"private_key"`
+	PrivateKeyVersion uint32 `json:"private_key_version"`
+	Activation        int64  `json:"activation"`
+}
+
+// EncodeGatewayAdminRotateKeyRequest is used to get the FCRMessage of gatewayAdminRotateKeyRequest
+func EncodeGatewayAdminRotateKeyRequest(
+	privateKey *fcrcrypto.KeyPair,
+	keyVersion *fcrcrypto.KeyVersion,
+	activation time.Time,
+) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(gatewayAdminRotateKeyRequest{
+		PrivateKey:        privateKey.EncodePrivateKey(),
+		PrivateKeyVersion: keyVersion.EncodeKeyVersion(),
+		Activation:        activation.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(GatewayAdminRotateKeyRequestType, body), nil
+}
+
+// DecodeGatewayAdminRotateKeyRequest is used to get the fields from FCRMessage of gatewayAdminRotateKeyRequest
+func DecodeGatewayAdminRotateKeyRequest(fcrMsg *fcrmessages.FCRMessage) (
+	*fcrcrypto.KeyPair, // private key
+	*fcrcrypto.KeyVersion, // private key version
+	time.Time, // activation
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != GatewayAdminRotateKeyRequestType {
+		return nil, nil, time.Time{}, errors.New("message type mismatch")
+	}
+	msg := gatewayAdminRotateKeyRequest{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	privKey, err := fcrcrypto.DecodePrivateKey(msg.PrivateKey)
+	if err != nil {
+		return nil, nil, time.Time{}, errors.New("fail to decode private key")
+	}
+	return privKey, fcrcrypto.DecodeKeyVersion(msg.PrivateKeyVersion), time.Unix(msg.Activation, 0), nil
+}
@@ -0,0 +1,55 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// gatewayAdminRotateKeyResponse is the response to gatewayAdminRotateKeyRequest
+type gatewayAdminRotateKeyResponse struct {
+	Scheduled bool `json:"scheduled"`
+}
+
+// EncodeGatewayAdminRotateKeyResponse is used to get the FCRMessage of gatewayAdminRotateKeyResponse
+func EncodeGatewayAdminRotateKeyResponse(scheduled bool) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(gatewayAdminRotateKeyResponse{
+		Scheduled: scheduled,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(GatewayAdminRotateKeyResponseType, body), nil
+}
+
+// DecodeGatewayAdminRotateKeyResponse is used to get the fields from FCRMessage of gatewayAdminRotateKeyResponse
+func DecodeGatewayAdminRotateKeyResponse(fcrMsg *fcrmessages.FCRMessage) (
+	bool, // scheduled
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != GatewayAdminRotateKeyResponseType {
+		return false, errors.New("message type mismatch")
+	}
+	msg := gatewayAdminRotateKeyResponse{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return false, err
+	}
+	return msg.Scheduled, nil
+}
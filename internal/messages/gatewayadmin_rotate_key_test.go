@@ -0,0 +1,47 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayAdminRotateKey(t *testing.T) {
+	key, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	require.NoError(t, err)
+	activation := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	request, err := EncodeGatewayAdminRotateKeyRequest(key, fcrcrypto.DecodeKeyVersion(2), activation)
+	require.NoError(t, err)
+	privKey, privKeyVer, decodedActivation, err := DecodeGatewayAdminRotateKeyRequest(request)
+	require.NoError(t, err)
+	assert.Equal(t, key.EncodePrivateKey(), privKey.EncodePrivateKey())
+	assert.Equal(t, uint32(2), privKeyVer.EncodeKeyVersion())
+	assert.True(t, activation.Equal(decodedActivation))
+
+	response, err := EncodeGatewayAdminRotateKeyResponse(true)
+	require.NoError(t, err)
+	scheduled, err := DecodeGatewayAdminRotateKeyResponse(response)
+	require.NoError(t, err)
+	assert.True(t, scheduled)
+
+	_, _, _, err = DecodeGatewayAdminRotateKeyRequest(response)
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// gatewayAdminWipeKeysRequest is the request from an admin client to a gateway to wipe its stored keys
+type gatewayAdminWipeKeysRequest struct {
+	Wipe bool `json:"wipe"`
+}
+
+// EncodeGatewayAdminWipeKeysRequest is used to get the FCRMessage of gatewayAdminWipeKeysRequest
+func EncodeGatewayAdminWipeKeysRequest(wipe bool) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(gatewayAdminWipeKeysRequest{
+		Wipe: wipe,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(GatewayAdminWipeKeysRequestType, body), nil
+}
+
+// DecodeGatewayAdminWipeKeysRequest is used to get the fields from FCRMessage of gatewayAdminWipeKeysRequest
+func DecodeGatewayAdminWipeKeysRequest(fcrMsg *fcrmessages.FCRMessage) (
+	bool, // wipe
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != GatewayAdminWipeKeysRequestType {
+		return false, errors.New("message type mismatch")
+	}
+	msg := gatewayAdminWipeKeysRequest{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return false, err
+	}
+	return msg.Wipe, nil
+}
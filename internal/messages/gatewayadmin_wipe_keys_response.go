@@ -0,0 +1,55 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// gatewayAdminWipeKeysResponse is the response to gatewayAdminWipeKeysRequest
+type gatewayAdminWipeKeysResponse struct {
+	Wiped bool `json:"wiped"`
+}
+
+// EncodeGatewayAdminWipeKeysResponse is used to get the FCRMessage of gatewayAdminWipeKeysResponse
+func EncodeGatewayAdminWipeKeysResponse(wiped bool) (*fcrmessages.FCRMessage, error) {
+	body, err := json.Marshal(gatewayAdminWipeKeysResponse{
+		Wiped: wiped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(GatewayAdminWipeKeysResponseType, body), nil
+}
+
+// DecodeGatewayAdminWipeKeysResponse is used to get the fields from FCRMessage of gatewayAdminWipeKeysResponse
+func DecodeGatewayAdminWipeKeysResponse(fcrMsg *fcrmessages.FCRMessage) (
+	bool, // wiped
+	error, // error
+) {
+	if fcrMsg.GetMessageType() != GatewayAdminWipeKeysResponseType {
+		return false, errors.New("message type mismatch")
+	}
+	msg := gatewayAdminWipeKeysResponse{}
+	err := json.Unmarshal(fcrMsg.GetMessageBody(), &msg)
+	if err != nil {
+		return false, err
+	}
+	return msg.Wiped, nil
+}
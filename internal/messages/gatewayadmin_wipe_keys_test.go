@@ -0,0 +1,40 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayAdminWipeKeys(t *testing.T) {
+	request, err := EncodeGatewayAdminWipeKeysRequest(true)
+	require.NoError(t, err)
+	wipe, err := DecodeGatewayAdminWipeKeysRequest(request)
+	require.NoError(t, err)
+	assert.True(t, wipe)
+
+	response, err := EncodeGatewayAdminWipeKeysResponse(true)
+	require.NoError(t, err)
+	wiped, err := DecodeGatewayAdminWipeKeysResponse(response)
+	require.NoError(t, err)
+	assert.True(t, wiped)
+
+	_, err = DecodeGatewayAdminWipeKeysRequest(response)
+	assert.Error(t, err)
+}
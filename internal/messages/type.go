@@ -0,0 +1,37 @@
+package messages
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Message types originating from Retrieval Gateway
+const (
+	GatewayErrorResponseType = 220
+)
+
+// Message types originating from Retrieval Client
+const (
+	ClientPriceQuoteRequestType  = 120
+	ClientPriceQuoteResponseType = 121
+)
+
+// Message types originating from Retrieval Gateway Admin
+const (
+	GatewayAdminWipeKeysRequestType        = 420
+	GatewayAdminWipeKeysResponseType       = 421
+	GatewayAdminRotateKeyRequestType       = 422
+	GatewayAdminRotateKeyResponseType      = 423
+	GatewayAdminReloadSettingsRequestType  = 424
+	GatewayAdminReloadSettingsResponseType = 425
+)
@@ -0,0 +1,85 @@
+package metrics
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/offerstore"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/reputation"
+)
+
+// reputationBuckets are the upper bounds of the buckets of the reputation histogram.
+var reputationBuckets = []float64{-10000, -1000, -300, -100, -10, 0, 10, 100, 300, 1000, 10000}
+
+// WatchOffers exposes the number of offers in the offer store, by kind of offer.
+func (m *Metrics) WatchOffers(offers *offerstore.OfferMgr) {
+	for _, kind := range []offerstore.Kind{offerstore.DHTOffer, offerstore.GroupOffer} {
+		kind := kind
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "offers",
+			Help:        "Number of offers in the offer store, by kind of offer.",
+			ConstLabels: prometheus.Labels{"kind": kind.String()},
+		}, func() float64 {
+			return float64(offers.Count(kind))
+		}))
+	}
+}
+
+// WatchReputation exposes a histogram of the reputation of the clients, gateways and providers known to the gateway.
+func (m *Metrics) WatchReputation(rep *reputation.Reputation) {
+	m.registry.MustRegister(&reputationCollector{
+		rep: rep,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "reputation"),
+			"Reputation of the nodes known to the gateway, by kind of node.",
+			[]string{"kind"}, nil),
+	})
+}
+
+// reputationCollector builds the reputation histogram from the reputation held by the gateway when it is collected.
+type reputationCollector struct {
+	rep  *reputation.Reputation
+	desc *prometheus.Desc
+}
+
+// Describe implements prometheus.Collector.
+func (r *reputationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.desc
+}
+
+// Collect implements prometheus.Collector.
+func (r *reputationCollector) Collect(ch chan<- prometheus.Metric) {
+	state := r.rep.Capture()
+	r.collect(ch, "client", state.Clients)
+	r.collect(ch, "gateway", state.Gateways)
+	r.collect(ch, "provider", state.Providers)
+}
+
+func (r *reputationCollector) collect(ch chan<- prometheus.Metric, kind string, values map[string]int64) {
+	buckets := make(map[float64]uint64, len(reputationBuckets))
+	sum := 0.0
+	for _, value := range values {
+		sum += float64(value)
+		for _, bound := range reputationBuckets {
+			if float64(value) <= bound {
+				buckets[bound]++
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstHistogram(r.desc, uint64(len(values)), sum, buckets, kind)
+}
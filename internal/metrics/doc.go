@@ -0,0 +1,2 @@
+// Package metrics contains the Prometheus metrics of the gateway, and the endpoint exposing them.
+package metrics
@@ -0,0 +1,166 @@
+package metrics
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/messages"
+)
+
+// namespace prefixes the name of every metric of the gateway.
+const namespace = "fcr_gateway"
+
+// APIs a request can be received on.
+const (
+	APIREST = "rest"
+	APIP2P  = "p2p"
+)
+
+// Directions of a payment.
+const (
+	PaymentReceived = "received"
+	PaymentPaid     = "paid"
+	PaymentToppedUp = "topped_up"
+)
+
+// Metrics holds the metrics of a gateway, in a registry of its own.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	requestErrors   *prometheus.CounterVec
+	peerRequests    *prometheus.CounterVec
+	peerDuration    *prometheus.HistogramVec
+	payments        *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics of a gateway.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Number of requests handled, by API and message type.",
+		}, []string{"api", "type"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to handle a request, by API and message type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"api", "type"}),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_errors_total",
+			Help:      "Number of requests that got an error response or dropped the connection, by API, message type and error code.",
+		}, []string{"api", "type", "code"}),
+		peerRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dht_peer_requests_total",
+			Help:      "Number of requests sent to peer gateways during DHT discovery, by peer and result.",
+		}, []string{"peer", "result"}),
+		peerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "dht_peer_request_duration_seconds",
+			Help:      "Time taken by peer gateways to answer during DHT discovery, by peer.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"peer"}),
+		payments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_attofil_total",
+			Help:      "Amount received, paid and topped up through payment channels, in attoFIL.",
+		}, []string{"direction"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.requestErrors,
+		m.peerRequests,
+		m.peerDuration,
+		m.payments,
+	)
+	return m
+}
+
+// ObserveRequest records a request handled on an API, and the time taken to handle it.
+func (m *Metrics) ObserveRequest(api string, msgType int32, duration time.Duration) {
+	msgTypeLabel := strconv.Itoa(int(msgType))
+	m.requests.WithLabelValues(api, msgTypeLabel).Inc()
+	m.requestDuration.WithLabelValues(api, msgTypeLabel).Observe(duration.Seconds())
+}
+
+// ObserveError records a request that got an error response with the given code, or whose connection was dropped.
+func (m *Metrics) ObserveError(api string, msgType int32, code messages.ErrorCode) {
+	m.requestErrors.WithLabelValues(api, strconv.Itoa(int(msgType)), strings.ReplaceAll(code.String(), " ", "_")).Inc()
+}
+
+// ObservePeerRequest records a request sent to a peer gateway during DHT discovery, and the time it took to answer.
+func (m *Metrics) ObservePeerRequest(peer string, duration time.Duration, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	m.peerRequests.WithLabelValues(peer, result).Inc()
+	m.peerDuration.WithLabelValues(peer).Observe(duration.Seconds())
+}
+
+// ObservePayment records an amount received, paid or topped up.
+func (m *Metrics) ObservePayment(direction string, amount *big.Int) {
+	if amount == nil || amount.Sign() <= 0 {
+		return
+	}
+	value, _ := new(big.Float).SetInt(amount).Float64()
+	m.payments.WithLabelValues(direction).Add(value)
+}
+
+// Register adds a collector to the metrics of the gateway.
+func (m *Metrics) Register(collector prometheus.Collector) error {
+	return m.registry.Register(collector)
+}
+
+// Handler returns the HTTP handler exposing the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Start starts exposing the metrics on /metrics on the given port.
+func (m *Metrics) Start(bind string) error {
+	ln, err := net.Listen("tcp", ":"+bind)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	go func() {
+		logging.Error(http.Serve(ln, mux).Error())
+	}()
+	logging.Info("Metrics server starts listening on %s for connections.", bind)
+	return nil
+}
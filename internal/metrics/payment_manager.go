@@ -0,0 +1,60 @@
+package metrics
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+// paymentManager records the amounts going through a payment manager.
+type paymentManager struct {
+	payment.Manager
+	metrics *Metrics
+}
+
+// NewPaymentManager wraps a payment manager so that the amounts it receives, pays and tops up are recorded.
+func NewPaymentManager(mgr payment.Manager, m *Metrics) payment.Manager {
+	return &paymentManager{Manager: mgr, metrics: m}
+}
+
+// Topup implements payment.Manager.
+func (p *paymentManager) Topup(recipient string, amount *big.Int) error {
+	if err := p.Manager.Topup(recipient, amount); err != nil {
+		return err
+	}
+	p.metrics.ObservePayment(PaymentToppedUp, amount)
+	return nil
+}
+
+// Pay implements payment.Manager.
+func (p *paymentManager) Pay(recipient string, lane uint64, amount *big.Int) (string, string, bool, error) {
+	paychAddr, voucher, topup, err := p.Manager.Pay(recipient, lane, amount)
+	if err == nil && !topup {
+		p.metrics.ObservePayment(PaymentPaid, amount)
+	}
+	return paychAddr, voucher, topup, err
+}
+
+// Receive implements payment.Manager.
+func (p *paymentManager) Receive(channel string, voucher string) (*big.Int, error) {
+	amount, err := p.Manager.Receive(channel, voucher)
+	if err == nil {
+		p.metrics.ObservePayment(PaymentReceived, amount)
+	}
+	return amount, err
+}
@@ -0,0 +1,107 @@
+package offerstore
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+const recordFileExt = ".json"
+
+// FileStore is a store that keeps one file per offer in a directory, named after the offer digest.
+// Files are written atomically, so that a crash never leaves a partially written offer.
+type FileStore struct {
+	dir  string
+	lock sync.Mutex
+}
+
+// NewFileStore creates a file store in the given directory, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Put records an offer.
+func (s *FileStore) Put(kind Kind, offer *cidoffer.CIDOffer) error {
+	data, err := json.Marshal(Record{Kind: kind, Offer: offer})
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return util.WriteFileAtomic(s.path(offer.GetMessageDigest()), data)
+}
+
+// Remove removes the offer with the given digest.
+func (s *FileStore) Remove(digest [cidoffer.CIDOfferDigestSize]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := os.Remove(s.path(digest))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Load returns all the stored offers. Records that can not be decoded are logged and skipped.
+func (s *FileStore) Load() ([]Record, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), recordFileExt) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		record := Record{}
+		if err := json.Unmarshal(data, &record); err != nil || record.Offer == nil {
+			logging.Warn("Skipping unreadable offer record %s", file.Name())
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Close releases any resources held by the store.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// path returns the path of the file holding the offer with the given digest.
+func (s *FileStore) path(digest [cidoffer.CIDOfferDigestSize]byte) string {
+	return filepath.Join(s.dir, hex.EncodeToString(digest[:])+recordFileExt)
+}
@@ -0,0 +1,66 @@
+package offerstore
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"sync"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+)
+
+// MemoryStore is a store that keeps offers in memory only. It is intended for tests and for gateways that
+// do not need their offers to survive a restart.
+type MemoryStore struct {
+	records map[[cidoffer.CIDOfferDigestSize]byte]Record
+	lock    sync.RWMutex
+}
+
+// NewMemoryStore creates an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[[cidoffer.CIDOfferDigestSize]byte]Record)}
+}
+
+// Put records an offer.
+func (s *MemoryStore) Put(kind Kind, offer *cidoffer.CIDOffer) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.records[offer.GetMessageDigest()] = Record{Kind: kind, Offer: offer}
+	return nil
+}
+
+// Remove removes the offer with the given digest.
+func (s *MemoryStore) Remove(digest [cidoffer.CIDOfferDigestSize]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.records, digest)
+	return nil
+}
+
+// Load returns all the stored offers.
+func (s *MemoryStore) Load() ([]Record, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	records := make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Close releases any resources held by the store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,218 @@
+package offerstore
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcroffermgr"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+// SigningKeyLookup returns the signing key of a provider.
+type SigningKeyLookup func(providerID *nodeid.NodeID) (*fcrcrypto.KeyPair, error)
+
+// OfferMgr is an in-memory offer manager that also records every offer it accepts in a durable store.
+type OfferMgr struct {
+	*fcroffermgr.FCROfferMgr
+	store Store
+
+	// kinds holds the kind of every offer in the store
+	kinds     map[[cidoffer.CIDOfferDigestSize]byte]Kind
+	kindsLock sync.RWMutex
+
+	// pending holds the offers of the store not restored yet, as the signing key of their provider was not known
+	pending     map[[cidoffer.CIDOfferDigestSize]byte]Record
+	restoreLock sync.Mutex
+}
+
+// NewOfferMgr creates an offer manager backed by the given store. The manager starts empty, call Restore
+// to reload the offers held in the store.
+func NewOfferMgr(store Store) *OfferMgr {
+	return &OfferMgr{
+		FCROfferMgr: fcroffermgr.NewFCROfferMgr(),
+		store:       store,
+		kinds:       make(map[[cidoffer.CIDOfferDigestSize]byte]Kind),
+		pending:     make(map[[cidoffer.CIDOfferDigestSize]byte]Record),
+	}
+}
+
+// AddGroupOffer stores a group offer
+func (mgr *OfferMgr) AddGroupOffer(offer *cidoffer.CIDOffer) error {
+	if err := mgr.FCROfferMgr.AddGroupOffer(offer); err != nil {
+		return err
+	}
+	return mgr.put(GroupOffer, offer)
+}
+
+// AddDHTOffer stores a dht offer
+func (mgr *OfferMgr) AddDHTOffer(offer *cidoffer.CIDOffer) error {
+	if err := mgr.FCROfferMgr.AddDHTOffer(offer); err != nil {
+		return err
+	}
+	return mgr.put(DHTOffer, offer)
+}
+
+// Restore reloads the offers held in the store, verifying each one against its provider's signing key.
+// Offers that have expired or fail verification are removed from the store. Offers whose provider key can
+// not be obtained are kept in the store but not served, until RestorePending restores them.
+// It returns the number of offers restored and dropped.
+func (mgr *OfferMgr) Restore(lookup SigningKeyLookup) (int, int, error) {
+	records, err := mgr.store.Load()
+	if err != nil {
+		return 0, 0, err
+	}
+	mgr.restoreLock.Lock()
+	defer mgr.restoreLock.Unlock()
+	restored, dropped := 0, 0
+	for _, record := range records {
+		mgr.setKind(record.Offer.GetMessageDigest(), record.Kind)
+		r, d := mgr.restore(record, lookup)
+		restored += r
+		dropped += d
+	}
+	return restored, dropped, nil
+}
+
+// RestorePending restores the offers that Restore could not restore because the signing key of their provider
+// was not known, for instance as the register had not been read yet. It returns the number of offers restored and
+// dropped.
+func (mgr *OfferMgr) RestorePending(lookup SigningKeyLookup) (int, int) {
+	mgr.restoreLock.Lock()
+	defer mgr.restoreLock.Unlock()
+	restored, dropped := 0, 0
+	for digest, record := range mgr.pending {
+		delete(mgr.pending, digest)
+		r, d := mgr.restore(record, lookup)
+		restored += r
+		dropped += d
+	}
+	return restored, dropped
+}
+
+// Pending returns the number of offers of the store waiting for the signing key of their provider to be restored.
+func (mgr *OfferMgr) Pending() int {
+	mgr.restoreLock.Lock()
+	defer mgr.restoreLock.Unlock()
+	return len(mgr.pending)
+}
+
+// restore restores an offer of the store, and returns the number of offers restored and dropped. An offer whose
+// provider key can not be obtained is left pending. It must be called with the restore lock held.
+func (mgr *OfferMgr) restore(record Record, lookup SigningKeyLookup) (int, int) {
+	offer := record.Offer
+	digest := offer.GetMessageDigest()
+	if offer.HasExpired() {
+		logging.Debug("Dropping expired offer %s", hex.EncodeToString(digest[:]))
+		return 0, mgr.drop(digest)
+	}
+	pubKey, err := lookup(offer.GetProviderID())
+	if err != nil {
+		logging.Warn("Not restoring offer %s yet, no signing key for provider %s: %s", hex.EncodeToString(digest[:]), offer.GetProviderID().ToString(), err.Error())
+		mgr.pending[digest] = record
+		return 0, 0
+	}
+	if offer.Verify(pubKey) != nil {
+		logging.Warn("Dropping offer %s, it fails verification for provider %s", hex.EncodeToString(digest[:]), offer.GetProviderID().ToString())
+		return 0, mgr.drop(digest)
+	}
+	if record.Kind == GroupOffer {
+		err = mgr.FCROfferMgr.AddGroupOffer(offer)
+	} else {
+		err = mgr.FCROfferMgr.AddDHTOffer(offer)
+	}
+	if err != nil {
+		logging.Warn("Dropping offer %s: %s", hex.EncodeToString(digest[:]), err.Error())
+		return 0, mgr.drop(digest)
+	}
+	return 1, 0
+}
+
+// Prune removes expired offers from the store.
+func (mgr *OfferMgr) Prune() error {
+	records, err := mgr.store.Load()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.Offer.HasExpired() {
+			digest := record.Offer.GetMessageDigest()
+			if err := mgr.store.Remove(digest); err != nil {
+				return err
+			}
+			mgr.removeKind(digest)
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying store.
+func (mgr *OfferMgr) Close() error {
+	return mgr.store.Close()
+}
+
+// drop removes an offer from the store, and returns the number of offers removed.
+func (mgr *OfferMgr) drop(digest [cidoffer.CIDOfferDigestSize]byte) int {
+	if err := mgr.store.Remove(digest); err != nil {
+		logging.Error("Error removing offer %s from the store: %s", hex.EncodeToString(digest[:]), err.Error())
+		return 0
+	}
+	mgr.removeKind(digest)
+	return 1
+}
+
+// Count returns the number of offers of the given kind in the store.
+func (mgr *OfferMgr) Count(kind Kind) int {
+	mgr.kindsLock.RLock()
+	defer mgr.kindsLock.RUnlock()
+	count := 0
+	for _, k := range mgr.kinds {
+		if k == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// put records an offer in the store. An offer published again while pending is no longer pending, as it is
+// served already.
+func (mgr *OfferMgr) put(kind Kind, offer *cidoffer.CIDOffer) error {
+	if err := mgr.store.Put(kind, offer); err != nil {
+		return err
+	}
+	digest := offer.GetMessageDigest()
+	mgr.setKind(digest, kind)
+	mgr.restoreLock.Lock()
+	delete(mgr.pending, digest)
+	mgr.restoreLock.Unlock()
+	return nil
+}
+
+func (mgr *OfferMgr) setKind(digest [cidoffer.CIDOfferDigestSize]byte, kind Kind) {
+	mgr.kindsLock.Lock()
+	defer mgr.kindsLock.Unlock()
+	mgr.kinds[digest] = kind
+}
+
+func (mgr *OfferMgr) removeKind(digest [cidoffer.CIDOfferDigestSize]byte) {
+	mgr.kindsLock.Lock()
+	defer mgr.kindsLock.Unlock()
+	delete(mgr.kinds, digest)
+}
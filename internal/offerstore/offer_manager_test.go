@@ -0,0 +1,113 @@
+package offerstore
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrcrypto"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+func newSignedOffer(t *testing.T, key *fcrcrypto.KeyPair, providerID *nodeid.NodeID, cids []cid.ContentID, expiry int64) *cidoffer.CIDOffer {
+	offer, err := cidoffer.NewCIDOffer(providerID, cids, 10, expiry, 5)
+	assert.Empty(t, err)
+	assert.Empty(t, offer.Sign(key, fcrcrypto.InitialKeyVersion()))
+	return offer
+}
+
+func TestRestoreFromFileStore(t *testing.T) {
+	key, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	assert.Empty(t, err)
+	otherKey, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	assert.Empty(t, err)
+	providerID, _ := nodeid.NewNodeIDFromHexString("01")
+	cid1, _ := cid.NewContentIDFromHexString("0101")
+	cid2, _ := cid.NewContentIDFromHexString("0102")
+	expiry := time.Now().Add(time.Hour).Unix()
+
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	assert.Empty(t, err)
+	mgr := NewOfferMgr(store)
+
+	dhtOffer := newSignedOffer(t, key, providerID, []cid.ContentID{*cid1}, expiry)
+	groupOffer := newSignedOffer(t, key, providerID, []cid.ContentID{*cid1, *cid2}, expiry)
+	forgedOffer := newSignedOffer(t, otherKey, providerID, []cid.ContentID{*cid2}, expiry)
+	expiredOffer := newSignedOffer(t, key, providerID, []cid.ContentID{*cid2}, time.Now().Add(-time.Hour).Unix())
+	assert.Empty(t, mgr.AddDHTOffer(dhtOffer))
+	assert.Empty(t, mgr.AddGroupOffer(groupOffer))
+	assert.Empty(t, store.Put(DHTOffer, forgedOffer))
+	assert.Empty(t, store.Put(DHTOffer, expiredOffer))
+	assert.Empty(t, mgr.Close())
+
+	// Simulate a restart
+	store, err = NewFileStore(dir)
+	assert.Empty(t, err)
+	mgr = NewOfferMgr(store)
+	restored, dropped, err := mgr.Restore(func(id *nodeid.NodeID) (*fcrcrypto.KeyPair, error) {
+		return key, nil
+	})
+	assert.Empty(t, err)
+	assert.Equal(t, 2, restored)
+	assert.Equal(t, 2, dropped)
+
+	offers, exists := mgr.GetOffers(cid1)
+	assert.True(t, exists)
+	assert.Equal(t, 2, len(offers))
+	offers, exists = mgr.GetDHTOffers(cid2)
+	assert.False(t, exists)
+	records, err := store.Load()
+	assert.Empty(t, err)
+	assert.Equal(t, 2, len(records))
+}
+
+func TestRestoreKeepsOffersWithUnknownProvider(t *testing.T) {
+	key, err := fcrcrypto.GenerateRetrievalV1KeyPair()
+	assert.Empty(t, err)
+	providerID, _ := nodeid.NewNodeIDFromHexString("01")
+	cid1, _ := cid.NewContentIDFromHexString("0101")
+	store := NewMemoryStore()
+	assert.Empty(t, store.Put(DHTOffer, newSignedOffer(t, key, providerID, []cid.ContentID{*cid1}, time.Now().Add(time.Hour).Unix())))
+
+	mgr := NewOfferMgr(store)
+	restored, dropped, err := mgr.Restore(func(id *nodeid.NodeID) (*fcrcrypto.KeyPair, error) {
+		return nil, errors.New("provider not found")
+	})
+	assert.Empty(t, err)
+	assert.Equal(t, 0, restored)
+	assert.Equal(t, 0, dropped)
+	records, _ := store.Load()
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, 1, mgr.Pending())
+
+	// The offer is restored once the provider key is known.
+	restored, dropped = mgr.RestorePending(func(id *nodeid.NodeID) (*fcrcrypto.KeyPair, error) {
+		return key, nil
+	})
+	assert.Equal(t, 1, restored)
+	assert.Equal(t, 0, dropped)
+	assert.Equal(t, 0, mgr.Pending())
+	offers, exists := mgr.GetDHTOffers(cid1)
+	assert.True(t, exists)
+	assert.Equal(t, 1, len(offers))
+}
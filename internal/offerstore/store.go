@@ -0,0 +1,82 @@
+/*
+Package offerstore - durable storage for the offers accepted by a Gateway, so that they survive a restart.
+*/
+package offerstore
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cidoffer"
+)
+
+// Kind is the kind of an offer held in the store.
+type Kind int
+
+const (
+	// DHTOffer is an offer for a single CID
+	DHTOffer Kind = iota
+	// GroupOffer is an offer for a group of CIDs
+	GroupOffer
+)
+
+// String returns the name of the kind.
+func (kind Kind) String() string {
+	if kind == GroupOffer {
+		return "group"
+	}
+	return "dht"
+}
+
+// Store types that can be selected in the settings.
+const (
+	StoreTypeFile   = "file"
+	StoreTypeMemory = "memory"
+)
+
+// Record is an offer as held in the store.
+type Record struct {
+	Kind  Kind               `json:"kind"`
+	Offer *cidoffer.CIDOffer `json:"offer"`
+}
+
+// Store persists offers. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put records an offer. Putting an offer that is already stored is not an error.
+	Put(kind Kind, offer *cidoffer.CIDOffer) error
+
+	// Remove removes the offer with the given digest. Removing an offer that is not stored is not an error.
+	Remove(digest [cidoffer.CIDOfferDigestSize]byte) error
+
+	// Load returns all the stored offers.
+	Load() ([]Record, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// NewStore creates a store of the given type. File stores keep their data in dir.
+func NewStore(storeType string, dir string) (Store, error) {
+	switch storeType {
+	case StoreTypeFile:
+		return NewFileStore(dir)
+	case StoreTypeMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown offer store type: %s", storeType)
+	}
+}
@@ -0,0 +1,84 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Denominations of FIL accepted in amounts, in attoFIL.
+var denominations = map[string]*big.Int{
+	"fil":      new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil),
+	"millifil": new(big.Int).Exp(big.NewInt(10), big.NewInt(15), nil),
+	"microfil": new(big.Int).Exp(big.NewInt(10), big.NewInt(12), nil),
+	"nanofil":  new(big.Int).Exp(big.NewInt(10), big.NewInt(9), nil),
+	"picofil":  new(big.Int).Exp(big.NewInt(10), big.NewInt(6), nil),
+	"femtofil": new(big.Int).Exp(big.NewInt(10), big.NewInt(3), nil),
+	"attofil":  big.NewInt(1),
+}
+
+// amountPattern matches an amount: a decimal number, whose digits can be grouped with underscores, followed by an
+// optional denomination.
+var amountPattern = regexp.MustCompile(`^(-?[0-9][0-9_]*(?:\.[0-9_]+)?)\s*([a-zA-Z]*)$`)
+
+// ParseAmount parses an amount of FIL, such as "0.001 FIL", "1 nanoFIL" or "1000000 attoFIL", and returns it in
+// attoFIL. Denominations are case insensitive, and amounts without a denomination are in attoFIL. The amount must be
+// a whole number of attoFIL.
+func ParseAmount(s string) (*big.Int, error) {
+	match := amountPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return nil, fmt.Errorf("%q is not an amount of FIL", s)
+	}
+	unit := big.NewInt(1)
+	if match[2] != "" {
+		var ok bool
+		unit, ok = denominations[strings.ToLower(match[2])]
+		if !ok {
+			return nil, fmt.Errorf("%q is not a denomination of FIL", match[2])
+		}
+	}
+	number, ok := new(big.Rat).SetString(strings.ReplaceAll(match[1], "_", ""))
+	if !ok {
+		return nil, fmt.Errorf("%q is not an amount of FIL", s)
+	}
+	number.Mul(number, new(big.Rat).SetInt(unit))
+	if !number.IsInt() {
+		return nil, fmt.Errorf("%q is not a whole number of attoFIL", s)
+	}
+	return new(big.Int).Set(number.Num()), nil
+}
+
+// FormatFIL formats an amount of attoFIL in FIL, such as "0.001 FIL".
+func FormatFIL(amount *big.Int) string {
+	whole, frac := new(big.Int).QuoRem(new(big.Int).Abs(amount), denominations["fil"], new(big.Int))
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	if frac.Sign() == 0 {
+		return fmt.Sprintf("%s%s FIL", sign, whole)
+	}
+	decimals := strings.TrimRight(fmt.Sprintf("%018s", frac), "0")
+	return fmt.Sprintf("%s%s.%s FIL", sign, whole, decimals)
+}
+
+// DescribeAmount formats an amount of attoFIL in both attoFIL and FIL, such as "1000000000000000 attoFIL (0.001 FIL)".
+func DescribeAmount(amount *big.Int) string {
+	return fmt.Sprintf("%s attoFIL (%s)", amount, FormatFIL(amount))
+}
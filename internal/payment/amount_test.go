@@ -0,0 +1,55 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAmount(t *testing.T) {
+	for s, expected := range map[string]string{
+		"0.001 FIL":             "1000000000000000",
+		"0.001FIL":              "1000000000000000",
+		"1 nanoFIL":             "1000000000",
+		"2.5 milliFIL":          "2500000000000000",
+		"1000000 attoFIL":       "1000000",
+		"1_000_000_000_000_000": "1000000000000000",
+		"100_000_000 microfil":  "100000000000000000000",
+		"0":                     "0",
+		"-1 FIL":                "-1000000000000000000",
+	} {
+		amount, err := ParseAmount(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, amount.String(), s)
+	}
+
+	for _, s := range []string{"", "FIL", "0.5 attoFIL", "1e3 FIL", "1/2 FIL", "1 kFIL", "0x10", "1 FIL extra"} {
+		_, err := ParseAmount(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestFormatFIL(t *testing.T) {
+	assert.Equal(t, "0.001 FIL", FormatFIL(big.NewInt(1_000_000_000_000_000)))
+	assert.Equal(t, "1 FIL", FormatFIL(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)))
+	assert.Equal(t, "0.000000000000000001 FIL", FormatFIL(big.NewInt(1)))
+	assert.Equal(t, "-0.1 FIL", FormatFIL(big.NewInt(-100_000_000_000_000_000)))
+	assert.Equal(t, "1000000000000000 attoFIL (0.001 FIL)", DescribeAmount(big.NewInt(1_000_000_000_000_000)))
+}
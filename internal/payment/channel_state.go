@@ -0,0 +1,235 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// BalanceLookup looks up the balance of a payment channel.
+type BalanceLookup func(paychAddr string) (*big.Int, error)
+
+// channelState is the state of an outbound payment channel.
+type channelState struct {
+	addr    string   // Address of the payment channel, empty until the first payment through it
+	balance *big.Int // Amount locked in the payment channel
+	spent   *big.Int // Amount of the vouchers issued on the payment channel, none is collected while it is open
+	pending *big.Int // Amount topped up since the last payment, not yet known to be in the payment channel
+}
+
+// available returns the amount that can still be paid through the payment channel: its balance minus the
+// vouchers issued on it.
+func (s *channelState) available() *big.Int {
+	return new(big.Int).Sub(s.balance, s.spent)
+}
+
+// ChannelStates keeps the state of the outbound payment channels of the gateway, keyed by recipient address. The
+// payment manager does not expose the state of its payment channels, so the state is recorded from the outcome of
+// every top up and payment made with the payment manager, through the manager returned by Track, and the balance of
+// the payment channels is refreshed in the background. Lookups only read the cached state, so that they can be made
+// while handling requests.
+type ChannelStates struct {
+	lock   sync.RWMutex
+	states map[string]*channelState
+
+	stopRefresh chan bool
+	refreshDone chan bool
+}
+
+// NewChannelStates creates an empty payment channel state cache.
+func NewChannelStates() *ChannelStates {
+	return &ChannelStates{states: make(map[string]*channelState)}
+}
+
+// IsFunded returns true if the payment channel to a recipient has more than threshold available to pay the
+// recipient. A payment channel with threshold or less available needs a top up.
+func (s *ChannelStates) IsFunded(recipient string, threshold *big.Int) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	state, ok := s.states[recipient]
+	if !ok {
+		return false
+	}
+	available := state.available()
+	return available.Sign() > 0 && available.Cmp(threshold) > 0
+}
+
+// RecordTopup records that the payment channel to a recipient has been topped up by amount.
+func (s *ChannelStates) RecordTopup(recipient string, amount *big.Int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state := s.get(recipient)
+	state.balance.Add(state.balance, amount)
+	state.pending.Add(state.pending, amount)
+}
+
+// RecordPayment records that amount has been paid to a recipient through the payment channel paychAddr. A payment
+// through a new payment channel starts its state over, from the top ups made since the last payment.
+func (s *ChannelStates) RecordPayment(recipient string, paychAddr string, amount *big.Int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state := s.get(recipient)
+	if state.addr != paychAddr {
+		state.addr = paychAddr
+		state.balance.Set(state.pending)
+		state.spent.SetInt64(0)
+	}
+	state.pending.SetInt64(0)
+	state.spent.Add(state.spent, amount)
+}
+
+// RecordUnfunded records that the payment channel to a recipient does not have enough funds for a payment.
+func (s *ChannelStates) RecordUnfunded(recipient string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state := s.get(recipient)
+	state.balance.Set(state.spent)
+}
+
+// Refresh looks up the balance of every payment channel whose address is known, the amount available in a payment
+// channel being its balance minus the vouchers issued on it. Payment channels whose balance can not be looked up
+// keep their cached state.
+func (s *ChannelStates) Refresh(lookup BalanceLookup) {
+	s.lock.RLock()
+	addrs := make(map[string]string)
+	for recipient, state := range s.states {
+		if state.addr != "" {
+			addrs[recipient] = state.addr
+		}
+	}
+	s.lock.RUnlock()
+
+	// Look up the balances without holding the lock, lookups go to the chain.
+	for recipient, addr := range addrs {
+		balance, err := lookup(addr)
+		if err != nil {
+			logging.Warn("Error looking up balance of payment channel %s: %s", addr, err.Error())
+			continue
+		}
+		s.lock.Lock()
+		if state, ok := s.states[recipient]; ok && state.addr == addr {
+			state.balance.Set(balance)
+		}
+		s.lock.Unlock()
+	}
+}
+
+// StartRefresh starts a routine that periodically refreshes the payment channel states with lookup. A routine that
+// has already been started is stopped first.
+func (s *ChannelStates) StartRefresh(interval time.Duration, lookup BalanceLookup) {
+	s.StopRefresh()
+	s.stopRefresh = make(chan bool)
+	s.refreshDone = make(chan bool)
+	go func(stop chan bool, done chan bool) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Refresh(lookup)
+			case <-stop:
+				return
+			}
+		}
+	}(s.stopRefresh, s.refreshDone)
+}
+
+// StopRefresh stops the refresh routine, if it has been started.
+func (s *ChannelStates) StopRefresh() {
+	if s.stopRefresh == nil {
+		return
+	}
+	close(s.stopRefresh)
+	<-s.refreshDone
+	s.stopRefresh = nil
+}
+
+// get returns the state of the payment channel to a recipient, creating it if needed. The lock must be held.
+func (s *ChannelStates) get(recipient string) *channelState {
+	state, ok := s.states[recipient]
+	if !ok {
+		state = &channelState{balance: big.NewInt(0), spent: big.NewInt(0), pending: big.NewInt(0)}
+		s.states[recipient] = state
+	}
+	return state
+}
+
+// trackedManager records the top ups and payments of a payment manager in the payment channel states.
+type trackedManager struct {
+	Manager
+	states *ChannelStates
+}
+
+// Track wraps a payment manager so that the state of the payment channels to every recipient it tops up or pays,
+// gateways and providers alike, is recorded.
+func (s *ChannelStates) Track(mgr Manager) Manager {
+	return &trackedManager{Manager: mgr, states: s}
+}
+
+// Topup implements Manager.
+func (m *trackedManager) Topup(recipient string, amount *big.Int) error {
+	if err := m.Manager.Topup(recipient, amount); err != nil {
+		return err
+	}
+	m.states.RecordTopup(recipient, amount)
+	return nil
+}
+
+// Pay implements Manager.
+func (m *trackedManager) Pay(recipient string, lane uint64, amount *big.Int) (string, string, bool, error) {
+	paychAddr, voucher, topup, err := m.Manager.Pay(recipient, lane, amount)
+	if err == nil {
+		if topup {
+			m.states.RecordUnfunded(recipient)
+		} else {
+			m.states.RecordPayment(recipient, paychAddr, amount)
+		}
+	}
+	return paychAddr, voucher, topup, err
+}
+
+// NewLotusBalanceLookup creates a balance lookup that reads the balance of payment channel actors from a lotus node.
+func NewLotusBalanceLookup(lotusAPIAddr string, authToken string) BalanceLookup {
+	return func(paychAddr string) (*big.Int, error) {
+		addr, err := address.NewFromString(paychAddr)
+		if err != nil {
+			return nil, err
+		}
+		var api apistruct.FullNodeStruct
+		headers := http.Header{"Authorization": []string{"Bearer " + authToken}}
+		closer, err := jsonrpc.NewMergeClient(context.Background(), lotusAPIAddr, "Filecoin", []interface{}{&api.Internal, &api.CommonStruct.Internal}, headers)
+		if err != nil {
+			return nil, err
+		}
+		defer closer()
+		actor, err := api.StateGetActor(context.Background(), addr, types.EmptyTSK)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).Set(actor.Balance.Int), nil
+	}
+}
@@ -0,0 +1,102 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelStatesFunded(t *testing.T) {
+	s := NewChannelStates()
+	zero := big.NewInt(0)
+	assert.False(t, s.IsFunded("recipient", zero))
+
+	s.RecordTopup("recipient", big.NewInt(10))
+	assert.True(t, s.IsFunded("recipient", zero))
+
+	s.RecordPayment("recipient", "paych", big.NewInt(4))
+	assert.True(t, s.IsFunded("recipient", zero))
+	assert.True(t, s.IsFunded("recipient", big.NewInt(5)))
+	assert.False(t, s.IsFunded("recipient", big.NewInt(6)))
+	s.RecordPayment("recipient", "paych", big.NewInt(6))
+	assert.False(t, s.IsFunded("recipient", zero))
+
+	s.RecordTopup("recipient", big.NewInt(10))
+	assert.True(t, s.IsFunded("recipient", zero))
+	s.RecordUnfunded("recipient")
+	assert.False(t, s.IsFunded("recipient", zero))
+}
+
+func TestChannelStatesNewChannel(t *testing.T) {
+	s := NewChannelStates()
+	zero := big.NewInt(0)
+	s.RecordTopup("recipient", big.NewInt(10))
+	s.RecordPayment("recipient", "paych", big.NewInt(10))
+	assert.False(t, s.IsFunded("recipient", zero))
+
+	// The vouchers issued on the previous payment channel are not paid out of the new one.
+	s.RecordTopup("recipient", big.NewInt(10))
+	s.RecordPayment("recipient", "paych-new", big.NewInt(4))
+	assert.True(t, s.IsFunded("recipient", big.NewInt(5)))
+	assert.False(t, s.IsFunded("recipient", big.NewInt(6)))
+}
+
+func TestChannelStatesRefresh(t *testing.T) {
+	s := NewChannelStates()
+	zero := big.NewInt(0)
+	s.RecordTopup("recipient", big.NewInt(10))
+	s.RecordPayment("recipient", "paych", big.NewInt(5))
+	s.RecordTopup("no payment yet", big.NewInt(10))
+
+	looked := make([]string, 0)
+	s.Refresh(func(paychAddr string) (*big.Int, error) {
+		looked = append(looked, paychAddr)
+		return big.NewInt(5), nil
+	})
+	// Only payment channels whose address is known are looked up, and their vouchers are taken from the balance.
+	assert.Equal(t, []string{"paych"}, looked)
+	assert.False(t, s.IsFunded("recipient", zero))
+	assert.True(t, s.IsFunded("no payment yet", zero))
+
+	// Failed lookups keep the cached state.
+	s.RecordTopup("recipient", big.NewInt(10))
+	s.Refresh(func(paychAddr string) (*big.Int, error) {
+		return nil, errors.New("lotus unavailable")
+	})
+	assert.True(t, s.IsFunded("recipient", zero))
+}
+
+func TestChannelStatesTrack(t *testing.T) {
+	s := NewChannelStates()
+	zero := big.NewInt(0)
+	mgr := s.Track(NewMemoryManager("wallet", NewMemoryLedger()))
+	_, _, topup, err := mgr.Pay("provider", 0, big.NewInt(4))
+	require.NoError(t, err)
+	assert.True(t, topup)
+	assert.False(t, s.IsFunded("provider", zero))
+
+	require.NoError(t, mgr.Topup("provider", big.NewInt(10)))
+	_, _, topup, err = mgr.Pay("provider", 0, big.NewInt(4))
+	require.NoError(t, err)
+	assert.False(t, topup)
+	assert.True(t, s.IsFunded("provider", big.NewInt(5)))
+	assert.False(t, s.IsFunded("provider", big.NewInt(6)))
+}
@@ -0,0 +1,68 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrpaymentmgr"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+)
+
+// Payment manager types that can be selected in the settings.
+const (
+	ManagerTypeLotus  = "lotus"
+	ManagerTypeMemory = "memory"
+)
+
+// Manager makes and receives the payments of the gateway through payment channels.
+type Manager interface {
+	// Topup tops up the payment channel to a recipient by amount, creating the payment channel if needed.
+	Topup(recipient string, amount *big.Int) error
+
+	// Pay creates a voucher paying amount to a recipient on a lane of the payment channel to the recipient. It
+	// returns the payment channel address and the voucher, or true if the payment channel needs a top up first.
+	Pay(recipient string, lane uint64, amount *big.Int) (string, string, bool, error)
+
+	// Receive receives a voucher on a payment channel and returns the amount it pays.
+	Receive(channel string, voucher string) (*big.Int, error)
+
+	// Shutdown releases the resources held by the payment manager.
+	Shutdown()
+}
+
+// The payment manager of the common library pays through payment channels on a lotus node.
+var _ Manager = (*fcrpaymentmgr.FCRPaymentMgr)(nil)
+
+// NewManager creates a payment manager of the given type, paying from the given wallet, together with the lookup of
+// the balance of its payment channels. Lotus payment managers use the lotus node at lotusAPIAddr.
+func NewManager(managerType string, walletPrivKey string, lotusAPIAddr string, authToken string) (Manager, BalanceLookup, error) {
+	switch managerType {
+	case ManagerTypeLotus:
+		mgr, err := fcrpaymentmgr.NewFCRPaymentMgr(walletPrivKey, lotusAPIAddr, authToken)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mgr, NewLotusBalanceLookup(lotusAPIAddr, authToken), nil
+	case ManagerTypeMemory:
+		logging.Warn("Using the memory payment manager (PAYMENT_MANAGER=memory): payments are not settled on chain, it must only be used in development and tests")
+		mgr := NewMemoryManager(walletPrivKey, defaultMemoryLedger)
+		return mgr, mgr.Balance, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown payment manager type: %s", managerType)
+	}
+}
@@ -0,0 +1,222 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// memoryVoucherPrefix starts every voucher created by a memory manager.
+const memoryVoucherPrefix = "memory"
+
+// MemoryManager is a payment manager that keeps its payment channels in memory only, without a lotus node. It is
+// intended for development and tests. Payment channel addresses are derived from the wallet and the recipient,
+// vouchers spell out the amount they pay, and payment channels are funded by top ups only, so that payments are
+// deterministic. Payment channels are opened in a ledger shared by the memory managers paying each other: vouchers
+// are only received on payment channels opened in the ledger, and for no more than their balance.
+type MemoryManager struct {
+	wallet string
+	ledger *MemoryLedger
+
+	// channels are the payment channels to recipients, by recipient
+	channels map[string]*memoryChannel
+	// received are the last voucher nonces received, by payment channel address and lane
+	received map[string]uint64
+	// redeemed are the amounts received, by payment channel address
+	redeemed map[string]*big.Int
+	lock     sync.Mutex
+}
+
+// MemoryLedger holds the balances of the payment channels opened by memory managers, by payment channel address.
+type MemoryLedger struct {
+	balances map[string]*big.Int
+	lock     sync.Mutex
+}
+
+// defaultMemoryLedger is the ledger of the memory managers created by NewManager.
+var defaultMemoryLedger = NewMemoryLedger()
+
+// memoryChannel is an outgoing payment channel of a memory manager.
+type memoryChannel struct {
+	address string
+	spent   *big.Int
+	// nonces are the last voucher nonces created, by lane
+	nonces map[uint64]uint64
+}
+
+// NewMemoryLedger creates an empty ledger of memory payment channels.
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{balances: make(map[string]*big.Int)}
+}
+
+// topup adds amount to the balance of a payment channel, opening it if needed.
+func (l *MemoryLedger) topup(paychAddr string, amount *big.Int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	balance, ok := l.balances[paychAddr]
+	if !ok {
+		balance = big.NewInt(0)
+		l.balances[paychAddr] = balance
+	}
+	balance.Add(balance, amount)
+}
+
+// balance returns the balance of a payment channel, or false if the payment channel has never been opened.
+func (l *MemoryLedger) balance(paychAddr string) (*big.Int, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	balance, ok := l.balances[paychAddr]
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).Set(balance), true
+}
+
+// NewMemoryManager creates a memory manager paying from the given wallet, with its payment channels in ledger.
+func NewMemoryManager(wallet string, ledger *MemoryLedger) *MemoryManager {
+	return &MemoryManager{
+		wallet:   wallet,
+		ledger:   ledger,
+		channels: make(map[string]*memoryChannel),
+		received: make(map[string]uint64),
+		redeemed: make(map[string]*big.Int),
+	}
+}
+
+// Topup tops up the payment channel to a recipient by amount, creating the payment channel if needed.
+func (m *MemoryManager) Topup(recipient string, amount *big.Int) error {
+	if amount.Sign() <= 0 {
+		return errors.New("top up amount must be positive")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	channel := m.channel(recipient)
+	m.ledger.topup(channel.address, amount)
+	return nil
+}
+
+// Pay creates a voucher paying amount to a recipient, or returns true if the payment channel to the recipient does
+// not exist or has not enough funds left.
+func (m *MemoryManager) Pay(recipient string, lane uint64, amount *big.Int) (string, string, bool, error) {
+	if amount.Sign() < 0 {
+		return "", "", false, errors.New("payment amount must not be negative")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	channel, ok := m.channels[recipient]
+	if !ok {
+		return "", "", true, nil
+	}
+	spent := new(big.Int).Add(channel.spent, amount)
+	if balance, _ := m.ledger.balance(channel.address); spent.Cmp(balance) > 0 {
+		return "", "", true, nil
+	}
+	channel.spent = spent
+	channel.nonces[lane]++
+	voucher := fmt.Sprintf("%s:%d:%d:%s", memoryVoucherPrefix, lane, channel.nonces[lane], amount.String())
+	return channel.address, voucher, false, nil
+}
+
+// Receive receives a voucher on a payment channel and returns the amount it pays. A voucher can only be received
+// once, and vouchers on a lane must be received in the order they were created. Vouchers are rejected if the
+// payment channel has never been opened in the ledger, or if they pay more than is left of its balance.
+func (m *MemoryManager) Receive(channel string, voucher string) (*big.Int, error) {
+	if channel == "" {
+		return nil, errors.New("missing payment channel")
+	}
+	lane, nonce, amount, err := decodeMemoryVoucher(voucher)
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := m.ledger.balance(channel)
+	if !ok {
+		return nil, fmt.Errorf("unknown payment channel: %s", channel)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := channel + "/" + strconv.FormatUint(lane, 10)
+	if nonce <= m.received[key] {
+		return nil, fmt.Errorf("voucher nonce %d already received on lane %d of %s", nonce, lane, channel)
+	}
+	redeemed, ok := m.redeemed[channel]
+	if !ok {
+		redeemed = big.NewInt(0)
+	}
+	redeemed = new(big.Int).Add(redeemed, amount)
+	if redeemed.Cmp(balance) > 0 {
+		return nil, fmt.Errorf("voucher exceeds the balance of payment channel %s", channel)
+	}
+	m.received[key] = nonce
+	m.redeemed[channel] = redeemed
+	return amount, nil
+}
+
+// Balance returns the amount a payment channel has been topped up by. It is the balance lookup of the payment
+// channels of the memory manager.
+func (m *MemoryManager) Balance(paychAddr string) (*big.Int, error) {
+	balance, ok := m.ledger.balance(paychAddr)
+	if !ok {
+		return nil, fmt.Errorf("unknown payment channel: %s", paychAddr)
+	}
+	return balance, nil
+}
+
+// Shutdown does nothing, a memory manager holds no resources.
+func (m *MemoryManager) Shutdown() {
+}
+
+// channel returns the payment channel to a recipient, creating it if needed. The caller must hold the lock.
+func (m *MemoryManager) channel(recipient string) *memoryChannel {
+	channel, ok := m.channels[recipient]
+	if !ok {
+		hash := sha256.Sum256([]byte(m.wallet + "/" + recipient))
+		channel = &memoryChannel{
+			address: memoryVoucherPrefix + "-" + hex.EncodeToString(hash[:10]),
+			spent:   big.NewInt(0),
+			nonces:  make(map[uint64]uint64),
+		}
+		m.channels[recipient] = channel
+	}
+	return channel
+}
+
+// decodeMemoryVoucher decodes the lane, the nonce and the amount of a voucher created by a memory manager.
+func decodeMemoryVoucher(voucher string) (uint64, uint64, *big.Int, error) {
+	parts := strings.Split(voucher, ":")
+	if len(parts) != 4 || parts[0] != memoryVoucherPrefix {
+		return 0, 0, nil, errors.New("invalid voucher")
+	}
+	lane, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, nil, errors.New("invalid voucher lane")
+	}
+	nonce, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil || nonce == 0 {
+		return 0, 0, nil, errors.New("invalid voucher nonce")
+	}
+	amount, ok := new(big.Int).SetString(parts[3], 10)
+	if !ok || amount.Sign() < 0 {
+		return 0, 0, nil, errors.New("invalid voucher amount")
+	}
+	return lane, nonce, amount, nil
+}
@@ -0,0 +1,104 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryManagerPayAndReceive(t *testing.T) {
+	ledger := NewMemoryLedger()
+	payer := NewMemoryManager("wallet", ledger)
+	payee := NewMemoryManager("other wallet", ledger)
+
+	// Payment channels must be topped up before paying.
+	_, _, topup, err := payer.Pay("recipient", 0, big.NewInt(5))
+	require.NoError(t, err)
+	assert.True(t, topup)
+
+	require.NoError(t, payer.Topup("recipient", big.NewInt(10)))
+	paychAddr, voucher, topup, err := payer.Pay("recipient", 0, big.NewInt(6))
+	require.NoError(t, err)
+	assert.False(t, topup)
+	assert.Equal(t, "memory:0:1:6", voucher)
+
+	amount, err := payee.Receive(paychAddr, voucher)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(6), amount)
+	_, err = payee.Receive(paychAddr, voucher)
+	assert.Error(t, err)
+
+	// The balance left is not enough for another payment of the same amount.
+	_, _, topup, err = payer.Pay("recipient", 0, big.NewInt(6))
+	require.NoError(t, err)
+	assert.True(t, topup)
+
+	balance, err := payer.Balance(paychAddr)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(10), balance)
+}
+
+func TestMemoryManagerDeterministic(t *testing.T) {
+	m1 := NewMemoryManager("wallet", NewMemoryLedger())
+	m2 := NewMemoryManager("wallet", NewMemoryLedger())
+	require.NoError(t, m1.Topup("recipient", big.NewInt(10)))
+	require.NoError(t, m2.Topup("recipient", big.NewInt(10)))
+	paychAddr1, voucher1, _, err := m1.Pay("recipient", 0, big.NewInt(1))
+	require.NoError(t, err)
+	paychAddr2, voucher2, _, err := m2.Pay("recipient", 0, big.NewInt(1))
+	require.NoError(t, err)
+	assert.Equal(t, paychAddr1, paychAddr2)
+	assert.Equal(t, voucher1, voucher2)
+
+	_, err = m1.Receive(paychAddr1, "not a voucher")
+	assert.Error(t, err)
+}
+
+func TestMemoryManagerReceiveBoundToLedger(t *testing.T) {
+	ledger := NewMemoryLedger()
+	payer := NewMemoryManager("wallet", ledger)
+	payee := NewMemoryManager("other wallet", ledger)
+
+	// Vouchers written by hand are rejected on payment channels that were never opened.
+	_, err := payee.Receive("memory-channel", "memory:0:1:100")
+	assert.Error(t, err)
+
+	// And can not pay more than the balance of an opened payment channel.
+	require.NoError(t, payer.Topup("recipient", big.NewInt(10)))
+	paychAddr, voucher, _, err := payer.Pay("recipient", 0, big.NewInt(6))
+	require.NoError(t, err)
+	_, err = payee.Receive(paychAddr, voucher)
+	require.NoError(t, err)
+	_, err = payee.Receive(paychAddr, "memory:1:1:5")
+	assert.Error(t, err)
+	amount, err := payee.Receive(paychAddr, "memory:1:1:4")
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(4), amount)
+}
+
+func TestNewManager(t *testing.T) {
+	mgr, lookup, err := NewManager(ManagerTypeMemory, "wallet", "", "")
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryManager{}, mgr)
+	assert.NotNil(t, lookup)
+
+	_, _, err = NewManager("unknown", "wallet", "", "")
+	assert.Error(t, err)
+}
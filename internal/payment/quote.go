@@ -0,0 +1,73 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+// quoteFields are the fields added to the body of a response requiring payment, giving the price of the request and
+// the amount still owed under the payment request, in attoFIL.
+type quoteFields struct {
+	Quote string `json:"payment_quote"`
+	Owed  string `json:"payment_owed"`
+}
+
+// AddQuote returns a copy of a response requiring payment, with the price of the request and the amount owed under
+// its payment request added to the body. The response must be signed after the quote has been added.
+func AddQuote(response *fcrmessages.FCRMessage, quote *big.Int, request *Request) (*fcrmessages.FCRMessage, error) {
+	return addFields(response, quoteFields{Quote: quote.String(), Owed: request.Owed.String()})
+}
+
+// addFields returns a copy of a message, with the JSON encoded fields added to its body.
+func addFields(msg *fcrmessages.FCRMessage, fields interface{}) (*fcrmessages.FCRMessage, error) {
+	body := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(msg.GetMessageBody(), &body); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(encoded, &body); err != nil {
+		return nil, err
+	}
+	added, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return fcrmessages.CreateFCRMessage(msg.GetMessageType(), added), nil
+}
+
+// QuoteFromBody returns the price of the request and the amount owed given by the body of a response requiring
+// payment, or nil if the response has no quote.
+func QuoteFromBody(body []byte) (*big.Int, *big.Int) {
+	fields := quoteFields{}
+	// Errors are ignored on purpose: the quote is optional and the body is decoded by the caller.
+	_ = json.Unmarshal(body, &fields)
+	quote, ok := new(big.Int).SetString(fields.Quote, 10)
+	if !ok {
+		return nil, nil
+	}
+	owed, ok := new(big.Int).SetString(fields.Owed, 10)
+	if !ok {
+		return nil, nil
+	}
+	return quote, owed
+}
@@ -0,0 +1,48 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+)
+
+func TestAddQuote(t *testing.T) {
+	pieceCID := cid.NewRandomContentID()
+	response, err := fcrmessages.EncodeClientStandardDiscoverResponseV2(pieceCID, 1, false, nil, nil, true, 42)
+	require.NoError(t, err)
+	quote, owed := QuoteFromBody(response.GetMessageBody())
+	assert.Nil(t, quote)
+	assert.Nil(t, owed)
+
+	quoted, err := AddQuote(response, big.NewInt(3000), &Request{ID: 42, Owed: big.NewInt(1000)})
+	require.NoError(t, err)
+	quote, owed = QuoteFromBody(quoted.GetMessageBody())
+	assert.Equal(t, int64(3000), quote.Int64())
+	assert.Equal(t, int64(1000), owed.Int64())
+
+	// The fields of the response are kept.
+	_, _, _, _, _, paymentRequired, paymentRequestID, err := fcrmessages.DecodeClientStandardDiscoverResponseV2(quoted)
+	require.NoError(t, err)
+	assert.True(t, paymentRequired)
+	assert.Equal(t, int64(42), paymentRequestID)
+}
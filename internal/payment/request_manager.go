@@ -0,0 +1,278 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+// Request is a payment request, issued to a payer that has not paid enough for a request on a cid. The payer
+// completes it by sending a follow-up request for the same cid that references the payment request ID and pays
+// the amount owed.
+type Request struct {
+	ID     int64     `json:"id"`
+	Payer  string    `json:"payer"` // Payment channel address of the payer
+	CID    string    `json:"cid"`
+	Owed   *big.Int  `json:"owed"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// ErrTooManyRequests is returned when a payment request can not be issued, as the maximum number of outstanding
+// payment requests has been reached.
+var ErrTooManyRequests = errors.New("too many outstanding payment requests")
+
+// RequestMgr charges payers for requests. It issues payment requests to payers that have not paid enough and
+// remembers them until they expire, and it keeps the credit of payers that have paid more than they were charged.
+type RequestMgr struct {
+	lock       sync.Mutex
+	requests   map[int64]*Request
+	credits    map[string]*big.Int
+	ttl        time.Duration
+	limit      int
+	payerLimit int
+}
+
+// requestState is the persisted state of a payment request manager.
+type requestState struct {
+	Requests []*Request          `json:"requests"`
+	Credits  map[string]*big.Int `json:"credits"`
+}
+
+// requestIDField is the field of a request body that references a payment request.
+type requestIDField struct {
+	PaymentRequestID int64 `json:"payment_request_id"`
+}
+
+// NewRequestMgr creates a payment request manager, whose payment requests expire after ttl. At most limit payment
+// requests are outstanding, and at most payerLimit for a payer.
+func NewRequestMgr(ttl time.Duration, limit int, payerLimit int) *RequestMgr {
+	return &RequestMgr{
+		requests:   make(map[int64]*Request),
+		credits:    make(map[string]*big.Int),
+		ttl:        ttl,
+		limit:      limit,
+		payerLimit: payerLimit,
+	}
+}
+
+// Load restores the payment requests and credits flushed to the file at path. Expired payment requests are
+// dropped. It does nothing if the file does not exist.
+func (m *RequestMgr) Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	state := requestState{}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, request := range state.Requests {
+		if request.ID != 0 && request.Owed != nil {
+			m.requests[request.ID] = request
+		}
+	}
+	for payer, credit := range state.Credits {
+		if credit != nil {
+			m.credit(payer, credit)
+		}
+	}
+	m.prune(util.GetTimeImpl().Now())
+	return nil
+}
+
+// Flush writes the unexpired payment requests and the credits to the file at path, so that they can be loaded
+// after a restart.
+func (m *RequestMgr) Flush(path string) error {
+	m.lock.Lock()
+	m.prune(util.GetTimeImpl().Now())
+	state := requestState{Requests: make([]*Request, 0, len(m.requests)), Credits: m.credits}
+	for _, request := range m.requests {
+		state.Requests = append(state.Requests, request)
+	}
+	data, err := json.Marshal(state)
+	m.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, data)
+}
+
+// RequestIDFromBody returns the payment request ID referenced by a request body, or 0 if there is none.
+func RequestIDFromBody(body []byte) int64 {
+	field := requestIDField{}
+	// Errors are ignored on purpose: the reference is optional and the body is decoded by the handler.
+	_ = json.Unmarshal(body, &field)
+	return field.PaymentRequestID
+}
+
+// AddRequestID returns a copy of a client request, with a reference to the payment request it completes added to the
+// body. The client requests of fcrmessages have no field for it, so clients add it before sending the request.
+func AddRequestID(request *fcrmessages.FCRMessage, requestID int64) (*fcrmessages.FCRMessage, error) {
+	return addFields(request, requestIDField{PaymentRequestID: requestID})
+}
+
+// Charge charges a payer that has paid received for a request on pieceCID which costs price. If requestID
+// references an unexpired payment request of the same payer for the same cid, the amount owed under that payment
+// request is charged instead of the price. The credit of the payer is used together with received, and anything
+// paid over the charge is credited to the payer. It returns true if the charge is covered, in which case the
+// referenced payment request is settled. Otherwise, it returns the payment request for the amount still owed: an
+// open payment request of the payer for the same cid and amount is returned again rather than issuing a new one.
+// ErrTooManyRequests is returned, and everything available credited to the payer, if a payment request is needed
+// while the payer or the manager has reached its limit of outstanding payment requests.
+// Payers must be authenticated, by receiving a voucher on their payment channel, before they are charged.
+func (m *RequestMgr) Charge(payer string, pieceCID *cid.ContentID, price *big.Int, received *big.Int, requestID int64) (bool, *Request, error) {
+	now := util.GetTimeImpl().Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.prune(now)
+
+	available := new(big.Int).Set(received)
+	if credit, exists := m.credits[payer]; exists {
+		available.Add(available, credit)
+		delete(m.credits, payer)
+	}
+
+	owed := price
+	request, exists := m.requests[requestID]
+	if exists && request.Payer == payer && request.CID == pieceCID.ToString() {
+		owed = request.Owed
+	} else {
+		request = nil
+	}
+
+	if available.Cmp(owed) >= 0 {
+		if request != nil {
+			delete(m.requests, request.ID)
+		}
+		m.credit(payer, available.Sub(available, owed))
+		return true, nil, nil
+	}
+
+	remaining := new(big.Int).Sub(owed, available)
+	if request == nil {
+		request = m.open(payer, pieceCID.ToString(), remaining)
+	}
+	if request == nil {
+		if len(m.requests) >= m.limit || m.count(payer) >= m.payerLimit {
+			m.credit(payer, available)
+			return false, nil, ErrTooManyRequests
+		}
+		request = &Request{ID: m.newID(), Payer: payer, CID: pieceCID.ToString()}
+		m.requests[request.ID] = request
+	}
+	request.Owed = remaining
+	request.Expiry = now.Add(m.ttl)
+	copied := *request
+	return false, &copied, nil
+}
+
+// Credit credits amount to a payer, for instance to refund the part of a charge that could not be spent.
+func (m *RequestMgr) Credit(payer string, amount *big.Int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.credit(payer, amount)
+}
+
+// GetCredit returns the credit of a payer.
+func (m *RequestMgr) GetCredit(payer string) *big.Int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if credit, exists := m.credits[payer]; exists {
+		return new(big.Int).Set(credit)
+	}
+	return big.NewInt(0)
+}
+
+// credit adds amount to the credit of a payer. It must be called with the lock held.
+func (m *RequestMgr) credit(payer string, amount *big.Int) {
+	if amount.Sign() <= 0 {
+		return
+	}
+	credit, exists := m.credits[payer]
+	if !exists {
+		credit = big.NewInt(0)
+		m.credits[payer] = credit
+	}
+	credit.Add(credit, amount)
+}
+
+// open returns the outstanding payment request of a payer for a cid and amount owed, or nil if there is none. It
+// must be called with the lock held.
+func (m *RequestMgr) open(payer string, pieceCID string, owed *big.Int) *Request {
+	for _, request := range m.requests {
+		if request.Payer == payer && request.CID == pieceCID && request.Owed.Cmp(owed) == 0 {
+			return request
+		}
+	}
+	return nil
+}
+
+// count returns the number of outstanding payment requests of a payer. It must be called with the lock held.
+func (m *RequestMgr) count(payer string) int {
+	count := 0
+	for _, request := range m.requests {
+		if request.Payer == payer {
+			count++
+		}
+	}
+	return count
+}
+
+// newID returns a random, positive, unused payment request ID. It must be called with the lock held.
+func (m *RequestMgr) newID() int64 {
+	for {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			logging.ErrorAndPanic("Error generating a payment request ID: %s", err.Error())
+		}
+		id := int64(binary.BigEndian.Uint64(b) >> 1)
+		if _, exists := m.requests[id]; id != 0 && !exists {
+			return id
+		}
+	}
+}
+
+// prune removes the expired payment requests. It must be called with the lock held.
+func (m *RequestMgr) prune(now time.Time) {
+	for id, request := range m.requests {
+		if !now.Before(request.Expiry) {
+			delete(m.requests, id)
+		}
+	}
+}
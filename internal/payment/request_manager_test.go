@@ -0,0 +1,196 @@
+package payment
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/fcrmessages"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+func TestChargePaid(t *testing.T) {
+	m := NewRequestMgr(time.Minute, 100, 10)
+	pieceCID := cid.NewRandomContentID()
+	paid, request, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(10), 0)
+	assert.True(t, paid)
+	assert.Nil(t, request)
+}
+
+func TestChargePayThenRetry(t *testing.T) {
+	m := NewRequestMgr(time.Minute, 100, 10)
+	pieceCID := cid.NewRandomContentID()
+	paid, request, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(4), 0)
+	assert.False(t, paid)
+	assert.NotZero(t, request.ID)
+	assert.Equal(t, big.NewInt(6), request.Owed)
+
+	// Paying part of the amount owed keeps the same payment request.
+	paid, retry, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(5), request.ID)
+	assert.False(t, paid)
+	assert.Equal(t, request.ID, retry.ID)
+	assert.Equal(t, big.NewInt(1), retry.Owed)
+
+	paid, _, _ = m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(1), request.ID)
+	assert.True(t, paid)
+
+	// The payment request is settled, so it can't be used again.
+	paid, _, _ = m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(1), request.ID)
+	assert.False(t, paid)
+}
+
+func TestChargeBoundToPayerAndCID(t *testing.T) {
+	m := NewRequestMgr(time.Minute, 100, 10)
+	pieceCID := cid.NewRandomContentID()
+	_, request, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(9), 0)
+
+	paid, other, _ := m.Charge("other", pieceCID, big.NewInt(10), big.NewInt(1), request.ID)
+	assert.False(t, paid)
+	assert.NotEqual(t, request.ID, other.ID)
+
+	paid, _, _ = m.Charge("paych", cid.NewRandomContentID(), big.NewInt(10), big.NewInt(1), request.ID)
+	assert.False(t, paid)
+}
+
+func TestChargeExpired(t *testing.T) {
+	defer util.SetRealClock()
+	util.SetMockedClock(1000)
+	m := NewRequestMgr(time.Minute, 100, 10)
+	pieceCID := cid.NewRandomContentID()
+	_, request, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(9), 0)
+
+	util.SetMockedClock(1060)
+	paid, _, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(1), request.ID)
+	assert.False(t, paid)
+}
+
+func TestRequestIDFromBody(t *testing.T) {
+	assert.Equal(t, int64(12), RequestIDFromBody([]byte(`{"piece_cid":"a","payment_request_id":12}`)))
+	assert.Equal(t, int64(0), RequestIDFromBody([]byte(`{"piece_cid":"a"}`)))
+}
+
+func TestAddRequestID(t *testing.T) {
+	request, err := fcrmessages.EncodeClientStandardDiscoverRequestV2(cid.NewRandomContentID(), 1, 60, "paych", "10")
+	require.NoError(t, err)
+	referenced, err := AddRequestID(request, 12)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), RequestIDFromBody(referenced.GetMessageBody()))
+
+	// The rest of the request is left untouched.
+	_, nonce, _, paychAddr, voucher, err := fcrmessages.DecodeClientStandardDiscoverRequestV2(referenced)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), nonce)
+	assert.Equal(t, "paych", paychAddr)
+	assert.Equal(t, "10", voucher)
+}
+
+func TestChargeCreditsOverpayment(t *testing.T) {
+	m := NewRequestMgr(time.Minute, 100, 10)
+	pieceCID := cid.NewRandomContentID()
+	paid, _, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(25), 0)
+	assert.True(t, paid)
+	assert.Equal(t, big.NewInt(15), m.GetCredit("paych"))
+
+	// The credit pays for the next requests.
+	paid, _, _ = m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(0), 0)
+	assert.True(t, paid)
+	assert.Equal(t, big.NewInt(5), m.GetCredit("paych"))
+
+	// Credit that doesn't cover a charge goes towards the payment request.
+	paid, request, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(0), 0)
+	assert.False(t, paid)
+	assert.Equal(t, big.NewInt(5), request.Owed)
+	assert.Equal(t, big.NewInt(0), m.GetCredit("paych"))
+
+	m.Credit("paych", big.NewInt(3))
+	assert.Equal(t, big.NewInt(3), m.GetCredit("paych"))
+	assert.Equal(t, big.NewInt(0), m.GetCredit("other"))
+}
+
+func TestFlushAndLoad(t *testing.T) {
+	defer util.SetRealClock()
+	util.SetMockedClock(1000)
+	path := filepath.Join(t.TempDir(), "payment_requests.json")
+	m := NewRequestMgr(time.Minute, 100, 10)
+	require.NoError(t, m.Load(path))
+	pieceCID := cid.NewRandomContentID()
+	_, request, _ := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(4), 0)
+	m.Credit("other", big.NewInt(7))
+	require.NoError(t, m.Flush(path))
+
+	loaded := NewRequestMgr(time.Minute, 100, 10)
+	require.NoError(t, loaded.Load(path))
+	assert.Equal(t, big.NewInt(7), loaded.GetCredit("other"))
+	paid, _, _ := loaded.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(6), request.ID)
+	assert.True(t, paid)
+
+	// Payment requests that expired while the gateway was stopped are dropped.
+	util.SetMockedClock(1060)
+	expired := NewRequestMgr(time.Minute, 100, 10)
+	require.NoError(t, expired.Load(path))
+	paid, _, _ = expired.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(6), request.ID)
+	assert.False(t, paid)
+}
+
+func TestChargeReusesOpenRequest(t *testing.T) {
+	m := NewRequestMgr(time.Minute, 100, 10)
+	pieceCID := cid.NewRandomContentID()
+	_, request, err := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(0), 0)
+	assert.NoError(t, err)
+
+	_, again, err := m.Charge("paych", pieceCID, big.NewInt(10), big.NewInt(0), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, request.ID, again.ID)
+
+	_, other, err := m.Charge("paych", pieceCID, big.NewInt(20), big.NewInt(0), 0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, request.ID, other.ID)
+}
+
+func TestChargeLimits(t *testing.T) {
+	m := NewRequestMgr(time.Minute, 3, 2)
+	for i := 1; i <= 2; i++ {
+		_, _, err := m.Charge("paych", cid.NewRandomContentID(), big.NewInt(10), big.NewInt(0), 0)
+		assert.NoError(t, err)
+	}
+
+	// The payer has reached its limit, what it paid is credited.
+	paid, request, err := m.Charge("paych", cid.NewRandomContentID(), big.NewInt(10), big.NewInt(4), 0)
+	assert.Equal(t, ErrTooManyRequests, err)
+	assert.False(t, paid)
+	assert.Nil(t, request)
+	assert.Equal(t, big.NewInt(4), m.GetCredit("paych"))
+
+	_, _, err = m.Charge("other", cid.NewRandomContentID(), big.NewInt(10), big.NewInt(0), 0)
+	assert.NoError(t, err)
+
+	// The manager has reached its limit.
+	_, _, err = m.Charge("third", cid.NewRandomContentID(), big.NewInt(10), big.NewInt(0), 0)
+	assert.Equal(t, ErrTooManyRequests, err)
+
+	// Charges that are covered are not limited.
+	paid, _, err = m.Charge("third", cid.NewRandomContentID(), big.NewInt(10), big.NewInt(10), 0)
+	assert.NoError(t, err)
+	assert.True(t, paid)
+}
@@ -0,0 +1,105 @@
+package pricing
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/payment"
+)
+
+// gatewayPrices are the fields of a gateway register entry giving the prices of the gateway. They are optional, and
+// written in the format of the price settings, such as "0.001 FIL".
+type gatewayPrices struct {
+	NodeID      string `json:"nodeId"`
+	SearchPrice string `json:"searchPrice"`
+	OfferPrice  string `json:"offerPrice"`
+}
+
+// PeerPrices holds the prices of peer gateways, as published in the register.
+type PeerPrices struct {
+	lock   sync.RWMutex
+	search map[string]*big.Int
+	offer  map[string]*big.Int
+}
+
+// NewPeerPrices creates an empty set of peer prices.
+func NewPeerPrices() *PeerPrices {
+	return &PeerPrices{search: make(map[string]*big.Int), offer: make(map[string]*big.Int)}
+}
+
+// Update replaces the peer prices with those of the gateway register entries given as a JSON array. Prices that are
+// not valid amounts are ignored, as if the gateway had not published them. It returns an error if the register entries
+// can't be decoded, in which case the peer prices are left unchanged.
+func (p *PeerPrices) Update(registers []byte) error {
+	entries := make([]gatewayPrices, 0)
+	if err := json.Unmarshal(registers, &entries); err != nil {
+		return err
+	}
+	search := make(map[string]*big.Int)
+	offer := make(map[string]*big.Int)
+	for _, entry := range entries {
+		id, err := nodeid.NewNodeIDFromHexString(entry.NodeID)
+		if err != nil {
+			continue
+		}
+		readPrice(search, id, "search", entry.SearchPrice)
+		readPrice(offer, id, "offer", entry.OfferPrice)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.search, p.offer = search, offer
+	return nil
+}
+
+// Search returns the search price published by a gateway, and false if it has not published one.
+func (p *PeerPrices) Search(gatewayID *nodeid.NodeID) (*big.Int, bool) {
+	return p.get(p.search, gatewayID)
+}
+
+// Offer returns the offer price published by a gateway, and false if it has not published one.
+func (p *PeerPrices) Offer(gatewayID *nodeid.NodeID) (*big.Int, bool) {
+	return p.get(p.offer, gatewayID)
+}
+
+// get returns a copy of the price of a gateway.
+func (p *PeerPrices) get(prices map[string]*big.Int, gatewayID *nodeid.NodeID) (*big.Int, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	price, exists := prices[gatewayID.ToString()]
+	if !exists {
+		return nil, false
+	}
+	return new(big.Int).Set(price), true
+}
+
+// readPrice records the price published by a gateway, if it is a valid amount.
+func readPrice(prices map[string]*big.Int, gatewayID *nodeid.NodeID, kind string, value string) {
+	if value == "" {
+		return
+	}
+	price, err := payment.ParseAmount(value)
+	if err != nil || price.Sign() <= 0 {
+		logging.Warn("Ignoring the %s price %q published by gateway %s", kind, value, gatewayID.ToString())
+		return
+	}
+	prices[gatewayID.ToString()] = price
+}
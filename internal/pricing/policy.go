@@ -0,0 +1,44 @@
+package pricing
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+// Request is a paid request to be priced.
+type Request struct {
+	PieceCID *cid.ContentID
+	ClientID *nodeid.NodeID // Client sending the request, nil for requests from gateways
+}
+
+// Policy prices the paid requests. Prices are in attoFIL, and callers may modify the prices returned.
+type Policy interface {
+	// SearchPrice returns the price of a search for the offers held by this gateway.
+	SearchPrice(request Request) *big.Int
+
+	// OfferPrice returns the price of each offer sent by this gateway.
+	OfferPrice(request Request) *big.Int
+
+	// PeerSearchPrice returns the price of a search for the offers held by a peer gateway, paid to the peer gateway.
+	PeerSearchPrice(gatewayID *nodeid.NodeID) *big.Int
+
+	// PeerOfferPrice returns the price of each offer sent by a peer gateway, paid to the peer gateway.
+	PeerOfferPrice(gatewayID *nodeid.NodeID) *big.Int
+}
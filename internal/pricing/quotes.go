@@ -0,0 +1,159 @@
+package pricing
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+// Quote is a price quote given to a client for the requests on a cid. Its prices are charged, instead of the prices
+// of the policy, for the requests of the client on the cid that reference the quote until it expires. Quotes are
+// not modified once issued.
+type Quote struct {
+	ID               int64
+	ClientID         string
+	PieceCID         string
+	SearchPrice      *big.Int
+	OfferPrice       *big.Int
+	PeerSearchPrices map[string]*big.Int // Search prices of the gateways a DHT discovery contacts, by node id
+	Expiry           time.Time
+}
+
+// DHTCost returns the price of a DHT discovery contacting the gateways of the quote.
+func (q *Quote) DHTCost() *big.Int {
+	cost := big.NewInt(0)
+	for _, price := range q.PeerSearchPrices {
+		cost.Add(cost, price)
+	}
+	return cost
+}
+
+// PeerSearchPrice returns the quoted search price of a gateway, or false if the gateway is not part of the quote.
+func (q *Quote) PeerSearchPrice(id *nodeid.NodeID) (*big.Int, bool) {
+	price, exists := q.PeerSearchPrices[id.ToString()]
+	return price, exists
+}
+
+// ErrTooManyQuotes is returned when the quote manager already remembers as many quotes as it may.
+var ErrTooManyQuotes = errors.New("too many price quotes")
+
+// QuoteMgr issues price quotes and remembers them until they expire.
+type QuoteMgr struct {
+	lock   sync.Mutex
+	quotes map[int64]*Quote
+}
+
+// quoteIDField is the field of a request body that references a price quote.
+type quoteIDField struct {
+	QuoteID int64 `json:"quote_id"`
+}
+
+// NewQuoteMgr creates a price quote manager.
+func NewQuoteMgr() *QuoteMgr {
+	return &QuoteMgr{quotes: make(map[int64]*Quote)}
+}
+
+// QuoteIDFromBody returns the price quote ID referenced by a request body, or 0 if there is none.
+func QuoteIDFromBody(body []byte) int64 {
+	field := quoteIDField{}
+	// Errors are ignored on purpose: the reference is optional and the body is decoded by the handler.
+	_ = json.Unmarshal(body, &field)
+	return field.QuoteID
+}
+
+// Issue issues a quote that expires after ttl. It returns the quote, with its ID and expiry set.
+// At most limit quotes are remembered, and at most clientLimit for the client of the quote: the earliest expiring
+// quote of the client is dropped to make room for a new one, while ErrTooManyQuotes is returned if the manager is
+// full, so that the quotes given to other clients are honoured.
+func (m *QuoteMgr) Issue(quote Quote, ttl time.Duration, limit int, clientLimit int) (*Quote, error) {
+	now := util.GetTimeImpl().Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.prune(now)
+
+	var earliest *Quote
+	count := 0
+	for _, issued := range m.quotes {
+		if issued.ClientID != quote.ClientID {
+			continue
+		}
+		count++
+		if earliest == nil || issued.Expiry.Before(earliest.Expiry) {
+			earliest = issued
+		}
+	}
+	if count >= clientLimit && earliest != nil {
+		delete(m.quotes, earliest.ID)
+	} else if len(m.quotes) >= limit {
+		return nil, ErrTooManyQuotes
+	}
+
+	quote.ID = m.newID()
+	quote.Expiry = now.Add(ttl)
+	m.quotes[quote.ID] = &quote
+	return &quote, nil
+}
+
+// Get returns the unexpired quote with the given ID, if it was given to the client for the cid, or nil otherwise.
+func (m *QuoteMgr) Get(id int64, clientID *nodeid.NodeID, pieceCID *cid.ContentID) *Quote {
+	if id == 0 {
+		return nil
+	}
+	now := util.GetTimeImpl().Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.prune(now)
+
+	quote, exists := m.quotes[id]
+	if !exists || quote.ClientID != clientID.ToString() || quote.PieceCID != pieceCID.ToString() {
+		return nil
+	}
+	return quote
+}
+
+// newID returns a random, positive, unused quote ID. It must be called with the lock held.
+func (m *QuoteMgr) newID() int64 {
+	for {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		id := int64(binary.BigEndian.Uint64(b) >> 1)
+		if _, exists := m.quotes[id]; id != 0 && !exists {
+			return id
+		}
+	}
+}
+
+// prune removes the expired quotes. It must be called with the lock held.
+func (m *QuoteMgr) prune(now time.Time) {
+	for id, quote := range m.quotes {
+		if !now.Before(quote.Expiry) {
+			delete(m.quotes, id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package pricing
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+func TestQuotes(t *testing.T) {
+	defer util.SetRealClock()
+	util.SetMockedClock(1000)
+	m := NewQuoteMgr()
+	client := nodeid.NewRandomNodeID()
+	peer := nodeid.NewRandomNodeID()
+	pieceCID := cid.NewRandomContentID()
+	quote, err := m.Issue(Quote{
+		ClientID:         client.ToString(),
+		PieceCID:         pieceCID.ToString(),
+		SearchPrice:      big.NewInt(10),
+		OfferPrice:       big.NewInt(1),
+		PeerSearchPrices: map[string]*big.Int{peer.ToString(): big.NewInt(20), "other": big.NewInt(30)},
+	}, time.Minute, 10, 10)
+	require.NoError(t, err)
+	assert.NotZero(t, quote.ID)
+	assert.Equal(t, int64(1060), quote.Expiry.Unix())
+	assert.Equal(t, int64(50), quote.DHTCost().Int64())
+	price, exists := quote.PeerSearchPrice(peer)
+	assert.True(t, exists)
+	assert.Equal(t, int64(20), price.Int64())
+	_, exists = quote.PeerSearchPrice(client)
+	assert.False(t, exists)
+
+	// Quotes are bound to the client and the cid.
+	assert.Equal(t, quote, m.Get(quote.ID, client, pieceCID))
+	assert.Nil(t, m.Get(quote.ID, peer, pieceCID))
+	assert.Nil(t, m.Get(quote.ID, client, cid.NewRandomContentID()))
+	assert.Nil(t, m.Get(0, client, pieceCID))
+
+	util.SetMockedClock(1059)
+	assert.NotNil(t, m.Get(quote.ID, client, pieceCID))
+	util.SetMockedClock(1060)
+	assert.Nil(t, m.Get(quote.ID, client, pieceCID))
+}
+
+func TestQuoteLimits(t *testing.T) {
+	defer util.SetRealClock()
+	util.SetMockedClock(1000)
+	m := NewQuoteMgr()
+	pieceCID := cid.NewRandomContentID()
+	issue := func(client *nodeid.NodeID) (*Quote, error) {
+		util.SetMockedClock(util.GetTimeImpl().Now().Unix() + 1)
+		return m.Issue(Quote{ClientID: client.ToString(), PieceCID: pieceCID.ToString()}, time.Minute, 3, 2)
+	}
+
+	// A new quote replaces the earliest expiring quote of a client at its limit.
+	client := nodeid.NewRandomNodeID()
+	first, err := issue(client)
+	require.NoError(t, err)
+	second, err := issue(client)
+	require.NoError(t, err)
+	third, err := issue(client)
+	require.NoError(t, err)
+	assert.Nil(t, m.Get(first.ID, client, pieceCID))
+	assert.NotNil(t, m.Get(second.ID, client, pieceCID))
+	assert.NotNil(t, m.Get(third.ID, client, pieceCID))
+
+	// The quotes of other clients are kept once the manager is full.
+	other := nodeid.NewRandomNodeID()
+	_, err = issue(other)
+	require.NoError(t, err)
+	_, err = issue(nodeid.NewRandomNodeID())
+	assert.Equal(t, ErrTooManyQuotes, err)
+	assert.NotNil(t, m.Get(second.ID, client, pieceCID))
+
+	// Room is made as quotes expire.
+	util.SetMockedClock(second.Expiry.Unix())
+	_, err = issue(nodeid.NewRandomNodeID())
+	assert.NoError(t, err)
+}
+
+func TestQuoteIDFromBody(t *testing.T) {
+	assert.Equal(t, int64(12), QuoteIDFromBody([]byte(`{"piece_cid":"a","quote_id":12}`)))
+	assert.Equal(t, int64(0), QuoteIDFromBody([]byte(`{"piece_cid":"a"}`)))
+}
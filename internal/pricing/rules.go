@@ -0,0 +1,119 @@
+package pricing
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/reputation"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+// Rules is the pricing policy given by the settings of the gateway, read on every request so that reloaded settings
+// apply at once.
+//
+// The prices charged to clients are SEARCH_PRICE and OFFER_PRICE, scaled by the percentage of the first range of
+// PRICE_CID_RANGES holding the CID, then by PRICE_SURGE_PERCENT while PRICE_SURGE_THRESHOLD requests or more are in
+// flight, and discounted by the tier of PRICE_REPUTATION_DISCOUNTS reached by the client. Gateways are charged
+// SEARCH_PRICE and OFFER_PRICE as they are. The prices of peer gateways are those read from the register, or the
+// prices charged to gateways for peers that don't publish their prices.
+type Rules struct {
+	settings   func() *settings.AppSettings
+	load       func() int
+	reputation *reputation.Reputation
+	peers      *PeerPrices
+}
+
+// NewRules creates the pricing policy given by the settings. load returns the number of requests in flight.
+func NewRules(settings func() *settings.AppSettings, load func() int, reputation *reputation.Reputation, peers *PeerPrices) *Rules {
+	return &Rules{settings: settings, load: load, reputation: reputation, peers: peers}
+}
+
+// SearchPrice returns the price of a search for the offers held by this gateway.
+func (r *Rules) SearchPrice(request Request) *big.Int {
+	conf := r.settings()
+	return r.adjust(conf, conf.SearchPrice, request)
+}
+
+// OfferPrice returns the price of each offer sent by this gateway.
+func (r *Rules) OfferPrice(request Request) *big.Int {
+	conf := r.settings()
+	return r.adjust(conf, conf.OfferPrice, request)
+}
+
+// PeerSearchPrice returns the price of a search for the offers held by a peer gateway.
+func (r *Rules) PeerSearchPrice(gatewayID *nodeid.NodeID) *big.Int {
+	if price, exists := r.peers.Search(gatewayID); exists {
+		return price
+	}
+	return new(big.Int).Set(r.settings().SearchPrice)
+}
+
+// PeerOfferPrice returns the price of each offer sent by a peer gateway.
+func (r *Rules) PeerOfferPrice(gatewayID *nodeid.NodeID) *big.Int {
+	if price, exists := r.peers.Offer(gatewayID); exists {
+		return price
+	}
+	return new(big.Int).Set(r.settings().OfferPrice)
+}
+
+// adjust returns the price of a request, starting from the given price.
+func (r *Rules) adjust(conf *settings.AppSettings, price *big.Int, request Request) *big.Int {
+	adjusted := new(big.Int).Set(price)
+	if request.ClientID == nil {
+		return adjusted
+	}
+	if request.PieceCID != nil {
+		pieceCID := request.PieceCID.ToString()
+		for _, cidRange := range conf.PriceCIDRanges {
+			if cidRange.Contains(pieceCID) {
+				scale(adjusted, cidRange.Percent)
+				break
+			}
+		}
+	}
+	if conf.PriceSurgeThreshold > 0 && int64(r.load()) >= conf.PriceSurgeThreshold {
+		scale(adjusted, conf.PriceSurgePercent)
+	}
+	if rep, exists := r.reputation.GetClientReputation(request.ClientID); exists {
+		if discount := discountFor(conf.PriceReputationDiscounts, rep); discount > 0 {
+			scale(adjusted, 100-discount)
+		}
+	}
+	return adjusted
+}
+
+// discountFor returns the discount, in percent, of the highest tier reached by a reputation.
+func discountFor(discounts settings.ReputationDiscounts, rep int64) int64 {
+	var reached *settings.ReputationDiscount
+	for i := range discounts {
+		if rep >= discounts[i].MinReputation && (reached == nil || discounts[i].MinReputation > reached.MinReputation) {
+			reached = &discounts[i]
+		}
+	}
+	if reached == nil {
+		return 0
+	}
+	return reached.Percent
+}
+
+// scale sets price to percent of price, rounded down to the attoFIL.
+func scale(price *big.Int, percent int64) {
+	price.Mul(price, big.NewInt(percent))
+	price.Quo(price, big.NewInt(100))
+}
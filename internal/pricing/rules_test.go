@@ -0,0 +1,85 @@
+package pricing
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/cid"
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/reputation"
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util/settings"
+)
+
+func TestRules(t *testing.T) {
+	backend, err := reputation.NewFileBackend(t.TempDir())
+	require.NoError(t, err)
+	rep, err := reputation.NewReputation(backend)
+	require.NoError(t, err)
+	conf := &settings.AppSettings{
+		SearchPrice:              big.NewInt(1000),
+		OfferPrice:               big.NewInt(100),
+		PriceCIDRanges:           settings.CIDRangePrices{{First: "00", Last: "7f", Percent: 200}},
+		PriceReputationDiscounts: settings.ReputationDiscounts{{MinReputation: 0, Percent: 10}, {MinReputation: 500, Percent: 50}},
+		PriceSurgeThreshold:      10,
+		PriceSurgePercent:        150,
+	}
+	load := 0
+	rules := NewRules(func() *settings.AppSettings { return conf }, func() int { return load }, rep, NewPeerPrices())
+
+	low, err := cid.NewContentIDFromHexString("01" + strings.Repeat("0", 62))
+	require.NoError(t, err)
+	high, err := cid.NewContentIDFromHexString("ff" + strings.Repeat("0", 62))
+	require.NoError(t, err)
+	client := nodeid.NewRandomNodeID()
+
+	// Gateways are charged the flat prices, clients without a reputation get no discount.
+	assert.Equal(t, int64(1000), rules.SearchPrice(Request{PieceCID: low}).Int64())
+	assert.Equal(t, int64(200), rules.OfferPrice(Request{PieceCID: low, ClientID: client}).Int64())
+	assert.Equal(t, int64(1000), rules.SearchPrice(Request{PieceCID: high, ClientID: client}).Int64())
+
+	rep.SetClientReputation(client, 600)
+	assert.Equal(t, int64(1000), rules.SearchPrice(Request{PieceCID: low, ClientID: client}).Int64())
+	rep.SetClientReputation(client, 100)
+	assert.Equal(t, int64(900), rules.SearchPrice(Request{PieceCID: high, ClientID: client}).Int64())
+
+	load = 10
+	assert.Equal(t, int64(1350), rules.SearchPrice(Request{PieceCID: high, ClientID: client}).Int64())
+	assert.Equal(t, int64(1000), rules.SearchPrice(Request{PieceCID: high}).Int64())
+}
+
+func TestPeerPrices(t *testing.T) {
+	conf := &settings.AppSettings{SearchPrice: big.NewInt(1000), OfferPrice: big.NewInt(100)}
+	peers := NewPeerPrices()
+	rules := NewRules(func() *settings.AppSettings { return conf }, func() int { return 0 }, nil, peers)
+	priced, unpriced := nodeid.NewRandomNodeID(), nodeid.NewRandomNodeID()
+
+	require.NoError(t, peers.Update([]byte(`[
+		{"nodeId":"`+priced.ToString()+`","searchPrice":"2 nanoFIL","offerPrice":"not an amount"},
+		{"nodeId":"`+unpriced.ToString()+`"}]`)))
+	assert.Equal(t, int64(2000000000), rules.PeerSearchPrice(priced).Int64())
+	assert.Equal(t, int64(100), rules.PeerOfferPrice(priced).Int64())
+	assert.Equal(t, int64(1000), rules.PeerSearchPrice(unpriced).Int64())
+
+	assert.Error(t, peers.Update([]byte(`{}`)))
+	assert.Equal(t, int64(2000000000), rules.PeerSearchPrice(priced).Int64())
+}
@@ -0,0 +1,244 @@
+package reputation
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
+
+	"github.com/ConsenSys/fc-retrieval-gateway/internal/util"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	logFileName      = "reputation.log"
+	oldLogFileName   = "reputation.log.old"
+)
+
+// snapshot is the content of the snapshot file. Seq is the sequence number of the last change included.
+type snapshot struct {
+	Seq   uint64 `json:"seq"`
+	State *State `json:"state"`
+}
+
+// logEntry is a line of the change log. It holds the new absolute value, so replaying an entry twice is harmless.
+type logEntry struct {
+	Seq   uint64   `json:"seq"`
+	Kind  NodeKind `json:"kind"`
+	ID    string   `json:"id"`
+	Value int64    `json:"value"`
+}
+
+// FileBackend persists reputation in a directory, as a snapshot plus an append-only log of the changes made
+// since the snapshot. On load, the log is replayed on top of the snapshot.
+//
+// Taking a snapshot rotates the log first, and then captures the state. Changes in the rotated log are therefore
+// all included in the snapshot, and the rotated log can be removed once the snapshot is written. Log entries carry
+// a sequence number, so entries already included in a snapshot are skipped if a crash leaves the rotated log behind.
+type FileBackend struct {
+	dir          string
+	lock         sync.Mutex
+	snapshotLock sync.Mutex
+	log          *os.File
+	seq          uint64
+}
+
+// NewFileBackend creates a file backend in the given directory, creating the directory if needed.
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// Load reads the snapshot and replays the log. The result is compacted into a new snapshot, and an empty log
+// is opened for the changes to come.
+func (b *FileBackend) Load() (*State, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.log != nil {
+		return nil, errors.New("reputation backend already loaded")
+	}
+
+	state := newState()
+	data, err := ioutil.ReadFile(b.path(snapshotFileName))
+	if err == nil {
+		snap := snapshot{}
+		if err = json.Unmarshal(data, &snap); err != nil {
+			return nil, err
+		}
+		if snap.State != nil {
+			state = snap.State
+			state.ensureMaps()
+		}
+		b.seq = snap.Seq
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	snapshotSeq := b.seq
+	for _, name := range []string{oldLogFileName, logFileName} {
+		if err = b.replay(name, snapshotSeq, state); err != nil {
+			return nil, err
+		}
+	}
+
+	// Compact, so that the next rotation never overwrites a log that has not been snapshotted.
+	if err = b.writeSnapshot(b.seq, state); err != nil {
+		return nil, err
+	}
+	if err = os.Remove(b.path(oldLogFileName)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	b.log, err = os.OpenFile(b.path(logFileName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Append records the new reputation value of a node.
+func (b *FileBackend) Append(kind NodeKind, id string, value int64) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.log == nil {
+		return errors.New("reputation backend not loaded or closed")
+	}
+	b.seq++
+	data, err := json.Marshal(logEntry{Seq: b.seq, Kind: kind, ID: id, Value: value})
+	if err != nil {
+		return err
+	}
+	_, err = b.log.Write(append(data, '\n'))
+	return err
+}
+
+// Snapshot rotates the log, writes the state returned by capture and removes the rotated log.
+func (b *FileBackend) Snapshot(capture func() *State) error {
+	b.snapshotLock.Lock()
+	defer b.snapshotLock.Unlock()
+
+	b.lock.Lock()
+	if b.log == nil {
+		b.lock.Unlock()
+		return errors.New("reputation backend not loaded or closed")
+	}
+	seq := b.seq
+	err := b.rotate()
+	b.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = b.writeSnapshot(seq, capture()); err != nil {
+		return err
+	}
+	if err = os.Remove(b.path(oldLogFileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Close closes the log.
+func (b *FileBackend) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.log == nil {
+		return nil
+	}
+	err := b.log.Close()
+	b.log = nil
+	return err
+}
+
+// rotate moves the current log aside and opens a new one. It must be called with the lock held.
+func (b *FileBackend) rotate() error {
+	if err := b.log.Sync(); err != nil {
+		return err
+	}
+	if err := b.log.Close(); err != nil {
+		return err
+	}
+	b.log = nil
+	if err := os.Rename(b.path(logFileName), b.path(oldLogFileName)); err != nil {
+		return err
+	}
+	log, err := os.OpenFile(b.path(logFileName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	b.log = log
+	return nil
+}
+
+// replay applies the entries of a log file that are more recent than the snapshot to the state.
+func (b *FileBackend) replay(name string, snapshotSeq uint64, state *State) error {
+	file, err := os.Open(b.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := logEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash may leave a partially written last line.
+			logging.Warn("Skipping unreadable entry in reputation log %s", name)
+			continue
+		}
+		if entry.Seq > b.seq {
+			b.seq = entry.Seq
+		}
+		if entry.Seq <= snapshotSeq {
+			continue
+		}
+		switch entry.Kind {
+		case nodeKindClient:
+			state.Clients[entry.ID] = entry.Value
+		case nodeKindGateway:
+			state.Gateways[entry.ID] = entry.Value
+		case nodeKindProvider:
+			state.Providers[entry.ID] = entry.Value
+		default:
+			logging.Warn("Skipping entry of unknown kind %s in reputation log %s", entry.Kind, name)
+		}
+	}
+	return scanner.Err()
+}
+
+// writeSnapshot atomically writes a snapshot file.
+func (b *FileBackend) writeSnapshot(seq uint64, state *State) error {
+	data, err := json.Marshal(snapshot{Seq: seq, State: state})
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(b.path(snapshotFileName), data)
+}
+
+// path returns the path of a file in the backend directory.
+func (b *FileBackend) path(name string) string {
+	return filepath.Join(b.dir, name)
+}
@@ -0,0 +1,95 @@
+package reputation
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
+)
+
+func TestFileBackendRestoresAfterClose(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	assert.Empty(t, err)
+	r, err := NewReputation(backend)
+	assert.Empty(t, err)
+
+	n := nodeid.NewRandomNodeID()
+	r.ClientEstablishmentChallenge(n)
+	r.ClientDhtDiscNonPayment(n)
+	assert.Empty(t, r.Close())
+
+	backend, err = NewFileBackend(dir)
+	assert.Empty(t, err)
+	r, err = NewReputation(backend)
+	assert.Empty(t, err)
+	rep, exists := r.GetClientReputation(n)
+	assert.True(t, exists)
+	assert.Equal(t, clientInitialReputation+clientEstablishmentChallenge+clientDhtDiscNonPayment, rep)
+	assert.Empty(t, r.Close())
+}
+
+func TestFileBackendReplaysLogAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	assert.Empty(t, err)
+	r, err := NewReputation(backend)
+	assert.Empty(t, err)
+
+	n := nodeid.NewRandomNodeID()
+	r.ClientEstablishmentChallenge(n)
+	assert.Empty(t, backend.Snapshot(r.Capture))
+	r.ClientInvalidMessage(n)
+	// No close, as if the process had crashed.
+
+	backend, err = NewFileBackend(dir)
+	assert.Empty(t, err)
+	r, err = NewReputation(backend)
+	assert.Empty(t, err)
+	rep, _ := r.GetClientReputation(n)
+	assert.Equal(t, clientInitialReputation+clientEstablishmentChallenge+clientInvalidMessage, rep)
+	assert.Empty(t, r.Close())
+}
+
+func TestFileBackendSkipsEntriesIncludedInSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	assert.Empty(t, err)
+	r, err := NewReputation(backend)
+	assert.Empty(t, err)
+
+	n := nodeid.NewRandomNodeID()
+	r.ClientEstablishmentChallenge(n)
+	r.OnChainDeposit(n)
+	assert.Empty(t, r.Close())
+
+	// A rotated log left behind by a crash after the snapshot was written must not be replayed.
+	stale := `{"seq":1,"kind":"client","id":"` + n.ToString() + `","value":10}` + "\n"
+	assert.Empty(t, ioutil.WriteFile(filepath.Join(dir, oldLogFileName), []byte(stale), 0600))
+
+	backend, err = NewFileBackend(dir)
+	assert.Empty(t, err)
+	r, err = NewReputation(backend)
+	assert.Empty(t, err)
+	rep, _ := r.GetClientReputation(n)
+	assert.Equal(t, clientInitialReputation+clientEstablishmentChallenge+clientOnChainDeposit, rep)
+	assert.Empty(t, r.Close())
+}
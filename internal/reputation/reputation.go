@@ -21,7 +21,9 @@ package reputation
 
 import (
 	"sync"
+	"time"
 
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
 )
 
@@ -37,6 +39,11 @@ type Reputation struct {
 	gatewaysMapLock  sync.RWMutex
 	providers        map[string]int64
 	providersMapLock sync.RWMutex
+
+	// backend persists reputation changes, it is nil if reputation is only held in memory
+	backend       Backend
+	stopSnapshots chan bool
+	snapshotsDone chan bool
 }
 
 // Create a new instance
@@ -51,11 +58,89 @@ func newInstance() *Reputation {
 	return &r
 }
 
-// GetSingleInstance is a factory method to get the single instance of the reputation system
+// GetSingleInstance is a factory method to get the single instance of the reputation system.
+// The single instance is held in memory only.
 func GetSingleInstance() *Reputation {
 	return instance
 }
 
+// NewReputation creates a reputation system persisted by the given backend, restoring the persisted state.
+func NewReputation(backend Backend) (*Reputation, error) {
+	state, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	r := newInstance()
+	r.clients = state.Clients
+	r.gateways = state.Gateways
+	r.providers = state.Providers
+	r.backend = backend
+	logging.Info("Restored reputation of %d clients, %d gateways and %d providers", len(r.clients), len(r.gateways), len(r.providers))
+	return r, nil
+}
+
+// StartSnapshots starts a routine that periodically snapshots the reputation to the backend.
+func (r *Reputation) StartSnapshots(interval time.Duration) {
+	if r.backend == nil || r.stopSnapshots != nil {
+		return
+	}
+	r.stopSnapshots = make(chan bool)
+	r.snapshotsDone = make(chan bool)
+	go func() {
+		defer close(r.snapshotsDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.backend.Snapshot(r.Capture); err != nil {
+					logging.Error("Error taking reputation snapshot: %s", err.Error())
+				}
+			case <-r.stopSnapshots:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the snapshot routine, takes a final snapshot and closes the backend.
+func (r *Reputation) Close() error {
+	if r.backend == nil {
+		return nil
+	}
+	if r.stopSnapshots != nil {
+		close(r.stopSnapshots)
+		<-r.snapshotsDone
+		r.stopSnapshots = nil
+	}
+	if err := r.backend.Snapshot(r.Capture); err != nil {
+		r.backend.Close()
+		return err
+	}
+	return r.backend.Close()
+}
+
+// Capture returns a copy of the reputation of all nodes.
+func (r *Reputation) Capture() *State {
+	state := newState()
+	r.clientsMapLock.RLock()
+	for id, val := range r.clients {
+		state.Clients[id] = val
+	}
+	r.clientsMapLock.RUnlock()
+	r.gatewaysMapLock.RLock()
+	for id, val := range r.gateways {
+		state.Gateways[id] = val
+	}
+	r.gatewaysMapLock.RUnlock()
+	r.providersMapLock.RLock()
+	for id, val := range r.providers {
+		state.Providers[id] = val
+	}
+	r.providersMapLock.RUnlock()
+	return state
+}
+
 // establishClientReputation initialises the reputation of a Retrieval Client
 func (r *Reputation) establishClientReputation(clientNodeID *nodeid.NodeID) {
 	r.setClientReputation(clientNodeID, clientInitialReputation)
@@ -78,6 +163,17 @@ func (r *Reputation) GetClientReputation(clientNodeID *nodeid.NodeID) (val int64
 	return
 }
 
+// GetOrEstablishClientReputation returns the client reputation, establishing the initial reputation
+// of the client if it doesn't have a reputation yet.
+func (r *Reputation) GetOrEstablishClientReputation(clientNodeID *nodeid.NodeID) int64 {
+	val, exists := r.getClientReputation(clientNodeID)
+	if !exists {
+		r.establishClientReputation(clientNodeID)
+		val, _ = r.getClientReputation(clientNodeID)
+	}
+	return val
+}
+
 // ClientEstablishmentChallenge updates a Retrieval Client's reputation based on an
 // Establishment Challenge being received. The reputation is created for the Retrival
 // Client if the client doesn't have a reputation yet
@@ -156,3 +252,74 @@ func (r *Reputation) ClientMicroPayment(clientNodeID *nodeid.NodeID) {
 func (r *Reputation) ClientInvalidMessage(clientNodeID *nodeid.NodeID) {
 	r.changeClientReputation(clientNodeID, clientInvalidMessage)
 }
+
+// ClientExpiredRequest updates reputation given a request received after its TTL expired.
+func (r *Reputation) ClientExpiredRequest(clientNodeID *nodeid.NodeID) {
+	r.changeClientReputation(clientNodeID, clientExpiredRequest)
+}
+
+// GetGatewayReputation returns the reputation of a Gateway.
+func (r *Reputation) GetGatewayReputation(gatewayNodeID *nodeid.NodeID) (val int64, exists bool) {
+	return r.getPeerReputation(r.gateways, &r.gatewaysMapLock, gatewayNodeID)
+}
+
+// GetOrEstablishGatewayReputation returns the reputation of a Gateway, or the initial reputation if the
+// Gateway doesn't have a reputation yet.
+func (r *Reputation) GetOrEstablishGatewayReputation(gatewayNodeID *nodeid.NodeID) int64 {
+	val, exists := r.GetGatewayReputation(gatewayNodeID)
+	if !exists {
+		return peerInitialReputation
+	}
+	return val
+}
+
+// SetGatewayReputation sets the reputation of a Gateway.
+func (r *Reputation) SetGatewayReputation(gatewayNodeID *nodeid.NodeID, newReputation int64) {
+	r.setPeerReputation(nodeKindGateway, r.gateways, &r.gatewaysMapLock, gatewayNodeID, newReputation)
+}
+
+// GatewaySuccessfulResponse updates a Gateway's reputation given a valid response to a request.
+func (r *Reputation) GatewaySuccessfulResponse(gatewayNodeID *nodeid.NodeID) int64 {
+	return r.changePeerReputation(nodeKindGateway, r.gateways, &r.gatewaysMapLock, gatewayNodeID, peerSuccessfulResponse)
+}
+
+// GatewayUncontactable updates a Gateway's reputation given a request that timed out or a Gateway
+// that could not be connected to.
+func (r *Reputation) GatewayUncontactable(gatewayNodeID *nodeid.NodeID) int64 {
+	return r.changePeerReputation(nodeKindGateway, r.gateways, &r.gatewaysMapLock, gatewayNodeID, peerUncontactable)
+}
+
+// GatewayVerificationFailure updates a Gateway's reputation given a response that failed
+// signature verification. It must only be called for responses to requests sent to the Gateway,
+// as anybody can send a request in the name of the Gateway.
+func (r *Reputation) GatewayVerificationFailure(gatewayNodeID *nodeid.NodeID) int64 {
+	return r.changePeerReputation(nodeKindGateway, r.gateways, &r.gatewaysMapLock, gatewayNodeID, peerVerificationFailure)
+}
+
+// GetProviderReputation returns the reputation of a Retrieval Provider.
+func (r *Reputation) GetProviderReputation(providerNodeID *nodeid.NodeID) (val int64, exists bool) {
+	return r.getPeerReputation(r.providers, &r.providersMapLock, providerNodeID)
+}
+
+// SetProviderReputation sets the reputation of a Retrieval Provider.
+func (r *Reputation) SetProviderReputation(providerNodeID *nodeid.NodeID, newReputation int64) {
+	r.setPeerReputation(nodeKindProvider, r.providers, &r.providersMapLock, providerNodeID, newReputation)
+}
+
+// ProviderSuccessfulPublish updates a Retrieval Provider's reputation given a valid offer publication.
+func (r *Reputation) ProviderSuccessfulPublish(providerNodeID *nodeid.NodeID) int64 {
+	return r.changePeerReputation(nodeKindProvider, r.providers, &r.providersMapLock, providerNodeID, peerSuccessfulResponse)
+}
+
+// ProviderVerificationFailure updates a Retrieval Provider's reputation given a response or an offer
+// in a response that failed signature verification. It must only be called for responses to requests
+// sent to the Retrieval Provider, as anybody can send a request in the name of the Retrieval Provider.
+func (r *Reputation) ProviderVerificationFailure(providerNodeID *nodeid.NodeID) int64 {
+	return r.changePeerReputation(nodeKindProvider, r.providers, &r.providersMapLock, providerNodeID, peerVerificationFailure)
+}
+
+// ProviderInvalidOffer updates a Retrieval Provider's reputation given an offer from which a sub CID
+// offer could not be generated.
+func (r *Reputation) ProviderInvalidOffer(providerNodeID *nodeid.NodeID) int64 {
+	return r.changePeerReputation(nodeKindProvider, r.providers, &r.providersMapLock, providerNodeID, peerInvalidOffer)
+}
@@ -0,0 +1,70 @@
+package reputation
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// NodeKind is the kind of node a reputation value belongs to.
+type NodeKind string
+
+const (
+	nodeKindClient   NodeKind = "client"
+	nodeKindGateway  NodeKind = "gateway"
+	nodeKindProvider NodeKind = "provider"
+)
+
+// State is the reputation of all nodes known to this node, indexed by node id.
+type State struct {
+	Clients   map[string]int64 `json:"clients"`
+	Gateways  map[string]int64 `json:"gateways"`
+	Providers map[string]int64 `json:"providers"`
+}
+
+// newState creates an empty state.
+func newState() *State {
+	return &State{
+		Clients:   make(map[string]int64),
+		Gateways:  make(map[string]int64),
+		Providers: make(map[string]int64),
+	}
+}
+
+// ensureMaps allocates any map left nil, for instance by decoding a state with missing fields.
+func (s *State) ensureMaps() {
+	if s.Clients == nil {
+		s.Clients = make(map[string]int64)
+	}
+	if s.Gateways == nil {
+		s.Gateways = make(map[string]int64)
+	}
+	if s.Providers == nil {
+		s.Providers = make(map[string]int64)
+	}
+}
+
+// Backend persists reputation, so that it survives a restart.
+type Backend interface {
+	// Load returns the persisted state. It is called once, before any other method.
+	Load() (*State, error)
+
+	// Append records the new reputation value of a node.
+	Append(kind NodeKind, id string, value int64) error
+
+	// Snapshot persists the full state returned by capture, so that the changes appended before the
+	// snapshot no longer need to be kept. capture is called without any backend lock held.
+	Snapshot(capture func() *State) error
+
+	// Close releases any resources held by the backend.
+	Close() error
+}
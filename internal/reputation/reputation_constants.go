@@ -38,4 +38,21 @@ const clientMicroPayment = int64(1)
 // Invalid message received
 const clientInvalidMessage = int64(-10)
 
+// Request received after its TTL expired
+const clientExpiredRequest = int64(-1)
 
+const peerMaxReputation = int64(10000)
+const peerMinReputation = int64(-10000)
+const peerInitialReputation = int64(100)
+
+// Gateway or Provider responded to a request with a valid response
+const peerSuccessfulResponse = int64(1)
+
+// Gateway did not respond in time or could not be contacted
+const peerUncontactable = int64(-10)
+
+// Gateway response or Provider message failed signature verification
+const peerVerificationFailure = int64(-100)
+
+// Provider published an offer from which a sub CID offer could not be generated
+const peerInvalidOffer = int64(-50)
@@ -3,10 +3,14 @@ package reputation
 // Copyright (C) 2020 ConsenSys Software Inc
 
 import (
+	"sync"
+
+	"github.com/ConsenSys/fc-retrieval-common/pkg/logging"
 	"github.com/ConsenSys/fc-retrieval-common/pkg/nodeid"
 )
 
-// NOTE: At present all reputation is stored in memory. This will need to change as we move beyond a PoC.
+// NOTE: Reputation is held in memory. When a backend is configured, every change is also appended to it while
+// the map lock is held, so that the order of the changes in the backend matches the order in memory.
 
 
 func (r *Reputation) getClientReputation(clientNodeID *nodeid.NodeID) (val int64, exists bool) {
@@ -21,6 +25,7 @@ func (r *Reputation) setClientReputation(clientNodeID *nodeid.NodeID, val int64)
 	clientNodeIDStr := clientNodeID.ToString()
 	r.clientsMapLock.Lock()
 	r.clients[clientNodeIDStr] = val
+	r.persist(nodeKindClient, clientNodeIDStr, val)
 	r.clientsMapLock.Unlock()
 }
 
@@ -42,7 +47,58 @@ func (r *Reputation) changeClientReputation(clientNodeID *nodeid.NodeID, amount
 	}
 
 	r.clients[clientNodeIDStr] = newVal
+	r.persist(nodeKindClient, clientNodeIDStr, newVal)
 	r.clientsMapLock.Unlock()
 
 	return newVal
 }
+
+// getPeerReputation returns the reputation of a Gateway or Retrieval Provider from the given map.
+func (r *Reputation) getPeerReputation(peers map[string]int64, lock *sync.RWMutex, peerNodeID *nodeid.NodeID) (val int64, exists bool) {
+	lock.RLock()
+	val, exists = peers[peerNodeID.ToString()]
+	lock.RUnlock()
+	return
+}
+
+func (r *Reputation) setPeerReputation(kind NodeKind, peers map[string]int64, lock *sync.RWMutex, peerNodeID *nodeid.NodeID, val int64) {
+	peerNodeIDStr := peerNodeID.ToString()
+	lock.Lock()
+	peers[peerNodeIDStr] = val
+	r.persist(kind, peerNodeIDStr, val)
+	lock.Unlock()
+}
+
+// changePeerReputation changes the reputation of a Gateway or Retrieval Provider. Unlike clients, peers do not
+// go through an establishment challenge, so the initial reputation is established on the first change.
+func (r *Reputation) changePeerReputation(kind NodeKind, peers map[string]int64, lock *sync.RWMutex, peerNodeID *nodeid.NodeID, amount int64) int64 {
+	peerNodeIDStr := peerNodeID.ToString()
+	lock.Lock()
+	val, exists := peers[peerNodeIDStr]
+	if !exists {
+		val = peerInitialReputation
+	}
+	newVal := val + amount
+	if newVal > peerMaxReputation {
+		newVal = peerMaxReputation
+	} else if newVal < peerMinReputation {
+		newVal = peerMinReputation
+	}
+
+	peers[peerNodeIDStr] = newVal
+	r.persist(kind, peerNodeIDStr, newVal)
+	lock.Unlock()
+
+	return newVal
+}
+
+// persist appends a reputation change to the backend, if any. Failures are logged, as reputation changes are
+// a side effect of serving a request and must not fail it.
+func (r *Reputation) persist(kind NodeKind, id string, val int64) {
+	if r.backend == nil {
+		return
+	}
+	if err := r.backend.Append(kind, id, val); err != nil {
+		logging.Error("Error persisting reputation of %s %s: %s", kind, id, err.Error())
+	}
+}
@@ -85,6 +85,19 @@ func TestClientInvalidMessage(t *testing.T) {
 	testClientReputationChange(t, GetSingleInstance().ClientInvalidMessage, clientInvalidMessage)
 }
 
+func TestClientExpiredRequest(t *testing.T) {
+	testClientReputationChange(t, GetSingleInstance().ClientExpiredRequest, clientExpiredRequest)
+}
+
+func TestClientGetOrEstablish(t *testing.T) {
+	n := nodeid.NewRandomNodeID()
+	r := GetSingleInstance()
+	assert.False(t, r.ClientExists(n))
+	assert.Equal(t, clientInitialReputation, r.GetOrEstablishClientReputation(n))
+	r.ClientInvalidMessage(n)
+	assert.Equal(t, clientInitialReputation+clientInvalidMessage, r.GetOrEstablishClientReputation(n))
+}
+
 func TestClientRepMax(t *testing.T) {
 	id := big.NewInt(2)
 	n, err := nodeid.NewNodeID(id)
@@ -120,3 +133,46 @@ func testClientReputationChange1(t *testing.T, f func(clientNodeID *nodeid.NodeI
 	rep, _ := r.GetClientReputation(n)
 	assert.Equal(t, clientInitialReputation+clientEstablishmentChallenge+expectedChange, rep, "reputation not set correctly")
 }
+
+func TestGatewaySuccessfulResponse(t *testing.T) {
+	testPeerReputationChange(t, GetSingleInstance().GatewaySuccessfulResponse, GetSingleInstance().GetGatewayReputation, peerSuccessfulResponse)
+}
+
+func TestGatewayUncontactable(t *testing.T) {
+	testPeerReputationChange(t, GetSingleInstance().GatewayUncontactable, GetSingleInstance().GetGatewayReputation, peerUncontactable)
+}
+
+func TestGatewayVerificationFailure(t *testing.T) {
+	testPeerReputationChange(t, GetSingleInstance().GatewayVerificationFailure, GetSingleInstance().GetGatewayReputation, peerVerificationFailure)
+}
+
+func TestProviderSuccessfulPublish(t *testing.T) {
+	testPeerReputationChange(t, GetSingleInstance().ProviderSuccessfulPublish, GetSingleInstance().GetProviderReputation, peerSuccessfulResponse)
+}
+
+func TestProviderVerificationFailure(t *testing.T) {
+	testPeerReputationChange(t, GetSingleInstance().ProviderVerificationFailure, GetSingleInstance().GetProviderReputation, peerVerificationFailure)
+}
+
+func TestProviderInvalidOffer(t *testing.T) {
+	testPeerReputationChange(t, GetSingleInstance().ProviderInvalidOffer, GetSingleInstance().GetProviderReputation, peerInvalidOffer)
+}
+
+func TestGatewayGetOrEstablish(t *testing.T) {
+	n := nodeid.NewRandomNodeID()
+	r := GetSingleInstance()
+	assert.Equal(t, peerInitialReputation, r.GetOrEstablishGatewayReputation(n))
+	_, exists := r.GetGatewayReputation(n)
+	assert.False(t, exists)
+	r.SetGatewayReputation(n, peerMinReputation)
+	r.GatewayVerificationFailure(n)
+	assert.Equal(t, peerMinReputation, r.GetOrEstablishGatewayReputation(n))
+}
+
+func testPeerReputationChange(t *testing.T, f func(peerNodeID *nodeid.NodeID) int64, get func(peerNodeID *nodeid.NodeID) (int64, bool), expectedChange int64) {
+	n := nodeid.NewRandomNodeID()
+	assert.Equal(t, peerInitialReputation+expectedChange, f(n))
+	rep, exists := get(n)
+	assert.True(t, exists)
+	assert.Equal(t, peerInitialReputation+expectedChange, rep, "reputation not set correctly")
+}
@@ -4,16 +4,16 @@ package util
 import (
 	"os"
 	"os/signal"
+	"syscall"
 )
 
 
-// SetUpCtrlCExit - configure the program such that when Control-C is hit, gracefulExit is called, followed by program exit.
-func SetUpCtrlCExit(gracefulExit func()) {
+// WaitForExitSignal - block until Control-C (SIGINT) or SIGTERM is received, and return the signal.
+func WaitForExitSignal() os.Signal {
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	go func() {
-		<-sig
-		gracefulExit()
-		os.Exit(0)
-	}()
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	s := <-sig
+	// Restore the default behaviour so that a second signal kills the process immediately.
+	signal.Stop(sig)
+	return s
 }
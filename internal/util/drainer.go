@@ -0,0 +1,89 @@
+package util
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"sync"
+	"time"
+)
+
+// Drainer keeps track of in-flight requests so that they can be drained on shutdown.
+type Drainer struct {
+	lock     sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+	count    int
+}
+
+// NewDrainer creates a new drainer.
+func NewDrainer() *Drainer {
+	return &Drainer{}
+}
+
+// Enter registers a new in-flight request. It returns false if the drainer is draining,
+// in which case the request must be refused and Leave must not be called.
+func (d *Drainer) Enter() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.draining {
+		return false
+	}
+	d.inFlight.Add(1)
+	d.count++
+	return true
+}
+
+// Leave marks an in-flight request as completed.
+func (d *Drainer) Leave() {
+	d.lock.Lock()
+	d.count--
+	d.lock.Unlock()
+	d.inFlight.Done()
+}
+
+// InFlight returns the number of requests in flight.
+func (d *Drainer) InFlight() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.count
+}
+
+// IsDraining returns true once Drain has been called.
+func (d *Drainer) IsDraining() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.draining
+}
+
+// Drain stops admitting new requests and waits up to timeout for in-flight requests to complete.
+// It returns false if requests were still in flight when the timeout expired.
+func (d *Drainer) Drain(timeout time.Duration) bool {
+	d.lock.Lock()
+	d.draining = true
+	d.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
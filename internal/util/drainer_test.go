@@ -0,0 +1,51 @@
+package util
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainWaitsForInFlight(t *testing.T) {
+	d := NewDrainer()
+	assert.True(t, d.Enter())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		d.Leave()
+	}()
+	assert.True(t, d.Drain(time.Second))
+	assert.True(t, d.IsDraining())
+	assert.False(t, d.Enter())
+}
+
+func TestDrainTimeout(t *testing.T) {
+	d := NewDrainer()
+	assert.True(t, d.Enter())
+	assert.False(t, d.Drain(10*time.Millisecond))
+	d.Leave()
+}
+
+func TestInFlight(t *testing.T) {
+	d := NewDrainer()
+	assert.True(t, d.Enter())
+	assert.True(t, d.Enter())
+	assert.Equal(t, 2, d.InFlight())
+	d.Leave()
+	assert.Equal(t, 1, d.InFlight())
+}
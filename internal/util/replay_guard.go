@@ -0,0 +1,93 @@
+package util
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReplay is returned by ReplayGuard.Check when a key has already been seen and has not expired yet.
+var ErrReplay = errors.New("nonce has already been used")
+
+// ErrReplayGuardFull is returned by ReplayGuard.Check when the guard holds as many keys as it can, none of which has
+// expired yet.
+var ErrReplayGuardFull = errors.New("too many requests in flight")
+
+// ReplayGuard remembers keys, for instance message nonces, until they expire, so that a message can only be
+// accepted once. Keys are indexed by expiry, so that expired keys are dropped without scanning the whole guard. The
+// guard is bounded: once full, new keys are refused until some expire, rather than forgetting keys that have not
+// expired and letting their messages be replayed. Callers bound the expiries, so that a full guard empties quickly.
+type ReplayGuard struct {
+	lock       sync.Mutex
+	maxEntries int
+	seen       map[string]time.Time
+	expiries   expiryHeap
+}
+
+// NewReplayGuard creates a new replay guard holding up to maxEntries keys. It is unbounded if maxEntries is not
+// positive.
+func NewReplayGuard(maxEntries int) *ReplayGuard {
+	return &ReplayGuard{
+		maxEntries: maxEntries,
+		seen:       make(map[string]time.Time),
+	}
+}
+
+// Check remembers key until expiry and returns nil if key has not been seen, or if it has expired. It returns
+// ErrReplay if key has been seen and has not expired yet, in which case the message is a replay, and
+// ErrReplayGuardFull if the guard is full.
+func (g *ReplayGuard) Check(key string, expiry time.Time) error {
+	now := GetTimeImpl().Now()
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for len(g.expiries) > 0 && !now.Before(g.expiries[0].expiry) {
+		entry := heap.Pop(&g.expiries).(expiryEntry)
+		delete(g.seen, entry.key)
+	}
+	if _, exists := g.seen[key]; exists {
+		return ErrReplay
+	}
+	if g.maxEntries > 0 && len(g.seen) >= g.maxEntries {
+		return ErrReplayGuardFull
+	}
+	g.seen[key] = expiry
+	heap.Push(&g.expiries, expiryEntry{key: key, expiry: expiry})
+	return nil
+}
+
+// expiryEntry is a key and its expiry.
+type expiryEntry struct {
+	key    string
+	expiry time.Time
+}
+
+// expiryHeap is a min-heap of keys ordered by expiry, it implements heap.Interface.
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expiry.Before(h[j].expiry) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
@@ -0,0 +1,57 @@
+package util
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayGuard(t *testing.T) {
+	defer SetRealClock()
+	SetMockedClock(1000)
+	g := NewReplayGuard(0)
+	expiry := time.Unix(1010, 0)
+	assert.NoError(t, g.Check("a", expiry))
+	assert.Equal(t, ErrReplay, g.Check("a", expiry))
+	assert.NoError(t, g.Check("b", expiry))
+
+	SetMockedClock(1010)
+	assert.NoError(t, g.Check("a", time.Unix(1020, 0)))
+}
+
+func TestReplayGuardBounded(t *testing.T) {
+	defer SetRealClock()
+	SetMockedClock(1000)
+	g := NewReplayGuard(2)
+	assert.NoError(t, g.Check("a", time.Unix(1020, 0)))
+	assert.NoError(t, g.Check("b", time.Unix(1010, 0)))
+
+	// Flooding a full guard never makes it forget a key that has not expired.
+	for _, key := range []string{"c", "d", "e"} {
+		assert.Equal(t, ErrReplayGuardFull, g.Check(key, time.Unix(1030, 0)))
+	}
+	assert.Equal(t, ErrReplay, g.Check("a", time.Unix(1030, 0)))
+	assert.Equal(t, ErrReplay, g.Check("b", time.Unix(1030, 0)))
+
+	// The key expiring first makes room, the other one is still a replay.
+	SetMockedClock(1010)
+	assert.NoError(t, g.Check("c", time.Unix(1030, 0)))
+	assert.Equal(t, ErrReplay, g.Check("a", time.Unix(1030, 0)))
+	assert.Equal(t, ErrReplayGuardFull, g.Check("b", time.Unix(1030, 0)))
+}
@@ -0,0 +1,82 @@
+package settings
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultPriceSurgePercent is the default percentage of the prices charged to clients while the gateway is under
+// load
+const DefaultPriceSurgePercent = int64(150)
+
+// DefaultPriceQuoteTTL is the default time during which the price quotes given to clients are honoured
+const DefaultPriceQuoteTTL = 5 * time.Minute
+
+// DefaultPriceQuoteLimit is the default maximum number of unexpired price quotes remembered
+const DefaultPriceQuoteLimit = int64(10000)
+
+// DefaultPriceQuoteClientLimit is the default maximum number of unexpired price quotes remembered for a client
+const DefaultPriceQuoteClientLimit = int64(10)
+
+// CIDRangePrice scales the prices of the CIDs within a range. The range is given by the hex prefixes of its first and
+// last CID: "00" to "7f" holds the CIDs starting with a byte lower than 0x80.
+type CIDRangePrice struct {
+	First   string
+	Last    string
+	Percent int64 // Percentage of the prices charged for the CIDs of the range
+}
+
+// Contains returns true if the CID written in hex is within the range.
+func (r CIDRangePrice) Contains(cidHex string) bool {
+	if len(cidHex) < len(r.First) || len(cidHex) < len(r.Last) {
+		return false
+	}
+	return cidHex[:len(r.First)] >= r.First && cidHex[:len(r.Last)] <= r.Last
+}
+
+// CIDRangePrices are the prices of ranges of CIDs, the first range holding a CID gives its price.
+type CIDRangePrices []CIDRangePrice
+
+// String returns the CID range prices in the format of the configuration: "first-last:percent", comma separated.
+func (r CIDRangePrices) String() string {
+	ranges := make([]string, len(r))
+	for i, cidRange := range r {
+		ranges[i] = fmt.Sprintf("%s-%s:%d", cidRange.First, cidRange.Last, cidRange.Percent)
+	}
+	return strings.Join(ranges, ",")
+}
+
+// ReputationDiscount is the discount given to clients from a reputation.
+type ReputationDiscount struct {
+	MinReputation int64
+	Percent       int64 // Percentage taken off the prices
+}
+
+// ReputationDiscounts are the discounts of the reputation tiers of clients, the tier with the highest minimum
+// reputation reached by a client gives its discount.
+type ReputationDiscounts []ReputationDiscount
+
+// String returns the reputation discounts in the format of the configuration: "reputation:percent", comma separated.
+func (d ReputationDiscounts) String() string {
+	tiers := make([]string, len(d))
+	for i, tier := range d {
+		tiers[i] = fmt.Sprintf("%d:%d", tier.MinReputation, tier.Percent)
+	}
+	return strings.Join(tiers, ",")
+}
@@ -0,0 +1,50 @@
+package settings
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ReloadReport lists the settings that changed when settings were reloaded, by their configuration key.
+type ReloadReport struct {
+	Reloaded        []string `json:"reloaded"`         // Settings that changed and have been applied
+	RestartRequired []string `json:"restart_required"` // Settings that changed but only apply once the gateway restarts
+}
+
+// Reload returns a copy of the settings with the reloadable settings taken from next, together with a report of the
+// settings that differ between the two. The settings are not modified.
+func (s *AppSettings) Reload(next *AppSettings) (*AppSettings, *ReloadReport) {
+	reloaded := *s
+	report := &ReloadReport{Reloaded: []string{}, RestartRequired: []string{}}
+	current, nextValue, reloadedValue := reflect.ValueOf(s).Elem(), reflect.ValueOf(next).Elem(), reflect.ValueOf(&reloaded).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		// Values are compared as printed, so that amounts held by different big.Int are compared by value.
+		if fmt.Sprint(current.Field(i).Interface()) == fmt.Sprint(nextValue.Field(i).Interface()) {
+			continue
+		}
+		key := field.Tag.Get("mapstructure")
+		if field.Tag.Get("reload") != "true" {
+			report.RestartRequired = append(report.RestartRequired, key)
+			continue
+		}
+		reloadedValue.Field(i).Set(nextValue.Field(i))
+		report.Reloaded = append(report.Reloaded, key)
+	}
+	return &reloaded, report
+}
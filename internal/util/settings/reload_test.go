@@ -0,0 +1,55 @@
+package settings
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	current := &AppSettings{
+		BindRestAPI:              "9010",
+		LogLevel:                 "info",
+		TCPInactivityTimeout:     time.Second,
+		TCPLongInactivityTimeout: 5 * time.Second,
+		SearchPrice:              big.NewInt(1000),
+		OfferPrice:               big.NewInt(1000),
+	}
+	next := *current
+	next.BindRestAPI = "9020"
+	next.LogLevel = "debug"
+	next.TCPInactivityTimeout = 2 * time.Second
+	next.TCPLongInactivityTimeout = 10 * time.Second
+	next.SearchPrice = big.NewInt(2000)
+	next.OfferPrice = big.NewInt(1000)
+
+	reloaded, report := current.Reload(&next)
+	assert.Equal(t, []string{"LOG_LEVEL", "TCP_INACTIVITY_TIMEOUT", "TCP_LONG_INACTIVITY_TIMEOUT", "SEARCH_PRICE"}, report.Reloaded)
+	assert.Equal(t, []string{"BIND_REST_API"}, report.RestartRequired)
+	assert.Equal(t, "9010", reloaded.BindRestAPI)
+	assert.Equal(t, "debug", reloaded.LogLevel)
+	assert.Equal(t, int64(2000), reloaded.SearchPrice.Int64())
+	assert.Equal(t, 2*time.Second, reloaded.TCPInactivityTimeout)
+	assert.Equal(t, 10*time.Second, reloaded.TCPLongInactivityTimeout)
+
+	// The current settings are left untouched.
+	assert.Equal(t, "info", current.LogLevel)
+	assert.Equal(t, int64(1000), current.SearchPrice.Int64())
+}
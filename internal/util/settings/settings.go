@@ -26,44 +26,160 @@ import (
 // DefaultRegisterRefreshDuration is the default register refresh duration
 const DefaultRegisterRefreshDuration = 5000 * time.Millisecond
 
+// DefaultRegisterSyncMaxAge is the default maximum time since the register service was last read for the gateway
+// to be ready
+const DefaultRegisterSyncMaxAge = 30 * time.Second
+
 // DefaultTCPInactivityTimeout is the default timeout for TCP inactivity
 const DefaultTCPInactivityTimeout = 100 * time.Millisecond
 
 // DefaultLongTCPInactivityTimeout is the default timeout for long TCP inactivity. This timeout should never be ignored.
 const DefaultLongTCPInactivityTimeout = 5000 * time.Millisecond
 
-// AppSettings defines the server configuraiton
+// DefaultShutdownTimeout is the default time allowed for in-flight requests to complete on shutdown
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultDataDir is the default directory holding the gateway's persisted state
+const DefaultDataDir = "data"
+
+// DefaultOfferStore is the default type of offer store
+const DefaultOfferStore = "file"
+
+// DefaultReputationSnapshotInterval is the default interval between two snapshots of the reputation
+const DefaultReputationSnapshotInterval = 5 * time.Minute
+
+// DefaultClientRefuseReputation is the default reputation below which client requests are refused
+const DefaultClientRefuseReputation = int64(-1000)
+
+// DefaultClientThrottleReputation is the default reputation below which client requests are throttled
+const DefaultClientThrottleReputation = int64(-100)
+
+// DefaultClientThrottleInterval is the default minimum interval between two requests of a throttled client
+const DefaultClientThrottleInterval = 1 * time.Second
+
+// DefaultClientPrepayReputation is the default reputation below which clients must pay before being served
+const DefaultClientPrepayReputation = int64(0)
+
+// DefaultDHTFanOutWorkers is the default maximum number of gateways requested concurrently for a DHT discovery
+const DefaultDHTFanOutWorkers = 8
+
+// DefaultPaymentRequestTTL is the default time after which unpaid payment requests expire
+const DefaultPaymentRequestTTL = 10 * time.Minute
+
+// DefaultPaymentRequestLimit is the default maximum number of outstanding payment requests
+const DefaultPaymentRequestLimit = int64(10000)
+
+// DefaultPaymentRequestPayerLimit is the default maximum number of outstanding payment requests of a payer
+const DefaultPaymentRequestPayerLimit = int64(10)
+
+// DefaultPaymentManager is the default type of payment manager
+const DefaultPaymentManager = "lotus"
+
+// DefaultPaymentChannelRefreshInterval is the default interval between refreshes of the payment channel states
+const DefaultPaymentChannelRefreshInterval = time.Minute
+
+// DefaultAdminRequestWindow is the default maximum difference between the timestamp of an admin request and the
+// time it is received
+const DefaultAdminRequestWindow = 5 * time.Minute
+
+// DefaultKeyActivationMinDelay is the default minimum delay between the publication of a new signing key and its
+// activation
+const DefaultKeyActivationMinDelay = time.Minute
+
+// DefaultKeyGraceWindow is the default time during which the previous signing key of a peer is still accepted
+const DefaultKeyGraceWindow = time.Hour
+
+// DefaultNonceCacheSize is the default maximum number of nonces remembered to reject replayed messages
+const DefaultNonceCacheSize = 100000
+
+// DefaultNonceWindow is the default time the nonce of a message without a ttl is remembered
+const DefaultNonceWindow = 10 * time.Minute
+
+// DefaultGatewaySkipReputation is the default reputation below which gateways are not contacted
+const DefaultGatewaySkipReputation = int64(-1000)
+
+// DefaultGatewayDeprioritiseReputation is the default reputation below which gateways are only contacted
+// when there are not enough gateways with a better reputation
+const DefaultGatewayDeprioritiseReputation = int64(0)
+
+// AppSettings defines the server configuraiton. Settings tagged secret are redacted when the configuration is printed,
+// settings tagged reload can be reloaded without restarting the gateway. AppSettings are read from many goroutines
+// and must not be modified once in use: reloads replace them with a new copy.
 type AppSettings struct {
-	BindRestAPI     string `mapstructure:"BIND_REST_API"`     // Port number to bind to for client REST API.
-	BindProviderAPI string `mapstructure:"BIND_PROVIDER_API"` // Port number to bind to for provider TCP communication API.
-	BindGatewayAPI  string `mapstructure:"BIND_GATEWAY_API"`  // Port number to bind to for gateway TCP communication API.
-	BindAdminAPI    string `mapstructure:"BIND_ADMIN_API"`    // Port number to bind to for admin TCP communication API.
-	LogLevel        string `mapstructure:"LOG_LEVEL"`         // Log Level: NONE, ERROR, WARN, INFO, TRACE
-	LogTarget       string `mapstructure:"LOG_TARGET"`        // Log Level: STDOUT
-	LogDir          string `mapstructure:"LOG_DIR"`           // Log Dir: /var/log/fc-retrieval/fc-retrieval-gateway
-	LogFile         string `mapstructure:"LOG_FILE"`          // Log File: gateway.log
-	LogMaxBackups   int    `mapstructure:"LOG_MAX_BACKUPS"`   // Log max backups: 3
-	LogMaxAge       int    `mapstructure:"LOG_MAX_AGE"`       // Log max age (days): 28
-	LogMaxSize      int    `mapstructure:"LOG_MAX_SIZE"`      // Log max size (MB): 500
-	LogCompress     bool   `mapstructure:"LOG_COMPRESS"`      // Log compress: false
-	GatewayID       string `mapstructure:"GATEWAY_ID"`        // Node id of this gateway
-
-	RegisterAPIURL          string        `mapstructure:"REGISTER_API_URL"`          // Register service url
-	RegisterRefreshDuration time.Duration `mapstructure:"REGISTER_REFRESH_DURATION"` // Register refresh duration
-	GatewayAddress          string        `mapstructure:"GATEWAY_ADDRESS"`           // Gateway address
-	NetworkInfoGateway      string        `mapstructure:"GATEWAY_NETWORK_INFO"`      // Gateway network info
-	GatewayRegionCode       string        `mapstructure:"GATEWAY_REGION_CODE"`       // Gateway region code
-	GatewayRootSigningKey   string        `mapstructure:"GATEWAY_ROOT_SIGNING_KEY"`  // Gateway root signing key
-	GatewaySigningKey       string        `mapstructure:"GATEWAY_SIGNING_KEY"`       // Gateway signing key
+	BindRestAPI     string `mapstructure:"BIND_REST_API"`           // Port number to bind to for client REST API.
+	BindProviderAPI string `mapstructure:"BIND_PROVIDER_API"`       // Port number to bind to for provider TCP communication API.
+	BindGatewayAPI  string `mapstructure:"BIND_GATEWAY_API"`        // Port number to bind to for gateway TCP communication API.
+	BindAdminAPI    string `mapstructure:"BIND_ADMIN_API"`          // Port number to bind to for admin TCP communication API.
+	BindMetricsAPI  string `mapstructure:"BIND_METRICS_API"`        // Port number to bind to for the metrics endpoint, metrics are not exposed if empty.
+	BindHealthAPI   string `mapstructure:"BIND_HEALTH_API"`         // Port number to bind to for the health endpoints, health is not exposed if empty.
+	LogLevel        string `mapstructure:"LOG_LEVEL" reload:"true"` // Log Level: NONE, ERROR, WARN, INFO, TRACE
+	LogTarget       string `mapstructure:"LOG_TARGET"`              // Log Level: STDOUT
+	LogDir          string `mapstructure:"LOG_DIR"`                 // Log Dir: /var/log/fc-retrieval/fc-retrieval-gateway
+	LogFile         string `mapstructure:"LOG_FILE"`                // Log File: gateway.log
+	LogMaxBackups   int    `mapstructure:"LOG_MAX_BACKUPS"`         // Log max backups: 3
+	LogMaxAge       int    `mapstructure:"LOG_MAX_AGE"`             // Log max age (days): 28
+	LogMaxSize      int    `mapstructure:"LOG_MAX_SIZE"`            // Log max size (MB): 500
+	LogCompress     bool   `mapstructure:"LOG_COMPRESS"`            // Log compress: false
+	GatewayID       string `mapstructure:"GATEWAY_ID"`              // Node id of this gateway
+	DataDir         string `mapstructure:"DATA_DIR"`                // Data Dir: /var/lib/fc-retrieval/fc-retrieval-gateway
+	OfferStore      string `mapstructure:"OFFER_STORE"`             // Offer store type: file, memory
+	ReputationDir   string `mapstructure:"REPUTATION_DIR"`          // Reputation Dir: defaults to the reputation directory in the data dir
+
+	KeystoreFile           string `mapstructure:"KEYSTORE_FILE"`            // Keystore file: defaults to the keystore file in the data dir
+	KeystorePassphraseFile string `mapstructure:"KEYSTORE_PASSPHRASE_FILE"` // File holding the keystore passphrase, if KEYSTORE_PASSPHRASE is not set
+
+	ReputationSnapshotInterval time.Duration `mapstructure:"REPUTATION_SNAPSHOT_INTERVAL"` // Interval between two snapshots of the reputation
+
+	RegisterAPIURL          string        `mapstructure:"REGISTER_API_URL"`                       // Register service url
+	RegisterRefreshDuration time.Duration `mapstructure:"REGISTER_REFRESH_DURATION"`              // Register refresh duration
+	RegisterSyncMaxAge      time.Duration `mapstructure:"REGISTER_SYNC_MAX_AGE" reload:"true"`    // Maximum time since the register was last read for the gateway to be ready
+	GatewayAddress          string        `mapstructure:"GATEWAY_ADDRESS"`                        // Gateway address
+	NetworkInfoGateway      string        `mapstructure:"GATEWAY_NETWORK_INFO"`                   // Gateway network info
+	GatewayRegionCode       string        `mapstructure:"GATEWAY_REGION_CODE"`                    // Gateway region code
+	GatewayRootSigningKey   string        `mapstructure:"GATEWAY_ROOT_SIGNING_KEY" secret:"true"` // Gateway root signing key
+	AdminPublicKey          string        `mapstructure:"ADMIN_PUBLIC_KEY"`                       // Public key of the admin, used to verify admin requests
+	AdminRequestWindow      time.Duration `mapstructure:"ADMIN_REQUEST_WINDOW" reload:"true"`     // Maximum age of an admin request
+	AdminLegacyRequests     bool          `mapstructure:"ADMIN_LEGACY_REQUESTS" reload:"true"`    // Accept signed admin requests without a nonce and a timestamp
+	GatewaySigningKey       string        `mapstructure:"GATEWAY_SIGNING_KEY" secret:"true"`      // Gateway signing key
+	KeyActivationMinDelay   time.Duration `mapstructure:"KEY_ACTIVATION_MIN_DELAY" reload:"true"` // Minimum delay between the publication of a new signing key and its activation
+	KeyGraceWindow          time.Duration `mapstructure:"KEY_GRACE_WINDOW"`                       // Time during which the previous signing key of a peer is still accepted
+	NonceCacheSize          int           `mapstructure:"NONCE_CACHE_SIZE"`                       // Maximum number of nonces remembered to reject replayed messages
+	NonceWindow             time.Duration `mapstructure:"NONCE_WINDOW" reload:"true"`             // Time the nonce of a message without a ttl is remembered, and furthest ttl accepted
 
 	NetworkInfoClient   string `mapstructure:"CLIENT_NETWORK_INFO"`   // Gateway client network info
 	NetworkInfoProvider string `mapstructure:"PROVIDER_NETWORK_INFO"` // Gateway provider network info
 	NetworkInfoAdmin    string `mapstructure:"ADMIN_NETWORK_INFO"`    // Gateway admin network info
 
-	TCPInactivityTimeout     time.Duration `mapstructure:"TCP_INACTIVITY_TIMEOUT"`      // TCP inactivity timeout
-	TCPLongInactivityTimeout time.Duration `mapstructure:"TCP_LONG_INACTIVITY_TIMEOUT"` // TCP long inactivity timeout
+	TCPInactivityTimeout     time.Duration `mapstructure:"TCP_INACTIVITY_TIMEOUT" reload:"true"`      // TCP inactivity timeout, the P2P server keeps the timeout it was started with
+	TCPLongInactivityTimeout time.Duration `mapstructure:"TCP_LONG_INACTIVITY_TIMEOUT" reload:"true"` // TCP inactivity timeout when waiting for the response of a peer to a long-running request
+	ShutdownTimeout          time.Duration `mapstructure:"SHUTDOWN_TIMEOUT" reload:"true"`            // Time allowed for in-flight requests to complete on shutdown
+
+	ClientRefuseReputation   int64         `mapstructure:"CLIENT_REFUSE_REPUTATION" reload:"true"`   // Reputation below which client requests are refused
+	ClientThrottleReputation int64         `mapstructure:"CLIENT_THROTTLE_REPUTATION" reload:"true"` // Reputation below which client requests are throttled
+	ClientThrottleInterval   time.Duration `mapstructure:"CLIENT_THROTTLE_INTERVAL" reload:"true"`   // Minimum interval between two requests of a throttled client
+	ClientPrepayReputation   int64         `mapstructure:"CLIENT_PREPAY_REPUTATION" reload:"true"`   // Reputation below which clients must pay before being served
+
+	GatewaySkipReputation         int64 `mapstructure:"GATEWAY_SKIP_REPUTATION" reload:"true"`         // Reputation below which gateways are not contacted
+	GatewayDeprioritiseReputation int64 `mapstructure:"GATEWAY_DEPRIORITISE_REPUTATION" reload:"true"` // Reputation below which gateways are contacted last
+	DHTFanOutWorkers              int   `mapstructure:"DHT_FANOUT_WORKERS" reload:"true"`              // Maximum number of gateways requested concurrently for a DHT discovery
+
+	SearchPrice *big.Int `mapstructure:"SEARCH_PRICE" reload:"true"`
+	OfferPrice  *big.Int `mapstructure:"OFFER_PRICE" reload:"true"`
+	TopupAmount *big.Int `mapstructure:"TOPUP_AMOUNT" reload:"true"`
+
+	TopupThreshold *big.Int `mapstructure:"TOPUP_THRESHOLD" reload:"true"` // Amount available in a payment channel at or below which it needs a top up
+
+	PriceCIDRanges           CIDRangePrices      `mapstructure:"PRICE_CID_RANGES" reload:"true"`           // Prices of ranges of CIDs charged to clients, as percentages of the prices
+	PriceReputationDiscounts ReputationDiscounts `mapstructure:"PRICE_REPUTATION_DISCOUNTS" reload:"true"` // Discounts given to clients by reputation tier
+	PriceSurgeThreshold      int64               `mapstructure:"PRICE_SURGE_THRESHOLD" reload:"true"`      // Requests in flight from which surge prices are charged to clients, surge pricing is disabled if 0
+	PriceSurgePercent        int64               `mapstructure:"PRICE_SURGE_PERCENT" reload:"true"`        // Percentage of the prices charged to clients under load
+	PriceQuoteTTL            time.Duration       `mapstructure:"PRICE_QUOTE_TTL" reload:"true"`            // Time during which the price quotes given to clients are honoured
+	PriceQuoteLimit          int                 `mapstructure:"PRICE_QUOTE_LIMIT" reload:"true"`          // Maximum number of unexpired price quotes remembered
+	PriceQuoteClientLimit    int                 `mapstructure:"PRICE_QUOTE_CLIENT_LIMIT" reload:"true"`   // Maximum number of unexpired price quotes remembered for a client
 
-	SearchPrice *big.Int `mapstructure:"SEARCH_PRICE"`
-	OfferPrice  *big.Int `mapstructure:"OFFER_PRICE"`
-	TopupAmount *big.Int `mapstructure:"TOPUP_AMOUNT"`
+	PaymentManager                string        `mapstructure:"PAYMENT_MANAGER"`                  // Payment manager type: lotus, memory
+	PaymentRequestTTL             time.Duration `mapstructure:"PAYMENT_REQUEST_TTL"`              // Time after which unpaid payment requests expire
+	PaymentRequestLimit           int           `mapstructure:"PAYMENT_REQUEST_LIMIT"`            // Maximum number of outstanding payment requests
+	PaymentRequestPayerLimit      int           `mapstructure:"PAYMENT_REQUEST_PAYER_LIMIT"`      // Maximum number of outstanding payment requests of a payer
+	PaymentChannelRefreshInterval time.Duration `mapstructure:"PAYMENT_CHANNEL_REFRESH_INTERVAL"` // Interval between refreshes of the payment channel states
 }
@@ -0,0 +1,54 @@
+package util
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"sync"
+	"time"
+)
+
+// throttlePruneSize is the number of keys above which keys that are no longer throttled are pruned.
+const throttlePruneSize = 10000
+
+// Throttle limits how often a given key, for instance a client id, may be used.
+type Throttle struct {
+	lock sync.Mutex
+	last map[string]time.Time
+}
+
+// NewThrottle creates a new throttle.
+func NewThrottle() *Throttle {
+	return &Throttle{last: make(map[string]time.Time)}
+}
+
+// Allow returns true and records the use of key if key has not been used within the last interval.
+func (t *Throttle) Allow(key string, interval time.Duration) bool {
+	now := GetTimeImpl().Now()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if last, exists := t.last[key]; exists && now.Sub(last) < interval {
+		return false
+	}
+	t.last[key] = now
+	if len(t.last) > throttlePruneSize {
+		for k, last := range t.last {
+			if now.Sub(last) >= interval {
+				delete(t.last, k)
+			}
+		}
+	}
+	return true
+}
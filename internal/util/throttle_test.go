@@ -0,0 +1,35 @@
+package util
+
+/*
+ * Copyright 2020 ConsenSys Software Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	defer SetRealClock()
+	SetMockedClock(1000)
+	th := NewThrottle()
+	assert.True(t, th.Allow("a", 10*time.Second))
+	assert.False(t, th.Allow("a", 10*time.Second))
+	assert.True(t, th.Allow("b", 10*time.Second))
+
+	SetMockedClock(1010)
+	assert.True(t, th.Allow("a", 10*time.Second))
+}